@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
@@ -12,11 +13,18 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/mel-ak/onetap-challenge/internal/adapters/auth"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/breaker"
 	"github.com/mel-ak/onetap-challenge/internal/adapters/cache"
 	"github.com/mel-ak/onetap-challenge/internal/adapters/middleware"
-	"github.com/mel-ak/onetap-challenge/internal/adapters/provider"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/notification"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/providers"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/queue"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/ratelimit"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/rates"
 	"github.com/mel-ak/onetap-challenge/internal/adapters/repository"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/vault"
 	"github.com/mel-ak/onetap-challenge/internal/config"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
 	"github.com/mel-ak/onetap-challenge/internal/usecases"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -69,34 +77,85 @@ func main() {
 		// This allows the application to start even if tables already exist
 	}
 
+	// Load the master key used to encrypt provider credentials
+	credentialVault, err := vault.NewFromConfig(cfg.Vault)
+	if err != nil {
+		log.Fatalf("Failed to initialize credentials vault: %v", err)
+	}
+
 	// Initialize adapters
-	dbRepo, err := repository.NewPostgresRepository(cfg.DBConn())
+	dbRepo, err := repository.NewPostgresRepository(cfg.DBConn(), credentialVault)
 	if err != nil {
 		log.Fatalf("Failed to initialize repository: %v", err)
 	}
 	redisClient := cache.NewRedisClient(cfg.Redis.Host + ":" + cfg.Redis.Port)
-	providerSvc := provider.NewHTTPProvider()
 	jwtService := auth.NewJWTService(cfg.JWT.SecretKey)
+	// Refreshes and notifications are processed by cmd/worker
+	jobQueue := queue.NewRedisQueue(redisClient, "jobs", cfg.Queue)
+	notifier := notification.NewQueuedNotifier(jobQueue)
+
+	// Build provider adapters from the providers table and keep them in sync.
+	// Calls to a failing provider fail fast on every replica, and all replicas
+	// share the quota of each provider's API.
+	providerRegistry := providers.NewRegistry(dbRepo, credentialVault)
+	providerRegistry.UseCertificateDir(cfg.ProviderTLS.CertDir)
+	providerRegistry.UseCircuitBreaker(breaker.NewRedisBreaker(redisClient, cfg.Breaker, notifier))
+	providerRegistry.UseRateLimiter(ratelimit.NewRedisLimiter(redisClient, cfg.Quota))
+	if err := providerRegistry.Load(context.Background()); err != nil {
+		log.Printf("Warning: Failed to load providers: %v", err)
+	}
+	registryCtx, stopRegistry := context.WithCancel(context.Background())
+	defer stopRegistry()
+	providerRegistry.Watch(registryCtx, time.Minute)
 
 	// Initialize use cases
 	userUsecase := usecases.NewUserUsecase(dbRepo, jwtService)
-	accountUsecase := usecases.NewAccountUsecase(dbRepo, redisClient)
-	billUsecase := usecases.NewBillUsecase(dbRepo, providerSvc, redisClient)
-	providerUsecase := usecases.NewProviderUsecase(dbRepo)
-	billRefreshUsecase := usecases.NewBillRefreshUsecase(dbRepo, providerSvc, redisClient)
+	accountUsecase := usecases.NewAccountUsecase(dbRepo, providerRegistry, redisClient, cfg.OAuth2.RedirectURL)
+	retryPolicy := usecases.NewRetryPolicy(cfg.Retry)
+	billUsecase := usecases.NewBillUsecase(dbRepo, dbRepo, dbRepo, providerRegistry, redisClient, redisClient, retryPolicy)
+	providerUsecase := usecases.NewProviderUsecase(dbRepo, providerRegistry)
+	billRefreshUsecase := usecases.NewBillRefreshUsecase(dbRepo, providerRegistry, redisClient, redisClient, jobQueue, redisClient, retryPolicy)
+	billUsecase.UseRevalidation(billRefreshUsecase)
+
+	// Bill totals are converted to each user's currency with rates stored in
+	// the database, or read from a local file
+	var exchangeRates ports.ExchangeRateSource = dbRepo
+	if cfg.Rates.Source == "file" {
+		exchangeRates = rates.NewFileSource(cfg.Rates.File)
+	}
+	billUsecase.UseExchangeRates(dbRepo, exchangeRates)
+	exchangeRateUsecase := usecases.NewExchangeRateUsecase(exchangeRates, cfg.Rates.AdminToken)
+	insightsUsecase := usecases.NewInsightsUsecase(dbRepo, dbRepo)
+
+	// Limit requests per user, or per client IP before login, with stricter
+	// limits on logins and manual refreshes
+	rateLimiter, err := middleware.NewRateLimiter(ratelimit.NewSlidingWindow(redisClient),
+		middleware.RateLimitPolicy{Name: "default", Limit: cfg.RateLimit.Default, Window: cfg.RateLimit.Window},
+		cfg.RateLimit.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Failed to configure rate limits: %v", err)
+	}
+	rateLimiter.Limit("/login", middleware.RateLimitPolicy{Name: "login", Limit: cfg.RateLimit.Login, Window: cfg.RateLimit.Window})
+	rateLimiter.Limit("/bills/refresh", middleware.RateLimitPolicy{Name: "refresh", Limit: cfg.RateLimit.Refresh, Window: cfg.RateLimit.Window})
+	limited := func(handler http.HandlerFunc) http.Handler {
+		return rateLimiter.Middleware(handler)
+	}
+
+	adminOnly := middleware.AdminTokenMiddleware(cfg.Rates.AdminToken)
 
 	// Setup router
 	router := mux.NewRouter()
 
 	// Public routes
 	router.HandleFunc("/health", usecases.HealthCheck).Methods(http.MethodGet)
-	router.HandleFunc("/users", userUsecase.CreateUser).Methods(http.MethodPost)
-	router.HandleFunc("/login", userUsecase.Login).Methods(http.MethodPost)
+	router.Handle("/users", limited(userUsecase.CreateUser)).Methods(http.MethodPost)
+	router.Handle("/login", limited(userUsecase.Login)).Methods(http.MethodPost)
+	router.Handle("/accounts/link/callback", limited(accountUsecase.OAuth2Callback)).Methods(http.MethodGet)
 
 	// Protected routes
 	protected := router.PathPrefix("").Subrouter()
 	protected.Use(middleware.AuthMiddleware(jwtService))
-	// protected.Use(middleware.RateLimitMiddleware(redisClient.Client(), 100, time.Minute))
+	protected.Use(rateLimiter.Middleware)
 
 	protected.HandleFunc("/users", userUsecase.ListUsers).Methods(http.MethodGet)
 	protected.HandleFunc("/users/{user_id}", userUsecase.GetUser).Methods(http.MethodGet)
@@ -106,13 +165,26 @@ func main() {
 	protected.HandleFunc("/providers", providerUsecase.CreateProvider).Methods(http.MethodPost)
 	protected.HandleFunc("/providers", providerUsecase.ListProviders).Methods(http.MethodGet)
 	protected.HandleFunc("/providers/{provider_id}", providerUsecase.GetProvider).Methods(http.MethodGet)
+	// Providers are shared by every user and their adapters are sent the
+	// credentials of every linked account, so only administrators change them
+	protected.Handle("/providers/{provider_id}", adminOnly(http.HandlerFunc(providerUsecase.UpdateProvider))).Methods(http.MethodPut)
 	protected.HandleFunc("/providers/{provider_id}/bills", billUsecase.FetchBillsByProvider).Methods(http.MethodGet)
 
 	protected.HandleFunc("/accounts/link", accountUsecase.LinkAccount).Methods(http.MethodPost)
+	protected.HandleFunc("/accounts/link/{provider_id}/authorize", accountUsecase.AuthorizeOAuth2).Methods(http.MethodGet)
 	protected.HandleFunc("/accounts", accountUsecase.ListAccounts).Methods(http.MethodGet)
 	protected.HandleFunc("/bills", billUsecase.FetchBills).Methods(http.MethodGet)
+	protected.HandleFunc("/bills/search", billUsecase.FetchBills).Methods(http.MethodGet)
 	protected.HandleFunc("/bills/refresh", billRefreshUsecase.RefreshBills).Methods(http.MethodPost)
+	protected.HandleFunc("/bills/refresh/{job_id}", billRefreshUsecase.GetRefreshJob).Methods(http.MethodGet)
+	protected.HandleFunc("/bills/{bill_id}", billUsecase.GetBill).Methods(http.MethodGet)
 	protected.HandleFunc("/accounts/{account_id}", accountUsecase.DeleteAccount).Methods(http.MethodDelete)
+	protected.HandleFunc("/exchange-rates", exchangeRateUsecase.GetExchangeRates).Methods(http.MethodGet)
+	protected.HandleFunc("/exchange-rates", exchangeRateUsecase.UpdateExchangeRates).Methods(http.MethodPut)
+	protected.HandleFunc("/insights/spending", insightsUsecase.GetSpending).Methods(http.MethodGet)
+
+	// Internal metrics are for operators, not for every logged-in user
+	router.Handle("/debug/vars", adminOnly(expvar.Handler())).Methods(http.MethodGet)
 
 	// Create and start server
 	srv := &http.Server{
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
@@ -8,8 +9,9 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/mel-ak/onetap-challenge/internal/adapters/auth"
 	"github.com/mel-ak/onetap-challenge/internal/adapters/cache"
-	"github.com/mel-ak/onetap-challenge/internal/adapters/provider"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/providers"
 	"github.com/mel-ak/onetap-challenge/internal/adapters/repository"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/vault"
 	"github.com/mel-ak/onetap-challenge/internal/config"
 	"github.com/mel-ak/onetap-challenge/internal/usecases"
 
@@ -83,21 +85,31 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	credentialVault, err := vault.NewFromConfig(config.NewDefaultConfig().Vault)
+	if err != nil {
+		log.Fatalf("Failed to initialize credentials vault: %v", err)
+	}
+
 	// Initialize adapters
-	dbRepo, err := repository.NewPostgresRepository(cfg.DBConn())
+	dbRepo, err := repository.NewPostgresRepository(cfg.DBConn(), credentialVault)
 	if err != nil {
 		log.Fatalf("Failed to initialize repository: %v", err)
 	}
 	redisClient := cache.NewRedisClient(cfg.Redis.Host + ":" + cfg.Redis.Port)
-	providerSvc := provider.NewHTTPProvider()
 	jwtService := auth.NewJWTService("your-secret-key")
+	providerRegistry := providers.NewRegistry(dbRepo, credentialVault)
+	providerRegistry.UseCertificateDir(cfg.ProviderTLS.CertDir)
+	if err := providerRegistry.Load(context.Background()); err != nil {
+		log.Printf("Warning: Failed to load providers: %v", err)
+	}
 
 	// Initialize use cases
 	userUsecase := usecases.NewUserUsecase(dbRepo, jwtService)
-	accountUsecase := usecases.NewAccountUsecase(dbRepo, redisClient)
-	billUsecase := usecases.NewBillUsecase(dbRepo, providerSvc, redisClient)
+	accountUsecase := usecases.NewAccountUsecase(dbRepo, providerRegistry, redisClient, config.NewDefaultConfig().OAuth2.RedirectURL)
+	billUsecase := usecases.NewBillUsecase(dbRepo, dbRepo, dbRepo, providerRegistry, redisClient, redisClient, usecases.NewRetryPolicy(config.NewDefaultConfig().Retry))
 
-	// Set up HTTP router
+	// Set up HTTP router. This server runs without authentication, so bill
+	// routes read the user from the user_id query parameter.
 	r := mux.NewRouter()
 	r.HandleFunc("/health", usecases.HealthCheck).Methods("GET")
 	r.HandleFunc("/users", userUsecase.CreateUser).Methods("POST")
@@ -107,6 +119,8 @@ func main() {
 	r.HandleFunc("/accounts/link", accountUsecase.LinkAccount).Methods("POST")
 	r.HandleFunc("/accounts", accountUsecase.ListAccounts).Methods("GET")
 	r.HandleFunc("/bills", billUsecase.FetchBills).Methods("GET")
+	r.HandleFunc("/bills/search", billUsecase.FetchBills).Methods("GET")
+	r.HandleFunc("/bills/{bill_id}", billUsecase.GetBill).Methods("GET")
 	r.HandleFunc("/accounts/{account_id}", accountUsecase.DeleteAccount).Methods("DELETE")
 
 	log.Printf("Server starting on port %s", cfg.Server.Port)
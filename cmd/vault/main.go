@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/mel-ak/onetap-challenge/internal/adapters/repository"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/vault"
+	"github.com/mel-ak/onetap-challenge/internal/config"
+)
+
+const usage = `Usage:
+  vault generate-key [-out FILE]
+        Write a new base64 encoded master key to FILE (default
+        .secrets/master.key, "-" for standard output)
+  vault rotate -new-key-file FILE -new-key-version N
+        Re-encrypt all linked account credentials under a new master key`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "generate-key":
+		generateKey(os.Args[2:])
+	case "rotate":
+		rotate(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// generateKey writes a new master key to a file only the current user can
+// read, refusing to overwrite an existing key
+func generateKey(args []string) {
+	flags := flag.NewFlagSet("generate-key", flag.ExitOnError)
+	out := flags.String("out", ".secrets/master.key", `file to write the key to, "-" for standard output`)
+	flags.Parse(args)
+
+	key, err := vault.GenerateKey()
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+	if *out == "-" {
+		fmt.Println(key)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*out), 0o700); err != nil {
+		log.Fatalf("Failed to create key directory: %v", err)
+	}
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		log.Fatalf("Failed to create key file: %v", err)
+	}
+	if _, err := fmt.Fprintln(file, key); err != nil {
+		file.Close()
+		log.Fatalf("Failed to write key file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Failed to write key file: %v", err)
+	}
+	log.Printf("Master key written to %s", *out)
+}
+
+// rotate re-encrypts every linked account under the new master key. The
+// current key (and any previous keys) are read from the usual configuration.
+func rotate(args []string) {
+	flags := flag.NewFlagSet("rotate", flag.ExitOnError)
+	newKeyFile := flags.String("new-key-file", "", "file holding the new base64 encoded master key")
+	newKeyVersion := flags.Int("new-key-version", 0, "version number of the new master key")
+	flags.Parse(args)
+
+	if *newKeyFile == "" || *newKeyVersion <= 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.NewDefaultConfig()
+
+	current, err := vault.NewFromConfig(cfg.Vault)
+	if err != nil {
+		log.Fatalf("Failed to load current master key: %v", err)
+	}
+
+	data, err := os.ReadFile(*newKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to read new master key: %v", err)
+	}
+	newKey, err := vault.DecodeKey(string(data))
+	if err != nil {
+		log.Fatalf("Invalid new master key: %v", err)
+	}
+	target, err := current.Rotate(newKey, *newKeyVersion)
+	if err != nil {
+		log.Fatalf("Failed to rotate master key: %v", err)
+	}
+
+	repo, err := repository.NewPostgresRepository(cfg.DBConn(), current)
+	if err != nil {
+		log.Fatalf("Failed to initialize repository: %v", err)
+	}
+
+	count, err := repo.ReencryptCredentials(context.Background(), target)
+	if err != nil {
+		log.Fatalf("Failed to re-encrypt credentials: %v", err)
+	}
+
+	log.Printf("Re-encrypted %d linked accounts under master key version %d", count, *newKeyVersion)
+	log.Printf("Set CREDENTIALS_KEY_VERSION=%d with the new key and keep the old key in CREDENTIALS_PREVIOUS_KEYS until every replica has restarted", *newKeyVersion)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/adapters/breaker"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/cache"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/notification"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/providers"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/queue"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/ratelimit"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/repository"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/vault"
+	"github.com/mel-ak/onetap-challenge/internal/config"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+	"github.com/mel-ak/onetap-challenge/internal/usecases"
+)
+
+// The worker consumes the Redis job queue filled by the API. Any number of
+// workers can run side by side; jobs of a crashed worker are delivered again
+// once their visibility timeout expires. Each worker also runs the refresh
+// scheduler, which only queues refreshes while it holds the leader lease.
+func main() {
+	cfg := config.NewDefaultConfig()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	credentialVault, err := vault.NewFromConfig(cfg.Vault)
+	if err != nil {
+		log.Fatalf("Failed to initialize credentials vault: %v", err)
+	}
+	dbRepo, err := repository.NewPostgresRepository(cfg.DBConn(), credentialVault)
+	if err != nil {
+		log.Fatalf("Failed to initialize repository: %v", err)
+	}
+	redisClient := cache.NewRedisClient(cfg.Redis.Host + ":" + cfg.Redis.Port)
+	jobQueue := queue.NewRedisQueue(redisClient, "jobs", cfg.Queue)
+
+	// Breaker notifications are queued like those of the API
+	providerRegistry := providers.NewRegistry(dbRepo, credentialVault)
+	providerRegistry.UseCertificateDir(cfg.ProviderTLS.CertDir)
+	providerRegistry.UseCircuitBreaker(breaker.NewRedisBreaker(redisClient, cfg.Breaker, notification.NewQueuedNotifier(jobQueue)))
+	providerRegistry.UseRateLimiter(ratelimit.NewRedisLimiter(redisClient, cfg.Quota))
+	if err := providerRegistry.Load(ctx); err != nil {
+		log.Printf("Warning: Failed to load providers: %v", err)
+	}
+	providerRegistry.Watch(ctx, time.Minute)
+
+	var notifier ports.NotificationService = notification.NewLogNotifier()
+	if cfg.Notify.SMTPHost != "" {
+		notifier = notification.NewEmailNotifier(
+			cfg.Notify.From,
+			cfg.Notify.AdminEmail,
+			cfg.Notify.SMTPHost,
+			cfg.Notify.SMTPPort,
+			cfg.Notify.SMTPUsername,
+			cfg.Notify.SMTPPassword,
+		)
+	}
+
+	billRefreshUsecase := usecases.NewBillRefreshUsecase(dbRepo, providerRegistry, redisClient, redisClient, jobQueue, redisClient, usecases.NewRetryPolicy(cfg.Retry))
+
+	worker := usecases.NewJobWorker(jobQueue, cfg.Queue.VisibilityTimeout/3)
+	worker.Handle(domain.JobTypeBillRefresh, billRefreshUsecase.ProcessJob)
+	worker.Handle(domain.JobTypeNotification, notification.Deliver(notifier))
+
+	scheduler := usecases.NewRefreshScheduler(dbRepo, billRefreshUsecase, redisClient, cfg.Scheduler)
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		scheduler.Run(ctx)
+	}()
+
+	sweeper := usecases.NewOverdueSweeper(dbRepo, cfg.Scheduler.OverdueInterval)
+	sweeperDone := make(chan struct{})
+	go func() {
+		defer close(sweeperDone)
+		sweeper.Run(ctx)
+	}()
+
+	log.Printf("Worker started with concurrency %d", cfg.Queue.WorkerConcurrency)
+	worker.Run(ctx, cfg.Queue.WorkerConcurrency)
+	<-schedulerDone
+	<-sweeperDone
+	log.Println("Worker stopped")
+}
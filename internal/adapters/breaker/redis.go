@@ -0,0 +1,180 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/adapters/cache"
+	"github.com/mel-ak/onetap-challenge/internal/config"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+	"github.com/redis/go-redis/v9"
+)
+
+// Transitions reported by recordScript
+const (
+	transitionOpened   = "open"
+	transitionReopened = "reopened"
+	transitionClosed   = "closed"
+)
+
+// allowScript decides whether a call may proceed. An open breaker turns half
+// open once its timeout has passed and then admits a limited number of
+// probes. Probes that never reported back are forgotten after another
+// timeout so a crashed caller cannot keep the breaker half open.
+//
+// KEYS: state
+// ARGV: now (ms), open timeout (ms), half-open probes
+var allowScript = redis.NewScript(`
+local state = redis.call('HGET', KEYS[1], 'state')
+if not state or state == 'closed' then
+	return 1
+end
+local now = tonumber(ARGV[1])
+local since = tonumber(redis.call('HGET', KEYS[1], 'since'))
+if state == 'open' then
+	if now < since + tonumber(ARGV[2]) then
+		return 0
+	end
+	redis.call('HSET', KEYS[1], 'state', 'half_open', 'since', now, 'probes', 0, 'successes', 0)
+elseif now >= since + tonumber(ARGV[2]) then
+	redis.call('HSET', KEYS[1], 'since', now, 'probes', 0, 'successes', 0)
+end
+if redis.call('HINCRBY', KEYS[1], 'probes', 1) > tonumber(ARGV[3]) then
+	return 0
+end
+return 1
+`)
+
+// recordScript counts the outcome of a call and moves the breaker between
+// states. It returns the new state when the call changed it, or "reopened"
+// when a half-open probe failed.
+//
+// KEYS: state, window
+// ARGV: now (ms), failed (0/1), slow (0/1), window (ms), min requests,
+// failure rate, slow call rate, half-open probes
+var recordScript = redis.NewScript(`
+local state = redis.call('HGET', KEYS[1], 'state') or 'closed'
+local failed = ARGV[2] == '1'
+local slow = ARGV[3] == '1'
+if state == 'open' then
+	return ''
+end
+if state == 'half_open' then
+	if failed or slow then
+		redis.call('HSET', KEYS[1], 'state', 'open', 'since', ARGV[1])
+		return 'reopened'
+	end
+	if redis.call('HINCRBY', KEYS[1], 'successes', 1) >= tonumber(ARGV[8]) then
+		redis.call('DEL', KEYS[1], KEYS[2])
+		return 'closed'
+	end
+	return ''
+end
+
+local total = redis.call('HINCRBY', KEYS[2], 'total', 1)
+if total == 1 then
+	redis.call('PEXPIRE', KEYS[2], ARGV[4])
+end
+local failures = redis.call('HINCRBY', KEYS[2], 'failures', failed and 1 or 0)
+local slows = redis.call('HINCRBY', KEYS[2], 'slow', slow and 1 or 0)
+if total >= tonumber(ARGV[5]) and (failures / total >= tonumber(ARGV[6]) or slows / total >= tonumber(ARGV[7])) then
+	redis.call('HSET', KEYS[1], 'state', 'open', 'since', ARGV[1])
+	redis.call('DEL', KEYS[2])
+	return 'open'
+end
+return ''
+`)
+
+// RedisBreaker is a CircuitBreaker per provider whose state lives in Redis,
+// so every replica fails fast as soon as one of them opens the breaker.
+// Administrators are notified when a breaker opens and when it closes again.
+type RedisBreaker struct {
+	client   *redis.Client
+	cfg      config.BreakerConfig
+	notifier ports.NotificationService
+}
+
+// NewRedisBreaker creates a breaker on the shared Redis client
+func NewRedisBreaker(redisClient *cache.RedisClient, cfg config.BreakerConfig, notifier ports.NotificationService) *RedisBreaker {
+	return &RedisBreaker{
+		client:   redisClient.Client(),
+		cfg:      cfg,
+		notifier: notifier,
+	}
+}
+
+// Allow returns domain.ErrCircuitOpen while the breaker of providerID is
+// open or its half-open probes are taken
+func (b *RedisBreaker) Allow(ctx context.Context, providerID string) error {
+	allowed, err := allowScript.Run(ctx, b.client, []string{stateKey(providerID)},
+		time.Now().UnixMilli(),
+		b.cfg.OpenTimeout.Milliseconds(),
+		b.cfg.HalfOpenProbes,
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to check circuit breaker of provider %s: %w", providerID, err)
+	}
+	if allowed == 0 {
+		return fmt.Errorf("%w for provider %s", domain.ErrCircuitOpen, providerID)
+	}
+	return nil
+}
+
+// Record counts a call to providerID and notifies administrators when it
+// opened or closed the breaker
+func (b *RedisBreaker) Record(ctx context.Context, providerID string, latency time.Duration, failed bool) error {
+	transition, err := recordScript.Run(ctx, b.client, []string{stateKey(providerID), windowKey(providerID)},
+		time.Now().UnixMilli(),
+		flag(failed),
+		flag(latency > b.cfg.SlowCallDuration),
+		b.cfg.Window.Milliseconds(),
+		b.cfg.MinRequests,
+		float64(b.cfg.FailureRatePercent)/100,
+		float64(b.cfg.SlowCallRatePercent)/100,
+		b.cfg.HalfOpenProbes,
+	).Text()
+	if err != nil {
+		return fmt.Errorf("failed to record call to provider %s: %w", providerID, err)
+	}
+
+	switch transition {
+	case transitionOpened:
+		log.Printf("Circuit breaker of provider %s opened", providerID)
+		b.notify(ctx, fmt.Sprintf("Circuit breaker of provider %s opened: calls fail fast for %s", providerID, b.cfg.OpenTimeout), "critical")
+	case transitionReopened:
+		log.Printf("Circuit breaker of provider %s reopened after a failed probe", providerID)
+	case transitionClosed:
+		log.Printf("Circuit breaker of provider %s closed", providerID)
+		b.notify(ctx, fmt.Sprintf("Circuit breaker of provider %s closed: the provider recovered", providerID), "info")
+	}
+	return nil
+}
+
+// notify sends an admin notification, logging failures since the breaker
+// state has already changed
+func (b *RedisBreaker) notify(ctx context.Context, message, severity string) {
+	if b.notifier == nil {
+		return
+	}
+	if err := b.notifier.NotifyAdmin(ctx, message, severity); err != nil {
+		log.Printf("Failed to send circuit breaker notification: %v", err)
+	}
+}
+
+func stateKey(providerID string) string {
+	return "breaker:" + providerID
+}
+
+func windowKey(providerID string) string {
+	return "breaker:" + providerID + ":window"
+}
+
+func flag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// refreshLockScript extends a lease only while the caller's token holds it
+var refreshLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLockScript deletes a lease only while the caller's token holds it
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// AcquireLock takes the lease on key for ttl. It returns an empty token when
+// the lease is held by someone else.
+func (r *RedisClient) AcquireLock(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	token := uuid.New().String()
+	ok, err := r.client.SetNX(ctx, "lock:"+key, token, ttl).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+// RefreshLock extends the lease on key to ttl if token still holds it
+func (r *RedisClient) RefreshLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	n, err := refreshLockScript.Run(ctx, r.client, []string{"lock:" + key}, token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseLock gives up the lease on key if token still holds it
+func (r *RedisClient) ReleaseLock(ctx context.Context, key, token string) error {
+	return releaseLockScript.Run(ctx, r.client, []string{"lock:" + key}, token).Err()
+}
@@ -3,7 +3,6 @@ package cache
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"time"
 
 	"github.com/mel-ak/onetap-challenge/internal/domain"
@@ -36,7 +35,7 @@ func (r *RedisClient) RateLimit(ctx context.Context, key string, limit int, wind
 		r.client.Expire(ctx, key, time.Duration(window)*time.Second)
 	}
 	if count > int64(limit) {
-		return fmt.Errorf("rate limit exceeded")
+		return domain.ErrRateLimited
 	}
 	return nil
 }
@@ -60,6 +59,31 @@ func (r *RedisClient) CacheBills(ctx context.Context, key string, bills []*domai
 	return r.client.SetEx(ctx, key, data, time.Duration(ttl)*time.Second).Err()
 }
 
+// refreshJobTTL is how long finished refresh jobs can be queried
+const refreshJobTTL = 24 * time.Hour
+
+// SaveRefreshJob stores the state of a refresh job
+func (r *RedisClient) SaveRefreshJob(ctx context.Context, job *domain.RefreshJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, "refresh_job:"+job.ID, data, refreshJobTTL).Err()
+}
+
+// GetRefreshJob loads a refresh job, returning nil when it does not exist
+func (r *RedisClient) GetRefreshJob(ctx context.Context, id string) (*domain.RefreshJob, error) {
+	data, err := r.client.Get(ctx, "refresh_job:"+id).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job domain.RefreshJob
+	return &job, json.Unmarshal(data, &job)
+}
+
 func (c *RedisClient) Get(ctx context.Context, key string) (string, error) {
 	return c.client.Get(ctx, key).Result()
 }
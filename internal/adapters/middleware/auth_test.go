@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mel-ak/onetap-challenge/internal/adapters/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminTokenMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(token, presented string) int {
+		req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+		if presented != "" {
+			req.Header.Set("X-Admin-Token", presented)
+		}
+		rec := httptest.NewRecorder()
+		AdminTokenMiddleware(token)(ok).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("secret", "secret"))
+	assert.Equal(t, http.StatusForbidden, serve("secret", "wrong"))
+	assert.Equal(t, http.StatusForbidden, serve("secret", ""))
+	// Without a configured token nobody gets through
+	assert.Equal(t, http.StatusForbidden, serve("", ""))
+}
+
+func TestAdminRoutesRejectUserTokens(t *testing.T) {
+	jwtService := auth.NewJWTService("test-secret")
+	userToken, err := jwtService.GenerateToken("user-1")
+	require.NoError(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	// Admin routes such as PUT /providers/{provider_id} sit behind both
+	handler := AuthMiddleware(jwtService)(AdminTokenMiddleware("secret")(ok))
+	serve := func(adminToken string) int {
+		req := httptest.NewRequest(http.MethodPut, "/providers/mock-provider", nil)
+		req.Header.Set("Authorization", "Bearer "+userToken)
+		if adminToken != "" {
+			req.Header.Set("X-Admin-Token", adminToken)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(""))
+	assert.Equal(t, http.StatusForbidden, serve("wrong"))
+	assert.Equal(t, http.StatusOK, serve("secret"))
+}
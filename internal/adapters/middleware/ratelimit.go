@@ -1,36 +1,181 @@
 package middleware
 
 import (
+	"fmt"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/gorilla/mux"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
 )
 
-func RateLimitMiddleware(redisClient *redis.Client, limit int, window time.Duration) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			key := "rate_limit:" + r.RemoteAddr
+// RateLimitPolicy limits how many requests a client makes to a route within
+// a sliding window. A limit of 0 or less disables it.
+type RateLimitPolicy struct {
+	// Name separates the counts of routes with different policies
+	Name   string
+	Limit  int
+	Window time.Duration
+}
 
-			// Get current count
-			count, err := redisClient.Incr(r.Context(), key).Result()
-			if err != nil {
-				http.Error(w, "Rate limit error", http.StatusInternalServerError)
-				return
-			}
+// RateLimiter limits requests per authenticated user, or per client IP for
+// requests made before login. Each route counts against the default policy
+// unless it was given its own.
+type RateLimiter struct {
+	limiter  ports.RequestRateLimiter
+	fallback RateLimitPolicy
+	routes   map[string]RateLimitPolicy
+	proxies  []*net.IPNet
+}
 
-			// Set expiry on first request
-			if count == 1 {
-				redisClient.Expire(r.Context(), key, window)
-			}
+// NewRateLimiter creates a rate limiter applying fallback to every route.
+// trustedProxies lists comma separated IPs or CIDRs of the proxies whose
+// X-Forwarded-For header is trusted to tell the client IP.
+func NewRateLimiter(limiter ports.RequestRateLimiter, fallback RateLimitPolicy, trustedProxies string) (*RateLimiter, error) {
+	proxies, err := parseProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimiter{
+		limiter:  limiter,
+		fallback: fallback,
+		routes:   make(map[string]RateLimitPolicy),
+		proxies:  proxies,
+	}, nil
+}
 
-			// Check if limit exceeded
-			if count > int64(limit) {
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-				return
-			}
+// Limit applies policy instead of the default one to the route registered
+// with pathTemplate, whatever its method
+func (l *RateLimiter) Limit(pathTemplate string, policy RateLimitPolicy) {
+	l.routes[pathTemplate] = policy
+}
 
+// Middleware counts each request against the policy of its route. It sets
+// the RateLimit-* headers and rejects requests over the limit with 429 and
+// Retry-After. Requests proceed when the counts cannot be reached.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := l.policy(r)
+		if policy.Limit <= 0 {
 			next.ServeHTTP(w, r)
-		})
+			return
+		}
+
+		key := fmt.Sprintf("api:%s:%s", policy.Name, l.clientKey(r))
+		result, err := l.limiter.Allow(r.Context(), key, policy.Limit, policy.Window)
+		if err != nil {
+			log.Printf("Serving request without rate limit: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reset := seconds(result.Reset)
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, seconds(policy.Window)))
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(reset))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// policy returns the policy of the route r matched
+func (l *RateLimiter) policy(r *http.Request) RateLimitPolicy {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			if policy, ok := l.routes[template]; ok {
+				return policy
+			}
+		}
+	}
+	return l.fallback
+}
+
+// clientKey identifies who made r: the user set by AuthMiddleware, or the
+// client IP
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if userID, ok := r.Context().Value("user_id").(string); ok && userID != "" {
+		return "user:" + userID
 	}
+	return "ip:" + l.clientIP(r)
+}
+
+// clientIP returns the IP r came from. When the request came through trusted
+// proxies, it is the last address in X-Forwarded-For that is not one of them,
+// since earlier entries can be forged by the client.
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !l.trusted(ip) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !l.trusted(hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// trusted reports whether ip belongs to a trusted proxy
+func (l *RateLimiter) trusted(ip net.IP) bool {
+	for _, network := range l.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxies parses a comma separated list of IPs and CIDRs
+func parseProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %q", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// seconds rounds d up to whole seconds for headers
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
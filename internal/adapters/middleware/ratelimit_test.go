@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingLimiter is an in-memory RequestRateLimiter with fixed windows
+type countingLimiter struct {
+	counts map[string]int
+}
+
+func (l *countingLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (domain.RateLimitResult, error) {
+	if l.counts[key] >= limit {
+		return domain.RateLimitResult{Reset: 1500 * time.Millisecond}, nil
+	}
+	l.counts[key]++
+	return domain.RateLimitResult{Allowed: true, Remaining: limit - l.counts[key], Reset: window}, nil
+}
+
+func newLimitedRouter(t *testing.T, limiter *countingLimiter) *mux.Router {
+	rateLimiter, err := NewRateLimiter(limiter, RateLimitPolicy{Name: "default", Limit: 3, Window: time.Minute}, "10.0.0.0/8, 192.168.1.1")
+	assert.NoError(t, err)
+	rateLimiter.Limit("/login", RateLimitPolicy{Name: "login", Limit: 1, Window: time.Minute})
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router := mux.NewRouter()
+	router.Handle("/login", rateLimiter.Middleware(http.HandlerFunc(ok))).Methods(http.MethodPost)
+	router.Handle("/bills/{id}", rateLimiter.Middleware(http.HandlerFunc(ok))).Methods(http.MethodGet)
+	return router
+}
+
+func TestRateLimiterAppliesRoutePolicies(t *testing.T) {
+	limiter := &countingLimiter{counts: make(map[string]int)}
+	router := newLimitedRouter(t, limiter)
+
+	login := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = "203.0.113.7:51234"
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := login()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", rec.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "1;w=60", rec.Header().Get("RateLimit-Policy"))
+
+	rec = login()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// Other routes count against the default policy, per user once logged in
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/bills/1", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	router.ServeHTTP(rec, req.WithContext(context.WithValue(req.Context(), "user_id", "user1")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, map[string]int{"api:login:ip:203.0.113.7": 1, "api:default:user:user1": 1}, limiter.counts)
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	rateLimiter, err := NewRateLimiter(nil, RateLimitPolicy{}, "10.0.0.0/8, 192.168.1.1")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"untrusted proxy", "203.0.113.7:51234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:443", []string{"1.2.3.4, 198.51.100.1, 192.168.1.1"}, "198.51.100.1"},
+		{"several headers", "10.1.2.3:443", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"only proxies", "10.1.2.3:443", []string{"10.9.9.9"}, "10.9.9.9"},
+		{"garbage", "10.1.2.3:443", []string{"not-an-ip"}, "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, tt.want, rateLimiter.clientIP(req))
+		})
+	}
+
+	_, err = NewRateLimiter(nil, RateLimitPolicy{}, "10.0.0.0/33")
+	assert.Error(t, err)
+}
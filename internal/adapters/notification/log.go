@@ -0,0 +1,23 @@
+package notification
+
+import (
+	"context"
+	"log"
+)
+
+// LogNotifier writes notifications to the log, for environments without SMTP
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) NotifyAdmin(ctx context.Context, message string, severity string) error {
+	log.Printf("[%s] Admin notification: %s", severity, message)
+	return nil
+}
+
+func (n *LogNotifier) NotifyError(ctx context.Context, err error, context string) error {
+	log.Printf("[ERROR] %s: %v", context, err)
+	return nil
+}
@@ -0,0 +1,64 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// notificationPayload is the queue payload of a notification job
+type notificationPayload struct {
+	Kind     string `json:"kind"` // "admin" or "error"
+	Message  string `json:"message"`
+	Severity string `json:"severity,omitempty"`
+	Context  string `json:"context,omitempty"`
+}
+
+// QueuedNotifier implements NotificationService by queueing notifications so
+// they are delivered by a worker and retried when delivery fails
+type QueuedNotifier struct {
+	queue ports.JobQueue
+}
+
+func NewQueuedNotifier(queue ports.JobQueue) *QueuedNotifier {
+	return &QueuedNotifier{queue: queue}
+}
+
+func (n *QueuedNotifier) NotifyAdmin(ctx context.Context, message string, severity string) error {
+	return n.enqueue(ctx, notificationPayload{Kind: "admin", Message: message, Severity: severity})
+}
+
+func (n *QueuedNotifier) NotifyError(ctx context.Context, err error, context string) error {
+	return n.enqueue(ctx, notificationPayload{Kind: "error", Message: err.Error(), Context: context})
+}
+
+func (n *QueuedNotifier) enqueue(ctx context.Context, payload notificationPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return n.queue.Enqueue(ctx, &domain.Job{Type: domain.JobTypeNotification, Payload: data})
+}
+
+// Deliver returns the job handler sending queued notifications through notifier
+func Deliver(notifier ports.NotificationService) func(ctx context.Context, payload json.RawMessage) error {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p notificationPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return fmt.Errorf("invalid notification payload: %w", err)
+		}
+
+		switch p.Kind {
+		case "admin":
+			return notifier.NotifyAdmin(ctx, p.Message, p.Severity)
+		case "error":
+			return notifier.NotifyError(ctx, errors.New(p.Message), p.Context)
+		default:
+			return fmt.Errorf("unknown notification kind %q", p.Kind)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+)
+
+// Authenticator applies a provider auth type to outbound requests
+type Authenticator interface {
+	// Apply adds the credentials of a linked account to req
+	Apply(req *http.Request, credentials domain.Credentials) error
+}
+
+// transportAuthenticator is implemented by strategies that authenticate at the
+// TLS layer and therefore need a dedicated HTTP transport
+type transportAuthenticator interface {
+	TLSConfig() *tls.Config
+}
+
+// errClientCertificate is returned for any mutual TLS file that cannot be
+// used, without telling whether it exists
+var errClientCertificate = errors.New("mtls client certificate, key or CA file is missing or invalid")
+
+// NewAuthenticator selects the auth strategy for provider.AuthType. The files
+// of mutual TLS providers are read from certDir.
+func NewAuthenticator(provider *domain.Provider, certDir string) (Authenticator, error) {
+	cfg := provider.AuthConfig
+
+	switch provider.AuthType {
+	case "none":
+		return noAuth{}, nil
+	case "api_key":
+		return apiKeyAuth{header: withDefault(cfg.HeaderName, "X-API-Key")}, nil
+	case "basic":
+		return basicAuth{}, nil
+	case "bearer":
+		return bearerAuth{token: cfg.BearerToken}, nil
+	case "hmac":
+		newHash, err := hmacHash(cfg.SigningAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		return hmacAuth{
+			newHash:         newHash,
+			keyHeader:       withDefault(cfg.HeaderName, "X-API-Key"),
+			signatureHeader: withDefault(cfg.SignatureHeader, "X-Signature"),
+			timestampHeader: withDefault(cfg.TimestampHeader, "X-Timestamp"),
+		}, nil
+	case "mtls":
+		tlsConfig, err := loadClientTLS(cfg, certDir)
+		if err != nil {
+			return nil, err
+		}
+		return mtlsAuth{tlsConfig: tlsConfig}, nil
+	case "oauth2":
+		if err := validateOAuth2Config(cfg); err != nil {
+			return nil, err
+		}
+		return oauth2Auth{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported auth type %q", provider.AuthType)
+	}
+}
+
+// noAuth sends requests without credentials
+type noAuth struct{}
+
+func (noAuth) Apply(req *http.Request, credentials domain.Credentials) error {
+	return nil
+}
+
+// apiKeyAuth sends the account API key in a header
+type apiKeyAuth struct {
+	header string
+}
+
+func (a apiKeyAuth) Apply(req *http.Request, credentials domain.Credentials) error {
+	key := firstOf(credentials, "api_key", "token")
+	if key == "" {
+		return fmt.Errorf("missing api_key credential: %w", domain.ErrInvalidCredentials)
+	}
+	req.Header.Set(a.header, key)
+	return nil
+}
+
+// basicAuth sends the account username and password with HTTP basic auth
+type basicAuth struct{}
+
+func (basicAuth) Apply(req *http.Request, credentials domain.Credentials) error {
+	if credentials["username"] == "" {
+		return fmt.Errorf("missing username credential: %w", domain.ErrInvalidCredentials)
+	}
+	req.SetBasicAuth(credentials["username"], credentials["password"])
+	return nil
+}
+
+// bearerAuth sends a static bearer token, either configured for the provider
+// or stored with the account
+type bearerAuth struct {
+	token string
+}
+
+func (a bearerAuth) Apply(req *http.Request, credentials domain.Credentials) error {
+	token := firstOf(credentials, "token", "access_token")
+	if token == "" {
+		token = a.token
+	}
+	if token == "" {
+		return fmt.Errorf("missing bearer token: %w", domain.ErrInvalidCredentials)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// hmacAuth signs every request with the account API secret. The signature is
+// the hex HMAC of "METHOD\nPATH?QUERY\nTIMESTAMP\nhex(SHA-256(body))".
+type hmacAuth struct {
+	newHash         func() hash.Hash
+	keyHeader       string
+	signatureHeader string
+	timestampHeader string
+}
+
+func (a hmacAuth) Apply(req *http.Request, credentials domain.Credentials) error {
+	key, secret := credentials["api_key"], credentials["api_secret"]
+	if key == "" || secret == "" {
+		return fmt.Errorf("missing api_key or api_secret credential: %w", domain.ErrInvalidCredentials)
+	}
+
+	body := []byte{}
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("failed to read request body for signing: %w", err)
+		}
+		defer reader.Close()
+		if body, err = io.ReadAll(reader); err != nil {
+			return fmt.Errorf("failed to read request body for signing: %w", err)
+		}
+	}
+	bodyHash := sha256.Sum256(body)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(a.newHash, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", req.Method, req.URL.RequestURI(), timestamp, hex.EncodeToString(bodyHash[:]))
+
+	req.Header.Set(a.keyHeader, key)
+	req.Header.Set(a.timestampHeader, timestamp)
+	req.Header.Set(a.signatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// mtlsAuth authenticates with a client certificate configured for the provider
+type mtlsAuth struct {
+	tlsConfig *tls.Config
+}
+
+func (mtlsAuth) Apply(req *http.Request, credentials domain.Credentials) error {
+	return nil
+}
+
+func (a mtlsAuth) TLSConfig() *tls.Config {
+	return a.tlsConfig
+}
+
+// oauth2Auth sends the account OAuth2 access token. Refreshing expired tokens
+// is handled by the adapter because it needs to persist the new tokens.
+type oauth2Auth struct{}
+
+func (oauth2Auth) Apply(req *http.Request, credentials domain.Credentials) error {
+	if credentials["access_token"] == "" {
+		return fmt.Errorf("missing access_token credential: %w", domain.ErrInvalidCredentials)
+	}
+	req.Header.Set("Authorization", "Bearer "+credentials["access_token"])
+	return nil
+}
+
+// hmacHash returns the hash constructor for a signing algorithm
+func hmacHash(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case "", "hmac-sha256":
+		return sha256.New, nil
+	case "hmac-sha512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
+
+// loadClientTLS builds the TLS config for mutual TLS from the configured
+// files, which are names inside certDir. Failures are logged and reported as
+// errClientCertificate so that API callers cannot probe the file system.
+func loadClientTLS(cfg domain.ProviderAuthConfig, certDir string) (*tls.Config, error) {
+	if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+		return nil, errors.New("mtls providers require client_cert_file and client_key_file")
+	}
+
+	certPEM, err := readCertFile(certDir, cfg.ClientCertFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := readCertFile(certDir, cfg.ClientKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		log.Printf("Invalid mtls client certificate %s: %v", cfg.ClientCertFile, err)
+		return nil, errClientCertificate
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := readCertFile(certDir, cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Printf("No certificates found in mtls CA file %s", cfg.CAFile)
+			return nil, errClientCertificate
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// readCertFile reads the file name inside certDir. Names that are absolute,
+// climb out of certDir or resolve outside it through a symlink are refused.
+func readCertFile(certDir, name string) ([]byte, error) {
+	if certDir == "" || !filepath.IsLocal(name) {
+		log.Printf("Refusing mtls file %q outside the certificate directory", name)
+		return nil, errClientCertificate
+	}
+	root, err := filepath.EvalSymlinks(certDir)
+	if err != nil {
+		log.Printf("Failed to open mtls certificate directory %s: %v", certDir, err)
+		return nil, errClientCertificate
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		log.Printf("Failed to open mtls file %s: %v", name, err)
+		return nil, errClientCertificate
+	}
+	if rel, err := filepath.Rel(root, path); err != nil || !filepath.IsLocal(rel) {
+		log.Printf("Refusing mtls file %q outside the certificate directory", name)
+		return nil, errClientCertificate
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read mtls file %s: %v", name, err)
+		return nil, errClientCertificate
+	}
+	return data, nil
+}
+
+// firstOf returns the first non-empty credential among keys
+func firstOf(credentials domain.Credentials, keys ...string) string {
+	for _, key := range keys {
+		if value := credentials[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func withDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,139 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticatorsApplyCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		provider    domain.Provider
+		credentials domain.Credentials
+		header      string
+		want        string
+	}{
+		{"api key default header", domain.Provider{AuthType: "api_key"}, domain.Credentials{"api_key": "k1"}, "X-API-Key", "k1"},
+		{"api key custom header", domain.Provider{AuthType: "api_key", AuthConfig: domain.ProviderAuthConfig{HeaderName: "Api-Token"}}, domain.Credentials{"token": "k2"}, "Api-Token", "k2"},
+		{"basic", domain.Provider{AuthType: "basic"}, domain.Credentials{"username": "jane", "password": "secret"}, "Authorization", "Basic amFuZTpzZWNyZXQ="},
+		{"bearer from account", domain.Provider{AuthType: "bearer", AuthConfig: domain.ProviderAuthConfig{BearerToken: "shared"}}, domain.Credentials{"token": "own"}, "Authorization", "Bearer own"},
+		{"bearer from provider", domain.Provider{AuthType: "bearer", AuthConfig: domain.ProviderAuthConfig{BearerToken: "shared"}}, domain.Credentials{}, "Authorization", "Bearer shared"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := NewAuthenticator(&tt.provider, "")
+			assert.NoError(t, err)
+
+			req, _ := http.NewRequest("GET", "http://provider.test/bills", nil)
+			assert.NoError(t, auth.Apply(req, tt.credentials))
+			assert.Equal(t, tt.want, req.Header.Get(tt.header))
+		})
+	}
+}
+
+func TestHMACAuthSignsRequest(t *testing.T) {
+	auth, err := NewAuthenticator(&domain.Provider{AuthType: "hmac", AuthConfig: domain.ProviderAuthConfig{SignatureHeader: "X-Sig"}}, "")
+	assert.NoError(t, err)
+
+	body := `{"credentials":{}}`
+	req, _ := http.NewRequest("POST", "http://provider.test/accounts/validate?x=1", strings.NewReader(body))
+	assert.NoError(t, auth.Apply(req, domain.Credentials{"api_key": "key", "api_secret": "secret"}))
+
+	bodyHash := sha256.Sum256([]byte(body))
+	mac := hmac.New(sha256.New, []byte("secret"))
+	fmt.Fprintf(mac, "POST\n/accounts/validate?x=1\n%s\n%s", req.Header.Get("X-Timestamp"), hex.EncodeToString(bodyHash[:]))
+
+	assert.Equal(t, "key", req.Header.Get("X-API-Key"))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), req.Header.Get("X-Sig"))
+
+	// Signing needs the account secret
+	err = auth.Apply(req, domain.Credentials{"api_key": "key"})
+	assert.True(t, errors.Is(err, domain.ErrInvalidCredentials))
+}
+
+func TestNewAuthenticatorRejectsInvalidConfig(t *testing.T) {
+	for _, provider := range []domain.Provider{
+		{AuthType: "digest"},
+		{AuthType: "hmac", AuthConfig: domain.ProviderAuthConfig{SigningAlgorithm: "md5"}},
+		{AuthType: "mtls"},
+		{AuthType: "mtls", AuthConfig: domain.ProviderAuthConfig{ClientCertFile: "missing.crt", ClientKeyFile: "missing.key"}},
+		{AuthType: "oauth2"},
+	} {
+		_, err := NewAuthenticator(&provider, t.TempDir())
+		assert.Error(t, err, provider.AuthType)
+	}
+}
+
+// writeClientCertificate writes a self-signed certificate and its key to dir
+func writeClientCertificate(t *testing.T, dir string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "client.crt"), certPEM, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), certPEM, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "client.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func TestMTLSFilesMustBeInCertificateDir(t *testing.T) {
+	outside := t.TempDir()
+	writeClientCertificate(t, outside)
+	certDir := t.TempDir()
+	writeClientCertificate(t, certDir)
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "client.key"), filepath.Join(certDir, "linked.key")))
+
+	mtls := func(cert, key, ca string) *domain.Provider {
+		return &domain.Provider{AuthType: "mtls", AuthConfig: domain.ProviderAuthConfig{ClientCertFile: cert, ClientKeyFile: key, CAFile: ca}}
+	}
+
+	auth, err := NewAuthenticator(mtls("client.crt", "client.key", "ca.crt"), certDir)
+	assert.NoError(t, err)
+	assert.NotNil(t, auth.(transportAuthenticator).TLSConfig().RootCAs)
+
+	for _, provider := range []*domain.Provider{
+		mtls(filepath.Join(outside, "client.crt"), filepath.Join(outside, "client.key"), ""),
+		mtls("../"+filepath.Base(outside)+"/client.crt", "client.key", ""),
+		mtls("client.crt", "linked.key", ""),
+		mtls("client.crt", "client.key", "/etc/hostname"),
+		mtls("missing.crt", "client.key", ""),
+		mtls("client.key", "client.key", ""),
+	} {
+		_, err := NewAuthenticator(provider, certDir)
+		// Callers cannot tell missing files from refused ones
+		assert.ErrorIs(t, err, errClientCertificate, provider.AuthConfig)
+	}
+
+	// Without a certificate directory no files are read
+	_, err = NewAuthenticator(mtls("client.crt", "client.key", ""), "")
+	assert.ErrorIs(t, err, errClientCertificate)
+}
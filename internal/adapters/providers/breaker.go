@@ -0,0 +1,87 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// guardedAdapter wraps an adapter so calls to the provider go through its
+// circuit breaker and stay within its quota. Calls fail fast with
+// domain.ErrCircuitOpen while the breaker is open and wait for the rate
+// limiter otherwise; when either is unreachable calls proceed.
+type guardedAdapter struct {
+	ports.ProviderAdapter
+	provider *domain.Provider
+	breaker  ports.CircuitBreaker      // Optional
+	limiter  ports.ProviderRateLimiter // Optional
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped adapter
+func (a *guardedAdapter) CloseIdleConnections() {
+	closeIdleConnections(a.ProviderAdapter)
+}
+
+func (a *guardedAdapter) FetchBills(ctx context.Context, account domain.LinkedAccount, credentials domain.Credentials) ([]*domain.Bill, error) {
+	if err := a.allow(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	bills, err := a.ProviderAdapter.FetchBills(ctx, account, credentials)
+	a.record(ctx, time.Since(start), err)
+	return bills, err
+}
+
+func (a *guardedAdapter) ValidateCredentials(ctx context.Context, credentials domain.Credentials) ([]string, error) {
+	if err := a.allow(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	accounts, err := a.ProviderAdapter.ValidateCredentials(ctx, credentials)
+	a.record(ctx, time.Since(start), err)
+	return accounts, err
+}
+
+// allow returns domain.ErrCircuitOpen when the call must fail fast, and
+// otherwise waits for the provider's quota. Calls the quota does not admit
+// in time fail with domain.ErrRateLimited.
+func (a *guardedAdapter) allow(ctx context.Context) error {
+	if a.breaker != nil {
+		err := a.breaker.Allow(ctx, a.provider.ID)
+		if errors.Is(err, domain.ErrCircuitOpen) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Calling provider %s without circuit breaker: %v", a.provider.ID, err)
+		}
+	}
+
+	if a.limiter != nil {
+		err := a.limiter.Wait(ctx, a.provider)
+		if err != nil && (errors.Is(err, domain.ErrRateLimited) || ctx.Err() != nil) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Calling provider %s without rate limit: %v", a.provider.ID, err)
+		}
+	}
+	return nil
+}
+
+// record reports the call to the breaker. Only transient failures count
+// against the provider: rejected credentials, other 4xx responses and calls
+// cancelled by the caller are problems of one account or caller and say
+// nothing about the provider's health.
+func (a *guardedAdapter) record(ctx context.Context, latency time.Duration, err error) {
+	if a.breaker == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	failed := domain.Retryable(err)
+	if err := a.breaker.Record(context.WithoutCancel(ctx), a.provider.ID, latency, failed); err != nil {
+		log.Printf("Failed to record call to provider %s: %v", a.provider.ID, err)
+	}
+}
@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubBreaker is an in-memory CircuitBreaker recording the calls it sees
+type stubBreaker struct {
+	open     bool
+	recorded []bool
+}
+
+func (b *stubBreaker) Allow(ctx context.Context, providerID string) error {
+	if b.open {
+		return fmt.Errorf("%w for provider %s", domain.ErrCircuitOpen, providerID)
+	}
+	return nil
+}
+
+func (b *stubBreaker) Record(ctx context.Context, providerID string, latency time.Duration, failed bool) error {
+	b.recorded = append(b.recorded, failed)
+	return nil
+}
+
+func TestRegistryGuardsAdaptersWithCircuitBreaker(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	breaker := &stubBreaker{}
+	registry := NewRegistry(nil, nil)
+	registry.UseCircuitBreaker(breaker)
+	assert.NoError(t, registry.Register(&domain.Provider{ID: "p1", APIEndpoint: srv.URL, AuthType: "none"}))
+
+	adapter, err := registry.Get(context.Background(), "p1")
+	assert.NoError(t, err)
+
+	_, err = adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.NoError(t, err)
+
+	status = http.StatusBadGateway
+	_, err = adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.Error(t, err)
+	assert.Equal(t, []bool{false, true}, breaker.recorded)
+
+	// Requests the provider refuses for one account do not count against it,
+	// throttling does
+	status = http.StatusNotFound
+	_, err = adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.Error(t, err)
+	status = http.StatusTooManyRequests
+	_, err = adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.Error(t, err)
+	assert.Equal(t, []bool{false, true, false, true}, breaker.recorded)
+
+	// An open breaker fails fast without calling the provider
+	breaker.open = true
+	_, err = adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.True(t, errors.Is(err, domain.ErrCircuitOpen))
+	assert.Equal(t, 4, calls)
+	assert.Len(t, breaker.recorded, 4)
+}
+
+// stubLimiter is an in-memory ProviderRateLimiter admitting a fixed number of calls
+type stubLimiter struct {
+	remaining int
+	providers []*domain.Provider
+}
+
+func (l *stubLimiter) Wait(ctx context.Context, provider *domain.Provider) error {
+	l.providers = append(l.providers, provider)
+	if l.remaining == 0 {
+		return fmt.Errorf("%w for provider %s", domain.ErrRateLimited, provider.ID)
+	}
+	l.remaining--
+	return nil
+}
+
+func TestRegistryKeepsAdaptersWithinProviderQuota(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	breaker := &stubBreaker{}
+	limiter := &stubLimiter{remaining: 1}
+	registry := NewRegistry(nil, nil)
+	registry.UseCircuitBreaker(breaker)
+	registry.UseRateLimiter(limiter)
+	assert.NoError(t, registry.Register(&domain.Provider{ID: "p1", APIEndpoint: srv.URL, AuthType: "none", RateLimitPerMinute: 1}))
+
+	adapter, err := registry.Get(context.Background(), "p1")
+	assert.NoError(t, err)
+
+	_, err = adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.NoError(t, err)
+
+	// A call over quota is refused without reaching the provider or counting
+	// against its breaker
+	_, err = adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.True(t, errors.Is(err, domain.ErrRateLimited))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []bool{false}, breaker.recorded)
+
+	assert.Len(t, limiter.providers, 2)
+	assert.Equal(t, 1, limiter.providers[0].RateLimitPerMinute)
+}
@@ -0,0 +1,310 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// HTTPAdapter talks to providers exposing the REST bill API served by the mock server
+type HTTPAdapter struct {
+	baseURL    string
+	info       *domain.Provider
+	auth       Authenticator
+	store      ports.ProviderRepository
+	httpClient *http.Client
+
+	// tokens caches refreshed OAuth2 credentials per linked account so that
+	// callers holding stale credentials do not redeem a refresh token twice
+	tokens *TokenCache
+}
+
+// idleConnTimeout closes idle connections of mutual TLS transports, which
+// are not shared between adapters
+const idleConnTimeout = 90 * time.Second
+
+// NewHTTPAdapter creates an adapter for a registered provider using the auth
+// strategy of its auth type. Refreshed OAuth2 tokens are kept in tokens, a
+// new cache when nil, and persisted through store. Mutual TLS files are read
+// from certDir.
+func NewHTTPAdapter(provider *domain.Provider, store ports.ProviderRepository, tokens *TokenCache, certDir string) (*HTTPAdapter, error) {
+	if err := validateEndpoint(provider); err != nil {
+		return nil, err
+	}
+	auth, err := NewAuthenticator(provider, certDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth config for provider %s: %w", provider.ID, err)
+	}
+
+	if tokens == nil {
+		tokens = NewTokenCache()
+	}
+
+	httpClient := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	if transport, ok := auth.(transportAuthenticator); ok {
+		httpClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: transport.TLSConfig(),
+			IdleConnTimeout: idleConnTimeout,
+		}
+	}
+
+	return &HTTPAdapter{
+		baseURL:    strings.TrimRight(provider.APIEndpoint, "/"),
+		info:       provider,
+		auth:       auth,
+		store:      store,
+		httpClient: httpClient,
+		tokens:     tokens,
+	}, nil
+}
+
+// CloseIdleConnections closes the idle connections of the adapter's client.
+// The registry calls it on adapters it replaced.
+func (a *HTTPAdapter) CloseIdleConnections() {
+	a.httpClient.CloseIdleConnections()
+}
+
+func (a *HTTPAdapter) FetchBills(ctx context.Context, account domain.LinkedAccount, credentials domain.Credentials) ([]*domain.Bill, error) {
+	if a.info.AuthType == "oauth2" {
+		var err error
+		if credentials, err = a.freshCredentials(ctx, account, credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	query := url.Values{}
+	query.Set("account_id", account.AccountID)
+	url := fmt.Sprintf("%s/bills?%s", a.baseURL, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := a.auth.Apply(req, credentials); err != nil {
+		return nil, err
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch bills: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return nil, err
+	}
+
+	var mockBills []struct {
+		ID          string      `json:"id"`
+		Provider    string      `json:"provider"`
+		Amount      json.Number `json:"amount"`
+		Currency    string      `json:"currency"`
+		DueDate     time.Time   `json:"due_date"`
+		Status      string      `json:"status"`
+		Description string      `json:"description"`
+		LineItems   []lineItem  `json:"line_items"`
+		Usage       []usage     `json:"usage"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&mockBills); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	bills := make([]*domain.Bill, len(mockBills))
+	for i, mockBill := range mockBills {
+		status, err := domain.ParseBillStatus(mockBill.Status)
+		if err != nil {
+			// Statuses outside the lifecycle count as unpaid, as stored bills
+			// were mapped when it was introduced
+			log.Printf("Treating bill %s from provider %s as unpaid: %v", mockBill.ID, a.info.ID, err)
+			status = domain.BillUnpaid
+		}
+		amount, rounded, err := domain.ParseMoneyRounded(mockBill.Amount.String(), mockBill.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bill %s from provider %s: %w", mockBill.ID, a.info.ID, err)
+		}
+		if rounded {
+			log.Printf("Rounded amount %s of bill %s from provider %s to %s", mockBill.Amount, mockBill.ID, a.info.ID, amount)
+		}
+		bills[i] = &domain.Bill{
+			ExternalID:      mockBill.ID,
+			LinkedAccountID: account.ID,
+			ProviderID:      account.ProviderID,
+			Amount:          amount,
+			DueDate:         mockBill.DueDate,
+			Status:          status,
+			BillDate:        time.Now(),
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+		}
+		if err := mapBillDetails(bills[i], mockBill.LineItems, mockBill.Usage); err != nil {
+			return nil, fmt.Errorf("invalid bill %s from provider %s: %w", mockBill.ID, a.info.ID, err)
+		}
+	}
+
+	return bills, nil
+}
+
+// lineItem is a charge of a bill as sent by providers. Its amount is in the
+// currency of the bill.
+type lineItem struct {
+	Description string      `json:"description"`
+	Category    string      `json:"category"`
+	Amount      json.Number `json:"amount"`
+}
+
+// usage is a usage reading of a bill as sent by providers
+type usage struct {
+	Quantity    json.Number `json:"quantity"`
+	Unit        string      `json:"unit"`
+	PeriodStart *time.Time  `json:"period_start"`
+	PeriodEnd   *time.Time  `json:"period_end"`
+	MeterID     string      `json:"meter_id"`
+}
+
+// mapBillDetails sets the line items and usage of bill from those sent by
+// the provider
+func mapBillDetails(bill *domain.Bill, items []lineItem, readings []usage) error {
+	for _, item := range items {
+		amount, rounded, err := domain.ParseMoneyRounded(item.Amount.String(), bill.Amount.Currency)
+		if err != nil {
+			return fmt.Errorf("line item %q: %w", item.Description, err)
+		}
+		if rounded {
+			log.Printf("Rounded amount %s of line item %q of bill %s to %s", item.Amount, item.Description, bill.ExternalID, amount)
+		}
+		bill.LineItems = append(bill.LineItems, domain.BillLineItem{
+			Description: strings.TrimSpace(item.Description),
+			Category:    strings.ToLower(strings.TrimSpace(item.Category)),
+			Amount:      amount,
+		})
+	}
+
+	for _, raw := range readings {
+		reading, err := domain.ParseUsageReading(raw.Quantity.String(), raw.Unit)
+		if err != nil {
+			return err
+		}
+		if raw.PeriodStart != nil && raw.PeriodEnd != nil && raw.PeriodEnd.Before(*raw.PeriodStart) {
+			return fmt.Errorf("usage period ends before it starts")
+		}
+		reading.PeriodStart = raw.PeriodStart
+		reading.PeriodEnd = raw.PeriodEnd
+		reading.MeterID = raw.MeterID
+		bill.Usage = append(bill.Usage, reading)
+	}
+	return nil
+}
+
+func (a *HTTPAdapter) ValidateCredentials(ctx context.Context, credentials domain.Credentials) ([]string, error) {
+	body, err := json.Marshal(map[string]interface{}{"credentials": credentials})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode credentials: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/accounts/validate", a.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := a.auth.Apply(req, credentials); err != nil {
+		return nil, err
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate credentials: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Accounts []string `json:"accounts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(result.Accounts) == 0 {
+		return nil, fmt.Errorf("provider returned no accounts for the credentials")
+	}
+
+	return result.Accounts, nil
+}
+
+// statusError classifies an unsuccessful provider response: rejected
+// credentials are reported as domain.ErrInvalidCredentials and any other
+// status as a domain.ProviderError carrying the provider's Retry-After
+func statusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return domain.ErrInvalidCredentials
+	}
+	return &domain.ProviderError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an
+// HTTP date, returning 0 when it is missing or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+func (a *HTTPAdapter) Capabilities() domain.ProviderCapabilities {
+	return domain.ProviderCapabilities{
+		SupportsCredentialValidation: true,
+	}
+}
+
+func (a *HTTPAdapter) GetProviderInfo() *domain.Provider {
+	return a.info
+}
+
+// freshCredentials refreshes the OAuth2 access token of account when it is
+// about to expire and persists the new tokens before they are used
+func (a *HTTPAdapter) freshCredentials(ctx context.Context, account domain.LinkedAccount, credentials domain.Credentials) (domain.Credentials, error) {
+	refresh := func(ctx context.Context, credentials domain.Credentials) (domain.Credentials, error) {
+		return RefreshToken(ctx, a.httpClient, a.info.AuthConfig, credentials)
+	}
+	persist := func(ctx context.Context, credentials domain.Credentials) error {
+		encoded, err := credentials.Encode()
+		if err != nil {
+			return err
+		}
+		account.Credentials = encoded
+		account.CredentialsKeyVersion = 0
+		return a.store.UpdateLinkedAccount(ctx, &account)
+	}
+	return a.tokens.Fresh(ctx, account.ID, credentials, refresh, persist)
+}
@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusErrorClassifiesResponses(t *testing.T) {
+	respond := func(status int, retryAfter string) *http.Response {
+		rec := httptest.NewRecorder()
+		if retryAfter != "" {
+			rec.Header().Set("Retry-After", retryAfter)
+		}
+		rec.WriteHeader(status)
+		return rec.Result()
+	}
+
+	assert.NoError(t, statusError(respond(http.StatusOK, "")))
+	assert.ErrorIs(t, statusError(respond(http.StatusForbidden, "")), domain.ErrInvalidCredentials)
+
+	err := statusError(respond(http.StatusTooManyRequests, "7"))
+	assert.Equal(t, &domain.ProviderError{StatusCode: http.StatusTooManyRequests, RetryAfter: 7 * time.Second}, err)
+	assert.Equal(t, "unexpected status code: 429", err.Error())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 2*time.Minute, parseRetryAfter(now.Add(2*time.Minute).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("-5", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+	assert.Zero(t, parseRetryAfter("", now))
+}
+
+func TestFetchBillsMapsAmountsAndStatuses(t *testing.T) {
+	body := `[
+		{"id": "B1", "amount": 0.1, "due_date": "2024-01-10T00:00:00Z", "status": "Unpaid"},
+		{"id": "B2", "amount": 1500, "currency": "jpy", "due_date": "2024-01-10T00:00:00Z", "status": "partially paid"},
+		{"id": "B3", "amount": 20, "due_date": "2024-01-10T00:00:00Z", "status": "awaiting_payment"}
+	]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	adapter, err := NewHTTPAdapter(&domain.Provider{ID: "p1", APIEndpoint: srv.URL, AuthType: "none"}, nil, nil, "")
+	assert.NoError(t, err)
+
+	bills, err := adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.NoError(t, err)
+	if assert.Len(t, bills, 3) {
+		assert.Equal(t, domain.Money{Minor: 10, Currency: domain.DefaultCurrency}, bills[0].Amount)
+		assert.Equal(t, domain.BillUnpaid, bills[0].Status)
+		assert.Equal(t, domain.Money{Minor: 1500, Currency: "JPY"}, bills[1].Amount)
+		assert.Equal(t, domain.BillPartiallyPaid, bills[1].Status)
+		// Unknown statuses do not fail the fetch
+		assert.Equal(t, domain.BillUnpaid, bills[2].Status)
+	}
+
+	// Amounts more precise than their currency are rounded half to even
+	body = `[{"id": "B4", "amount": 0.125, "due_date": "2024-01-10T00:00:00Z", "status": "unpaid"}]`
+	bills, err = adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.NoError(t, err)
+	if assert.Len(t, bills, 1) {
+		assert.Equal(t, domain.Money{Minor: 12, Currency: domain.DefaultCurrency}, bills[0].Amount)
+	}
+}
+
+func TestFetchBillsMapsLineItemsAndUsage(t *testing.T) {
+	body := `[{
+		"id": "B1", "amount": "52.40", "currency": "EUR", "due_date": "2024-01-10T00:00:00Z", "status": "unpaid",
+		"line_items": [
+			{"description": "Energy charge", "category": "Energy", "amount": 41.20},
+			{"description": "VAT", "category": "tax", "amount": "11.2"}
+		],
+		"usage": [
+			{"quantity": 350.5, "unit": "kwh", "period_start": "2023-12-01T00:00:00Z", "period_end": "2024-01-01T00:00:00Z", "meter_id": "M-1"}
+		]
+	}]`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	adapter, err := NewHTTPAdapter(&domain.Provider{ID: "p1", APIEndpoint: srv.URL, AuthType: "none"}, nil, nil, "")
+	assert.NoError(t, err)
+
+	bills, err := adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+	assert.NoError(t, err)
+	if assert.Len(t, bills, 1) {
+		assert.Equal(t, []domain.BillLineItem{
+			{Description: "Energy charge", Category: "energy", Amount: domain.Money{Minor: 4120, Currency: "EUR"}},
+			{Description: "VAT", Category: "tax", Amount: domain.Money{Minor: 1120, Currency: "EUR"}},
+		}, bills[0].LineItems)
+		if assert.Len(t, bills[0].Usage, 1) {
+			reading := bills[0].Usage[0]
+			assert.Equal(t, "350.5", reading.Quantity)
+			assert.Equal(t, "kWh", reading.Unit)
+			assert.Equal(t, "M-1", reading.MeterID)
+			assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), *reading.PeriodEnd)
+		}
+		assert.NotEmpty(t, bills[0].DetailsDigest())
+	}
+
+	for _, invalid := range []string{
+		`"line_items": [{"description": "Fee", "amount": 1e3}]`,
+		`"usage": [{"quantity": -1, "unit": "kWh"}]`,
+		`"usage": [{"quantity": 10}]`,
+		`"usage": [{"quantity": 10, "unit": "GB", "period_start": "2024-01-01T00:00:00Z", "period_end": "2023-12-01T00:00:00Z"}]`,
+	} {
+		body = `[{"id": "B2", "amount": 1, "due_date": "2024-01-10T00:00:00Z", "status": "unpaid", ` + invalid + `}]`
+		_, err = adapter.FetchBills(context.Background(), domain.LinkedAccount{ID: "acc1"}, domain.Credentials{})
+		assert.Error(t, err, invalid)
+	}
+}
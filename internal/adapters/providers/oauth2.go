@@ -0,0 +1,152 @@
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+)
+
+// tokenExpiryMargin refreshes access tokens slightly before they expire
+const tokenExpiryMargin = 30 * time.Second
+
+// validateOAuth2Config checks the settings required by the authorization-code flow
+func validateOAuth2Config(cfg domain.ProviderAuthConfig) error {
+	if cfg.AuthorizeURL == "" || cfg.TokenURL == "" || cfg.ClientID == "" {
+		return errors.New("oauth2 providers require authorize_url, token_url and client_id")
+	}
+	return nil
+}
+
+// NewPKCE returns a random code verifier and its S256 code challenge
+func NewPKCE() (verifier, challenge string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL builds the provider authorize URL the user is redirected to
+func AuthCodeURL(cfg domain.ProviderAuthConfig, redirectURL, state, codeChallenge string) (string, error) {
+	authorizeURL, err := url.Parse(cfg.AuthorizeURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorize url: %w", err)
+	}
+
+	query := authorizeURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", cfg.ClientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	if len(cfg.Scopes) > 0 {
+		query.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	authorizeURL.RawQuery = query.Encode()
+	return authorizeURL.String(), nil
+}
+
+// ExchangeCode trades an authorization code for tokens
+func ExchangeCode(ctx context.Context, client *http.Client, cfg domain.ProviderAuthConfig, code, codeVerifier, redirectURL string) (domain.Credentials, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("redirect_uri", redirectURL)
+	return requestToken(ctx, client, cfg, form)
+}
+
+// RefreshToken obtains a new access token using the refresh token in credentials
+func RefreshToken(ctx context.Context, client *http.Client, cfg domain.ProviderAuthConfig, credentials domain.Credentials) (domain.Credentials, error) {
+	refreshToken := credentials["refresh_token"]
+	if refreshToken == "" {
+		return nil, fmt.Errorf("access token expired and no refresh token is available: %w", domain.ErrInvalidCredentials)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	refreshed, err := requestToken(ctx, client, cfg, form)
+	if err != nil {
+		return nil, err
+	}
+
+	// Providers may keep the refresh token unchanged and omit it from the response
+	if refreshed["refresh_token"] == "" {
+		refreshed["refresh_token"] = refreshToken
+	}
+	return refreshed, nil
+}
+
+// TokenExpired reports whether the access token in credentials needs refreshing
+func TokenExpired(credentials domain.Credentials) bool {
+	expiresAt, err := time.Parse(time.RFC3339, credentials["expires_at"])
+	if err != nil {
+		return false
+	}
+	return time.Now().Add(tokenExpiryMargin).After(expiresAt)
+}
+
+// requestToken calls the provider token endpoint and converts the response to credentials
+func requestToken(ctx context.Context, client *http.Client, cfg domain.ProviderAuthConfig, form url.Values) (domain.Credentials, error) {
+	form.Set("client_id", cfg.ClientID)
+	if cfg.ClientSecret != "" {
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		return nil, fmt.Errorf("token request rejected with status %d: %w", resp.StatusCode, domain.ErrInvalidCredentials)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected token status code: %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+
+	credentials := domain.Credentials{
+		"access_token":  token.AccessToken,
+		"refresh_token": token.RefreshToken,
+		"token_type":    token.TokenType,
+	}
+	if token.ExpiresIn > 0 {
+		credentials["expires_at"] = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second).UTC().Format(time.RFC3339)
+	}
+	return credentials, nil
+}
@@ -0,0 +1,112 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubProviderRepository struct {
+	updated []*domain.LinkedAccount
+	lookups int
+}
+
+func (s *stubProviderRepository) GetProviderByID(ctx context.Context, id string) (*domain.Provider, error) {
+	s.lookups++
+	return nil, nil
+}
+
+func (s *stubProviderRepository) ListProviders(ctx context.Context) ([]*domain.Provider, error) {
+	return nil, nil
+}
+
+func (s *stubProviderRepository) UpdateLinkedAccount(ctx context.Context, account *domain.LinkedAccount) error {
+	s.updated = append(s.updated, account)
+	return nil
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	verifier, challenge, err := NewPKCE()
+	assert.NoError(t, err)
+	assert.NotEqual(t, verifier, challenge)
+
+	authURL, err := AuthCodeURL(domain.ProviderAuthConfig{
+		AuthorizeURL: "https://provider.example/oauth/authorize",
+		ClientID:     "client",
+		Scopes:       []string{"bills:read", "accounts:read"},
+	}, "https://app.example/callback", "state-1", challenge)
+	assert.NoError(t, err)
+
+	parsed, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	query := parsed.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "client", query.Get("client_id"))
+	assert.Equal(t, "state-1", query.Get("state"))
+	assert.Equal(t, challenge, query.Get("code_challenge"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, "bills:read accounts:read", query.Get("scope"))
+}
+
+func TestFetchBillsRefreshesExpiredToken(t *testing.T) {
+	refreshes := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "old-refresh", r.PostForm.Get("refresh_token"))
+		refreshes++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "new-access",
+			"refresh_token": "new-refresh",
+			"expires_in":    3600,
+		})
+	})
+	mux.HandleFunc("/bills", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer new-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode([]interface{}{})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	store := &stubProviderRepository{}
+	adapter, err := NewHTTPAdapter(&domain.Provider{
+		ID:          "p1",
+		APIEndpoint: srv.URL,
+		AuthType:    "oauth2",
+		AuthConfig:  domain.ProviderAuthConfig{AuthorizeURL: srv.URL + "/oauth/authorize", TokenURL: srv.URL + "/oauth/token", ClientID: "client"},
+	}, store, nil, "")
+	assert.NoError(t, err)
+
+	account := domain.LinkedAccount{ID: "acc1", ProviderID: "p1", CredentialsKeyVersion: 1}
+	expired := domain.Credentials{
+		"access_token":  "old-access",
+		"refresh_token": "old-refresh",
+		"expires_at":    time.Now().Add(-time.Minute).Format(time.RFC3339),
+	}
+
+	_, err = adapter.FetchBills(context.Background(), account, expired)
+	assert.NoError(t, err)
+
+	// Callers still holding the expired credentials reuse the refreshed token
+	_, err = adapter.FetchBills(context.Background(), account, expired)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, refreshes)
+
+	if assert.Len(t, store.updated, 1) {
+		persisted := domain.ParseCredentials(store.updated[0].Credentials)
+		assert.Equal(t, "new-access", persisted["access_token"])
+		assert.Equal(t, "new-refresh", persisted["refresh_token"])
+		assert.Equal(t, 0, store.updated[0].CredentialsKeyVersion)
+	}
+}
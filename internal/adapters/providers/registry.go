@@ -0,0 +1,239 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// notFoundTTL is how long a provider ID missing from the repository is
+// reported missing without looking it up again
+const notFoundTTL = 30 * time.Second
+
+// Registry keeps one provider adapter for every row in the providers table.
+// It is shared by all use cases so a provider registered at runtime can be
+// fetched without a redeploy.
+type Registry struct {
+	repo     ports.ProviderRepository
+	vault    ports.CredentialVault
+	breaker  ports.CircuitBreaker
+	limiter  ports.ProviderRateLimiter
+	mu       sync.RWMutex
+	adapters map[string]ports.ProviderAdapter
+	// tokens outlives the adapters so reloads keep refreshed OAuth2 tokens
+	tokens *TokenCache
+	// missing holds when unknown provider IDs were last looked up
+	missing map[string]time.Time
+	// certDir holds the files of mutual TLS providers
+	certDir string
+}
+
+// NewRegistry creates an empty provider registry backed by repo. Linked
+// account credentials are opened with vault before they reach an adapter.
+func NewRegistry(repo ports.ProviderRepository, vault ports.CredentialVault) *Registry {
+	return &Registry{
+		repo:     repo,
+		vault:    vault,
+		adapters: make(map[string]ports.ProviderAdapter),
+		tokens:   NewTokenCache(),
+		missing:  make(map[string]time.Time),
+	}
+}
+
+// UseCircuitBreaker guards the calls of every adapter built from now on with
+// breaker. Call it before Load.
+func (r *Registry) UseCircuitBreaker(breaker ports.CircuitBreaker) {
+	r.breaker = breaker
+}
+
+// UseRateLimiter keeps the calls of every adapter built from now on within
+// the quota of their provider. Call it before Load.
+func (r *Registry) UseRateLimiter(limiter ports.ProviderRateLimiter) {
+	r.limiter = limiter
+}
+
+// UseCertificateDir reads the client certificates, keys and CAs of mutual TLS
+// providers from dir. Their auth configs name files inside it; without a
+// directory mutual TLS providers cannot be built. Call it before Load.
+func (r *Registry) UseCertificateDir(dir string) {
+	r.certDir = dir
+}
+
+// Validate checks that an adapter can be built for provider
+func (r *Registry) Validate(provider *domain.Provider) error {
+	if err := validateEndpoint(provider); err != nil {
+		return err
+	}
+	if _, err := NewAuthenticator(provider, r.certDir); err != nil {
+		return fmt.Errorf("invalid auth config for provider %s: %w", provider.ID, err)
+	}
+	return nil
+}
+
+// validateEndpoint checks that the provider API endpoint is an absolute URL
+func validateEndpoint(provider *domain.Provider) error {
+	endpoint, err := url.Parse(provider.APIEndpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return fmt.Errorf("invalid api endpoint for provider %s: %q", provider.ID, provider.APIEndpoint)
+	}
+	return nil
+}
+
+// newAdapter builds the adapter for a registered provider
+func (r *Registry) newAdapter(provider *domain.Provider) (ports.ProviderAdapter, error) {
+	adapter, err := NewHTTPAdapter(provider, r.repo, r.tokens, r.certDir)
+	if err != nil || (r.breaker == nil && r.limiter == nil) {
+		return adapter, err
+	}
+	guarded := *provider
+	return &guardedAdapter{ProviderAdapter: adapter, provider: &guarded, breaker: r.breaker, limiter: r.limiter}, nil
+}
+
+// Load rebuilds the registry from the providers table
+func (r *Registry) Load(ctx context.Context) error {
+	rows, err := r.repo.ListProviders(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list providers: %w", err)
+	}
+
+	adapters := make(map[string]ports.ProviderAdapter, len(rows))
+	for _, row := range rows {
+		adapter, err := r.newAdapter(row)
+		if err != nil {
+			log.Printf("Skipping provider %s: %v", row.ID, err)
+			continue
+		}
+		adapters[row.ID] = adapter
+	}
+
+	r.mu.Lock()
+	replaced := r.adapters
+	r.adapters = adapters
+	r.missing = make(map[string]time.Time)
+	r.mu.Unlock()
+
+	for _, adapter := range replaced {
+		closeIdleConnections(adapter)
+	}
+	return nil
+}
+
+// Register adds or replaces the adapter for a single provider
+func (r *Registry) Register(provider *domain.Provider) error {
+	adapter, err := r.newAdapter(provider)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	replaced := r.adapters[provider.ID]
+	r.adapters[provider.ID] = adapter
+	delete(r.missing, provider.ID)
+	r.mu.Unlock()
+
+	closeIdleConnections(replaced)
+	return nil
+}
+
+// Remove drops the adapter for a provider
+func (r *Registry) Remove(providerID string) {
+	r.mu.Lock()
+	removed := r.adapters[providerID]
+	delete(r.adapters, providerID)
+	r.mu.Unlock()
+
+	closeIdleConnections(removed)
+}
+
+// closeIdleConnections closes the idle connections an adapter the registry
+// dropped keeps open. Calls still in flight finish normally.
+func closeIdleConnections(adapter ports.ProviderAdapter) {
+	if closer, ok := adapter.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// Get returns the adapter for a provider. Providers registered by another
+// replica since the last Load are looked up in the repository on demand;
+// unknown providers are only looked up again after notFoundTTL.
+func (r *Registry) Get(ctx context.Context, providerID string) (ports.ProviderAdapter, error) {
+	r.mu.RLock()
+	adapter, ok := r.adapters[providerID]
+	missingAt, missing := r.missing[providerID]
+	r.mu.RUnlock()
+	if ok {
+		return adapter, nil
+	}
+	if missing && time.Since(missingAt) < notFoundTTL {
+		return nil, fmt.Errorf("provider not found: %s", providerID)
+	}
+
+	provider, err := r.repo.GetProviderByID(ctx, providerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider %s: %w", providerID, err)
+	}
+	if provider == nil {
+		r.mu.Lock()
+		r.missing[providerID] = time.Now()
+		r.mu.Unlock()
+		return nil, fmt.Errorf("provider not found: %s", providerID)
+	}
+
+	adapter, err = r.newAdapter(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if existing, ok := r.adapters[providerID]; ok {
+		// Another call built it first
+		r.mu.Unlock()
+		closeIdleConnections(adapter)
+		return existing, nil
+	}
+	r.adapters[providerID] = adapter
+	delete(r.missing, providerID)
+	r.mu.Unlock()
+	return adapter, nil
+}
+
+// Credentials returns the decrypted credentials of a linked account
+func (r *Registry) Credentials(account domain.LinkedAccount) (domain.Credentials, error) {
+	if account.CredentialsKeyVersion == 0 {
+		return domain.ParseCredentials(account.Credentials), nil
+	}
+	if r.vault == nil {
+		return nil, fmt.Errorf("credentials of account %s are encrypted but no vault is configured", account.ID)
+	}
+
+	plaintext, err := r.vault.Open(account.Credentials, account.CredentialsKeyVersion, account.ID)
+	if err != nil {
+		return nil, err
+	}
+	return domain.ParseCredentials(plaintext), nil
+}
+
+// Watch reloads the registry on every tick until ctx is cancelled, picking up
+// providers updated through other replicas
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Load(ctx); err != nil {
+					log.Printf("Error reloading provider registry: %v", err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
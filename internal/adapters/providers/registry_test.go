@@ -0,0 +1,27 @@
+package providers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryCachesUnknownProviders(t *testing.T) {
+	repo := &stubProviderRepository{}
+	registry := NewRegistry(repo, nil)
+
+	for i := 0; i < 3; i++ {
+		_, err := registry.Get(context.Background(), "unknown")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 1, repo.lookups)
+
+	// Registering the provider makes it available at once
+	assert.NoError(t, registry.Register(&domain.Provider{ID: "unknown", APIEndpoint: "http://localhost:8083", AuthType: "none"}))
+	adapter, err := registry.Get(context.Background(), "unknown")
+	assert.NoError(t, err)
+	assert.NotNil(t, adapter)
+	assert.Equal(t, 1, repo.lookups)
+}
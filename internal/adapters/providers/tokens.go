@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+)
+
+// TokenCache keeps the OAuth2 credentials refreshed for each linked account
+// and runs at most one refresh per account at a time. It is shared by the
+// adapters of a registry so that rebuilding an adapter does not lose tokens
+// the provider has already rotated.
+type TokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+	calls  map[string]*tokenCall
+}
+
+// cachedToken holds refreshed credentials and whether they were persisted
+type cachedToken struct {
+	credentials domain.Credentials
+	saved       bool
+}
+
+// tokenCall is a refresh in progress that other callers wait for
+type tokenCall struct {
+	done        chan struct{}
+	credentials domain.Credentials
+	err         error
+}
+
+// NewTokenCache creates an empty token cache
+func NewTokenCache() *TokenCache {
+	return &TokenCache{
+		tokens: make(map[string]cachedToken),
+		calls:  make(map[string]*tokenCall),
+	}
+}
+
+// Fresh returns credentials of accountID that have not expired. Expired
+// credentials are renewed with refresh and the result is stored with persist
+// before it is used, since a provider rotating refresh tokens only accepts
+// the newest one. Tokens that could not be persisted are kept and persisting
+// them is retried by the next call.
+func (c *TokenCache) Fresh(
+	ctx context.Context,
+	accountID string,
+	current domain.Credentials,
+	refresh func(ctx context.Context, credentials domain.Credentials) (domain.Credentials, error),
+	persist func(ctx context.Context, credentials domain.Credentials) error,
+) (domain.Credentials, error) {
+	c.mu.Lock()
+	token, cached := c.tokens[accountID]
+	if cached && token.saved && !TokenExpired(token.credentials) {
+		c.mu.Unlock()
+		return token.credentials, nil
+	}
+	if !cached && !TokenExpired(current) {
+		c.mu.Unlock()
+		return current, nil
+	}
+
+	if call, ok := c.calls[accountID]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.credentials, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	c.calls[accountID] = call
+	c.mu.Unlock()
+
+	call.credentials, call.err = c.renew(ctx, accountID, current, refresh, persist)
+
+	c.mu.Lock()
+	delete(c.calls, accountID)
+	c.mu.Unlock()
+	close(call.done)
+	return call.credentials, call.err
+}
+
+// renew refreshes the newest credentials of accountID if they expired and
+// persists them
+func (c *TokenCache) renew(
+	ctx context.Context,
+	accountID string,
+	current domain.Credentials,
+	refresh func(ctx context.Context, credentials domain.Credentials) (domain.Credentials, error),
+	persist func(ctx context.Context, credentials domain.Credentials) error,
+) (domain.Credentials, error) {
+	c.mu.Lock()
+	token, cached := c.tokens[accountID]
+	c.mu.Unlock()
+
+	credentials := current
+	if cached {
+		credentials = token.credentials
+	}
+	if TokenExpired(credentials) {
+		refreshed, err := refresh(ctx, credentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh access token: %w", err)
+		}
+		credentials = refreshed
+		c.mu.Lock()
+		c.tokens[accountID] = cachedToken{credentials: refreshed}
+		c.mu.Unlock()
+	}
+
+	if err := persist(ctx, credentials); err != nil {
+		return nil, fmt.Errorf("failed to persist refreshed tokens: %w", err)
+	}
+	c.mu.Lock()
+	c.tokens[accountID] = cachedToken{credentials: credentials, saved: true}
+	c.mu.Unlock()
+	return credentials, nil
+}
@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func expiredCredentials() domain.Credentials {
+	return domain.Credentials{
+		"access_token":  "old-access",
+		"refresh_token": "old-refresh",
+		"expires_at":    time.Now().Add(-time.Minute).Format(time.RFC3339),
+	}
+}
+
+func TestTokenCacheRefreshesOncePerAccount(t *testing.T) {
+	cache := NewTokenCache()
+	var refreshes atomic.Int32
+	release := make(chan struct{})
+	refresh := func(ctx context.Context, credentials domain.Credentials) (domain.Credentials, error) {
+		refreshes.Add(1)
+		<-release
+		return domain.Credentials{"access_token": "new-access", "expires_at": time.Now().Add(time.Hour).Format(time.RFC3339)}, nil
+	}
+	persist := func(ctx context.Context, credentials domain.Credentials) error { return nil }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			credentials, err := cache.Fresh(context.Background(), "acc1", expiredCredentials(), refresh, persist)
+			assert.NoError(t, err)
+			assert.Equal(t, "new-access", credentials["access_token"])
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), refreshes.Load())
+
+	// A waiter gives up when its own context ends
+	cache = NewTokenCache()
+	block := make(chan struct{})
+	go cache.Fresh(context.Background(), "acc1", expiredCredentials(), func(ctx context.Context, credentials domain.Credentials) (domain.Credentials, error) {
+		<-block
+		return nil, errors.New("unreachable")
+	}, persist)
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := cache.Fresh(ctx, "acc1", expiredCredentials(), refresh, persist)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	close(block)
+}
+
+func TestTokenCacheRetriesPersistingRotatedTokens(t *testing.T) {
+	cache := NewTokenCache()
+	var refreshes int
+	refresh := func(ctx context.Context, credentials domain.Credentials) (domain.Credentials, error) {
+		refreshes++
+		return domain.Credentials{"access_token": "new-access", "refresh_token": "new-refresh", "expires_at": time.Now().Add(time.Hour).Format(time.RFC3339)}, nil
+	}
+	failPersist := true
+	var persisted []domain.Credentials
+	persist := func(ctx context.Context, credentials domain.Credentials) error {
+		if failPersist {
+			return errors.New("database unavailable")
+		}
+		persisted = append(persisted, credentials)
+		return nil
+	}
+
+	_, err := cache.Fresh(context.Background(), "acc1", expiredCredentials(), refresh, persist)
+	assert.Error(t, err)
+
+	// The rotated refresh token is not redeemed again, only persisted
+	failPersist = false
+	credentials, err := cache.Fresh(context.Background(), "acc1", expiredCredentials(), refresh, persist)
+	assert.NoError(t, err)
+	assert.Equal(t, "new-access", credentials["access_token"])
+	assert.Equal(t, 1, refreshes)
+	if assert.Len(t, persisted, 1) {
+		assert.Equal(t, "new-refresh", persisted[0]["refresh_token"])
+	}
+
+	_, err = cache.Fresh(context.Background(), "acc1", expiredCredentials(), refresh, persist)
+	assert.NoError(t, err)
+	assert.Len(t, persisted, 1)
+}
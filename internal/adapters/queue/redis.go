@@ -0,0 +1,245 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/cache"
+	"github.com/mel-ak/onetap-challenge/internal/config"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// pollInterval is how often Dequeue checks for ready jobs while waiting
+const pollInterval = 500 * time.Millisecond
+
+// reserveScript moves due retries and jobs whose visibility timeout expired
+// back to the ready list, then reserves the oldest ready job.
+//
+// KEYS: ready, processing, delayed, attempts, jobs
+// ARGV: now (ms), visibility deadline (ms)
+var reserveScript = redis.NewScript(`
+local function requeue(set)
+	local ids = redis.call('ZRANGEBYSCORE', set, '-inf', ARGV[1], 'LIMIT', 0, 100)
+	for _, id in ipairs(ids) do
+		redis.call('ZREM', set, id)
+		redis.call('LPUSH', KEYS[1], id)
+	end
+end
+requeue(KEYS[3])
+requeue(KEYS[2])
+
+while true do
+	local id = redis.call('RPOP', KEYS[1])
+	if not id then
+		return false
+	end
+	local body = redis.call('HGET', KEYS[5], id)
+	if body then
+		redis.call('ZADD', KEYS[2], ARGV[2], id)
+		local attempts = redis.call('HINCRBY', KEYS[4], id, 1)
+		return {body, attempts}
+	end
+end
+`)
+
+// extendScript moves the visibility deadline of a job that is still reserved
+//
+// KEYS: processing
+// ARGV: job ID, visibility deadline (ms)
+var extendScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// RedisQueue is a reliable job queue stored in Redis. Job bodies live in a
+// hash keyed by job ID; the ready list, the processing set (scored by
+// visibility deadline) and the delayed set (scored by retry time) hold IDs.
+// Jobs that fail on their last attempt are pushed to the dead-letter list.
+type RedisQueue struct {
+	client *redis.Client
+	keys   queueKeys
+	cfg    config.QueueConfig
+}
+
+type queueKeys struct {
+	ready, processing, delayed, attempts, jobs, dead string
+}
+
+// NewRedisQueue creates the queue called name on the shared Redis client
+func NewRedisQueue(redisClient *cache.RedisClient, name string, cfg config.QueueConfig) *RedisQueue {
+	prefix := "queue:" + name + ":"
+	return &RedisQueue{
+		client: redisClient.Client(),
+		keys: queueKeys{
+			ready:      prefix + "ready",
+			processing: prefix + "processing",
+			delayed:    prefix + "delayed",
+			attempts:   prefix + "attempts",
+			jobs:       prefix + "jobs",
+			dead:       prefix + "dead",
+		},
+		cfg: cfg,
+	}
+}
+
+// Enqueue adds a job to the ready list
+func (q *RedisQueue) Enqueue(ctx context.Context, job *domain.Job) error {
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = q.cfg.MaxAttempts
+	}
+	job.EnqueuedAt = time.Now()
+
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, q.keys.jobs, job.ID, body)
+		pipe.LPush(ctx, q.keys.ready, job.ID)
+		return nil
+	})
+	return err
+}
+
+// Dequeue reserves the next ready job, polling until wait elapses. Jobs
+// redelivered after their last attempt are dead-lettered instead.
+func (q *RedisQueue) Dequeue(ctx context.Context, wait time.Duration) (*domain.Job, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		job, err := q.reserve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if job != nil && job.Attempts > job.MaxAttempts {
+			log.Printf("Job %s (%s) was not acknowledged after %d attempts", job.ID, job.Type, job.MaxAttempts)
+			if err := q.deadLetter(ctx, job, errors.New("visibility timeout expired on last attempt")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if job != nil || !time.Now().Before(deadline) {
+			return job, nil
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Extend keeps a reserved job invisible for another visibility timeout
+func (q *RedisQueue) Extend(ctx context.Context, jobID string) error {
+	deadline := time.Now().Add(q.cfg.VisibilityTimeout)
+	extended, err := extendScript.Run(ctx, q.client, []string{q.keys.processing}, jobID, deadline.UnixMilli()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to extend job %s: %w", jobID, err)
+	}
+	if extended == 0 {
+		return fmt.Errorf("job %s is no longer reserved", jobID)
+	}
+	return nil
+}
+
+// Ack removes a processed job
+func (q *RedisQueue) Ack(ctx context.Context, job *domain.Job) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, q.keys.processing, job.ID)
+		pipe.HDel(ctx, q.keys.jobs, job.ID)
+		pipe.HDel(ctx, q.keys.attempts, job.ID)
+		return nil
+	})
+	return err
+}
+
+// Nack schedules a failed job for retry, or dead-letters it after its last attempt
+func (q *RedisQueue) Nack(ctx context.Context, job *domain.Job, cause error) error {
+	if job.Attempts >= job.MaxAttempts {
+		return q.deadLetter(ctx, job, cause)
+	}
+
+	job.LastError = cause.Error()
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	retryAt := time.Now().Add(q.backoff(job.Attempts))
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, q.keys.jobs, job.ID, body)
+		pipe.ZRem(ctx, q.keys.processing, job.ID)
+		pipe.ZAdd(ctx, q.keys.delayed, redis.Z{Score: float64(retryAt.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	return err
+}
+
+// reserve runs the reserve script and decodes the reserved job
+func (q *RedisQueue) reserve(ctx context.Context) (*domain.Job, error) {
+	now := time.Now()
+	keys := []string{q.keys.ready, q.keys.processing, q.keys.delayed, q.keys.attempts, q.keys.jobs}
+	result, err := reserveScript.Run(ctx, q.client, keys,
+		now.UnixMilli(),
+		now.Add(q.cfg.VisibilityTimeout).UnixMilli(),
+	).Slice()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve job: %w", err)
+	}
+
+	body, _ := result[0].(string)
+	attempts, _ := result[1].(int64)
+
+	var job domain.Job
+	if err := json.Unmarshal([]byte(body), &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	job.Attempts = int(attempts)
+	return &job, nil
+}
+
+// deadLetter moves a job to the dead-letter list with the error that failed it
+func (q *RedisQueue) deadLetter(ctx context.Context, job *domain.Job, cause error) error {
+	job.LastError = cause.Error()
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, q.keys.processing, job.ID)
+		pipe.HDel(ctx, q.keys.jobs, job.ID)
+		pipe.HDel(ctx, q.keys.attempts, job.ID)
+		pipe.LPush(ctx, q.keys.dead, body)
+		return nil
+	})
+	return err
+}
+
+// backoff returns the retry delay after the given number of attempts
+func (q *RedisQueue) backoff(attempts int) time.Duration {
+	delay := q.cfg.RetryBackoff
+	for i := 1; i < attempts && delay < q.cfg.MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.cfg.MaxRetryBackoff {
+		delay = q.cfg.MaxRetryBackoff
+	}
+	return delay
+}
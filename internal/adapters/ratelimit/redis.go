@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/adapters/cache"
+	"github.com/mel-ak/onetap-challenge/internal/config"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// Metrics per provider, published on /debug/vars
+var (
+	// calls counts the calls let through
+	calls = expvar.NewMap("provider_quota_calls")
+	// throttled counts the calls that had to wait for a token
+	throttled = expvar.NewMap("provider_quota_throttled")
+	// rejected counts the calls refused because the wait was too long
+	rejected = expvar.NewMap("provider_quota_rejected")
+	// waited sums the time throttled calls waited, in milliseconds
+	waited = expvar.NewMap("provider_quota_wait_ms")
+)
+
+// reserveScript takes a token from a bucket refilled continuously up to its
+// burst. When the bucket is empty the token is reserved ahead, leaving the
+// bucket negative, and the caller told how long to wait for it; a wait
+// longer than allowed reserves nothing. The clock is Redis' own so that
+// replicas with skewed clocks share one bucket.
+//
+// KEYS: bucket
+// ARGV: refill rate (tokens per ms), burst, max wait (ms)
+// Returns: {granted (0/1), wait (ms)}
+var reserveScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate) - 1
+local wait = 0
+if tokens < 0 then
+	wait = math.ceil(-tokens / rate)
+end
+if wait > tonumber(ARGV[3]) then
+	return {0, wait}
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1)
+return {1, wait}
+`)
+
+// RedisLimiter is a ProviderRateLimiter whose token buckets live in Redis, so
+// every replica draws from the same quota of a provider's API
+type RedisLimiter struct {
+	client  *redis.Client
+	maxWait time.Duration
+}
+
+// NewRedisLimiter creates a limiter on the shared Redis client
+func NewRedisLimiter(redisClient *cache.RedisClient, cfg config.ProviderQuotaConfig) *RedisLimiter {
+	return &RedisLimiter{
+		client:  redisClient.Client(),
+		maxWait: cfg.MaxWait,
+	}
+}
+
+// Wait blocks until a call to provider fits the quota stored on it.
+// Providers without a quota are not limited. A call that would wait past
+// ctx's deadline or the maximum wait fails right away with
+// domain.ErrRateLimited, leaving its token to other callers.
+func (l *RedisLimiter) Wait(ctx context.Context, provider *domain.Provider) error {
+	if provider.RateLimitPerMinute <= 0 {
+		return nil
+	}
+	burst := provider.RateLimitBurst
+	if burst <= 0 {
+		burst = provider.RateLimitPerMinute
+	}
+
+	maxWait := l.maxWait
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < maxWait {
+		maxWait = time.Until(deadline)
+	}
+	if maxWait < 0 {
+		maxWait = 0
+	}
+
+	reply, err := reserveScript.Run(ctx, l.client, []string{bucketKey(provider.ID)},
+		float64(provider.RateLimitPerMinute)/float64(time.Minute.Milliseconds()),
+		burst,
+		maxWait.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return fmt.Errorf("failed to check rate limit of provider %s: %w", provider.ID, err)
+	}
+	if len(reply) != 2 {
+		return fmt.Errorf("failed to check rate limit of provider %s: unexpected reply %v", provider.ID, reply)
+	}
+
+	wait := time.Duration(reply[1]) * time.Millisecond
+	if reply[0] == 0 {
+		rejected.Add(provider.ID, 1)
+		return fmt.Errorf("%w for provider %s: next call in %s", domain.ErrRateLimited, provider.ID, wait)
+	}
+	calls.Add(provider.ID, 1)
+	if wait <= 0 {
+		return nil
+	}
+
+	throttled.Add(provider.ID, 1)
+	waited.Add(provider.ID, wait.Milliseconds())
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// The reserved token is lost; the bucket refills past it
+		return ctx.Err()
+	}
+}
+
+func bucketKey(providerID string) string {
+	return "ratelimit:provider:" + providerID
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/adapters/cache"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindowScript counts a request in a sorted set holding the time of
+// every request counted within the window. Refused requests are not counted.
+//
+// KEYS: window
+// ARGV: window (ms), limit, request nonce
+// Returns: {allowed (0/1), remaining, reset (ms)}
+var slidingWindowScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, time[1] .. time[2] .. ':' .. ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local reset = window
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}
+`)
+
+// SlidingWindow is a RequestRateLimiter keeping its counts in Redis, so a
+// client's requests count against the same limit on every replica
+type SlidingWindow struct {
+	client *redis.Client
+}
+
+// NewSlidingWindow creates a limiter on the shared Redis client
+func NewSlidingWindow(redisClient *cache.RedisClient) *SlidingWindow {
+	return &SlidingWindow{client: redisClient.Client()}
+}
+
+// Allow counts a request under key unless limit requests were already
+// counted within the last window
+func (w *SlidingWindow) Allow(ctx context.Context, key string, limit int, window time.Duration) (domain.RateLimitResult, error) {
+	reply, err := slidingWindowScript.Run(ctx, w.client, []string{"ratelimit:" + key},
+		window.Milliseconds(),
+		limit,
+		strconv.FormatInt(rand.Int63(), 36),
+	).Int64Slice()
+	if err != nil {
+		return domain.RateLimitResult{}, fmt.Errorf("failed to count request for %s: %w", key, err)
+	}
+	if len(reply) != 3 {
+		return domain.RateLimitResult{}, fmt.Errorf("failed to count request for %s: unexpected reply %v", key, reply)
+	}
+	return domain.RateLimitResult{
+		Allowed:   reply[0] == 1,
+		Remaining: int(reply[1]),
+		Reset:     time.Duration(reply[2]) * time.Millisecond,
+	}, nil
+}
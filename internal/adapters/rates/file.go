@@ -0,0 +1,57 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+)
+
+// FileSource is an ExchangeRateSource reading a local JSON file such as
+// {"base": "USD", "date": "2024-05-01", "rates": {"EUR": "0.9215"}}.
+// The file is read again whenever it changes, so rates can be updated by
+// replacing it without a restart or network access.
+type FileSource struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	rates   *domain.ExchangeRates
+}
+
+// NewFileSource creates a source reading the rates file at path
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// ExchangeRates returns the rates in the file, or nil when it does not exist
+func (s *FileSource) ExchangeRates(ctx context.Context) (*domain.ExchangeRates, error) {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rates != nil && info.ModTime().Equal(s.modTime) {
+		return s.rates, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates file: %w", err)
+	}
+	rates := &domain.ExchangeRates{}
+	if err := json.Unmarshal(data, rates); err != nil {
+		return nil, fmt.Errorf("invalid exchange rates file %s: %w", s.path, err)
+	}
+	s.rates, s.modTime = rates, info.ModTime()
+	return rates, nil
+}
@@ -0,0 +1,37 @@
+package rates
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSourceReadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	source := NewFileSource(path)
+
+	rates, err := source.ExchangeRates(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, rates)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"base": "USD", "date": "2024-05-01", "rates": {"EUR": "0.9"}}`), 0o600))
+	rates, err = source.ExchangeRates(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "0.9", rates.FormatRate("EUR"))
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"base": "USD", "date": "2024-05-02", "rates": {"EUR": "0.95"}}`), 0o600))
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(path, later, later))
+	rates, err = source.ExchangeRates(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "0.95", rates.FormatRate("EUR"))
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"base": "USD"}`), 0o600))
+	assert.NoError(t, os.Chtimes(path, later.Add(time.Second), later.Add(time.Second)))
+	_, err = source.ExchangeRates(context.Background())
+	assert.Error(t, err)
+}
@@ -3,25 +3,84 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// querier is implemented by both *sql.DB and *sql.Tx, so the same queries run
+// inside and outside a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 // PostgresRepository implements UserRepository, AccountRepository, and BillRepository
 type PostgresRepository struct {
-	db *sql.DB
+	conn  *sql.DB
+	db    querier // conn, or tx inside a unit of work
+	tx    *sql.Tx
+	vault ports.CredentialVault
 }
 
-// NewPostgresRepository creates a new repository
-func NewPostgresRepository(conn string) (*PostgresRepository, error) {
+// NewPostgresRepository creates a new repository. Linked account credentials
+// are sealed with vault before they are written.
+func NewPostgresRepository(conn string, vault ports.CredentialVault) (*PostgresRepository, error) {
 	db, err := sql.Open("postgres", conn)
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresRepository{db: db}, nil
+	return &PostgresRepository{conn: db, db: db, vault: vault}, nil
+}
+
+// WithTx runs fn in a transaction that is committed when fn returns nil and
+// rolled back otherwise. Calls made on a repository that is already in a
+// transaction join it.
+func (r *PostgresRepository) WithTx(ctx context.Context, fn func(tx ports.Repository) error) error {
+	return r.transaction(ctx, func(tx *PostgresRepository) error {
+		return fn(tx)
+	})
+}
+
+// transaction runs fn with a repository bound to a transaction
+func (r *PostgresRepository) transaction(ctx context.Context, fn func(tx *PostgresRepository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&PostgresRepository{conn: r.conn, db: tx, tx: tx, vault: r.vault}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sealCredentials returns the credentials to store for account and their key
+// version. Credentials read back from the database are already sealed.
+func (r *PostgresRepository) sealCredentials(account *domain.LinkedAccount) (string, int, error) {
+	if account.CredentialsKeyVersion > 0 || r.vault == nil {
+		return account.Credentials, account.CredentialsKeyVersion, nil
+	}
+	if account.ID == "" {
+		return "", 0, errors.New("linked account ID is required to seal its credentials")
+	}
+	return r.vault.Seal(account.Credentials, account.ID)
 }
 
 // SaveUser saves a user
@@ -49,9 +108,9 @@ func (r *PostgresRepository) CreateUser(ctx context.Context, user *domain.User)
 
 // GetUserByID retrieves a user by ID
 func (r *PostgresRepository) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
-	query := `SELECT id, email, password, created_at, updated_at FROM users WHERE id = $1`
+	query := `SELECT id, email, password, created_at, updated_at, COALESCE(refresh_cadence, ''), COALESCE(preferred_currency, '') FROM users WHERE id = $1`
 	user := &domain.User{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.RefreshCadence, &user.PreferredCurrency)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -60,9 +119,9 @@ func (r *PostgresRepository) GetUserByID(ctx context.Context, id string) (*domai
 
 // GetUserByEmail retrieves a user by email
 func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
-	query := `SELECT id, email, password, created_at, updated_at FROM users WHERE email = $1`
+	query := `SELECT id, email, password, created_at, updated_at, COALESCE(refresh_cadence, ''), COALESCE(preferred_currency, '') FROM users WHERE email = $1`
 	user := &domain.User{}
-	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.RefreshCadence, &user.PreferredCurrency)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -71,8 +130,8 @@ func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (
 
 // UpdateUser updates a user
 func (r *PostgresRepository) UpdateUser(ctx context.Context, user *domain.User) error {
-	query := `UPDATE users SET email = $1, password = $2, updated_at = $3 WHERE id = $4`
-	_, err := r.db.ExecContext(ctx, query, user.Email, user.Password, time.Now(), user.ID)
+	query := `UPDATE users SET email = $1, password = $2, refresh_cadence = NULLIF($3, ''), preferred_currency = NULLIF($4, ''), updated_at = $5 WHERE id = $6`
+	_, err := r.db.ExecContext(ctx, query, user.Email, user.Password, user.RefreshCadence, user.PreferredCurrency, time.Now(), user.ID)
 	return err
 }
 
@@ -109,23 +168,44 @@ func (r *PostgresRepository) ListUsers(ctx context.Context) ([]*domain.User, err
 
 // SaveAccount saves an account
 func (r *PostgresRepository) SaveAccount(ctx context.Context, account domain.LinkedAccount) (string, error) {
-	query := `INSERT INTO linked_accounts (id, user_id, provider_id, account_id, credentials, status, created_at, updated_at) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	credentials, keyVersion, err := r.sealCredentials(&account)
+	if err != nil {
+		return "", err
+	}
+	query := `INSERT INTO linked_accounts (id, user_id, provider_id, account_id, credentials, credentials_key_version, status, created_at, updated_at) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
 	var id string
-	err := r.db.QueryRowContext(ctx, query, account.ID, account.UserID, account.ProviderID, account.AccountID, account.Credentials, account.Status, time.Now(), time.Now()).Scan(&id)
+	err = r.db.QueryRowContext(ctx, query, account.ID, account.UserID, account.ProviderID, account.AccountID, credentials, keyVersion, account.Status, time.Now(), time.Now()).Scan(&id)
 	return id, err
 }
 
+// SaveAccounts saves accounts in one transaction
+func (r *PostgresRepository) SaveAccounts(ctx context.Context, accounts []domain.LinkedAccount) error {
+	return r.transaction(ctx, func(tx *PostgresRepository) error {
+		for _, account := range accounts {
+			if _, err := tx.SaveAccount(ctx, account); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // CreateLinkedAccount creates a new linked account
 func (r *PostgresRepository) CreateLinkedAccount(ctx context.Context, account *domain.LinkedAccount) error {
-	query := `INSERT INTO linked_accounts (id, user_id, provider_id, account_id, credentials, status, created_at, updated_at)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err := r.db.ExecContext(ctx, query,
+	credentials, keyVersion, err := r.sealCredentials(account)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO linked_accounts (id, user_id, provider_id, account_id, credentials, credentials_key_version, status, created_at, updated_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err = r.db.ExecContext(ctx, query,
 		account.ID,
 		account.UserID,
 		account.ProviderID,
 		account.AccountID,
-		account.Credentials,
+		credentials,
+		keyVersion,
 		account.Status,
 		time.Now(),
 		time.Now(),
@@ -135,7 +215,9 @@ func (r *PostgresRepository) CreateLinkedAccount(ctx context.Context, account *d
 
 // GetAccountsByUserID retrieves accounts for a user
 func (r *PostgresRepository) GetAccountsByUserID(ctx context.Context, userID string) ([]domain.LinkedAccount, error) {
-	query := `SELECT id, user_id, provider_id, account_id, credentials, status, created_at, updated_at FROM linked_accounts WHERE user_id = $1`
+	query := `SELECT id, user_id, provider_id, account_id, credentials, status, created_at, updated_at, credentials_key_version,
+              last_attempt_at, last_success_at, consecutive_failures, last_error, next_scheduled_at
+              FROM linked_accounts WHERE user_id = $1`
 	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
@@ -145,7 +227,8 @@ func (r *PostgresRepository) GetAccountsByUserID(ctx context.Context, userID str
 	var accounts []domain.LinkedAccount
 	for rows.Next() {
 		var acc domain.LinkedAccount
-		if err := rows.Scan(&acc.ID, &acc.UserID, &acc.ProviderID, &acc.AccountID, &acc.Credentials, &acc.Status, &acc.CreatedAt, &acc.UpdatedAt); err != nil {
+		if err := rows.Scan(&acc.ID, &acc.UserID, &acc.ProviderID, &acc.AccountID, &acc.Credentials, &acc.Status, &acc.CreatedAt, &acc.UpdatedAt, &acc.CredentialsKeyVersion,
+			&acc.Sync.LastAttemptAt, &acc.Sync.LastSuccessAt, &acc.Sync.ConsecutiveFailures, &acc.Sync.LastError, &acc.Sync.NextScheduledAt); err != nil {
 			continue
 		}
 		accounts = append(accounts, acc)
@@ -171,32 +254,246 @@ func (r *PostgresRepository) DeleteLinkedAccount(ctx context.Context, id string)
 	return err
 }
 
-// CreateBill creates a new bill
+// CreateBill creates a new bill and starts its status history
 func (r *PostgresRepository) CreateBill(ctx context.Context, bill *domain.Bill) error {
-	query := `INSERT INTO bills (id, linked_account_id, provider_id, amount, due_date, status, bill_date, created_at, updated_at)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	_, err := r.db.ExecContext(ctx, query,
-		bill.ID,
-		bill.LinkedAccountID,
-		bill.ProviderID,
-		bill.Amount,
-		bill.DueDate,
-		bill.Status,
-		bill.BillDate,
-		time.Now(),
-		time.Now(),
-	)
+	if bill.ExternalID == "" {
+		bill.ExternalID = bill.ID
+	}
+	return r.transaction(ctx, func(tx *PostgresRepository) error {
+		now := time.Now()
+		query := `INSERT INTO bills (id, external_id, linked_account_id, provider_id, amount_minor, currency, due_date, status, bill_date, details_digest, created_at, updated_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+		_, err := tx.db.ExecContext(ctx, query,
+			bill.ID,
+			bill.ExternalID,
+			bill.LinkedAccountID,
+			bill.ProviderID,
+			bill.Amount.Minor,
+			bill.Amount.Currency,
+			bill.DueDate,
+			bill.Status,
+			bill.BillDate,
+			bill.DetailsDigest(),
+			now,
+			now,
+		)
+		if err != nil {
+			return err
+		}
+		if err := tx.replaceBillDetails(ctx, bill); err != nil {
+			return err
+		}
+		return tx.recordStatusChange(ctx, bill.ID, "", bill.Status, domain.BillStatusSourceSystem, now)
+	})
+}
+
+// replaceBillDetails replaces the stored line items and usage of a bill with
+// the bill's own
+func (r *PostgresRepository) replaceBillDetails(ctx context.Context, bill *domain.Bill) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM bill_line_items WHERE bill_id = $1`, bill.ID); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM usage_readings WHERE bill_id = $1`, bill.ID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO bill_line_items (bill_id, position, description, category, amount_minor, currency)
+              VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)`
+	for i, item := range bill.LineItems {
+		if _, err := r.db.ExecContext(ctx, query, bill.ID, i, item.Description, item.Category, item.Amount.Minor, item.Amount.Currency); err != nil {
+			return err
+		}
+	}
+
+	query = `INSERT INTO usage_readings (bill_id, position, quantity, unit, period_start, period_end, meter_id)
+             VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))`
+	for i, reading := range bill.Usage {
+		if _, err := r.db.ExecContext(ctx, query, bill.ID, i, reading.Quantity, reading.Unit, reading.PeriodStart, reading.PeriodEnd, reading.MeterID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadBillDetails reads the line items and usage of bill
+func (r *PostgresRepository) loadBillDetails(ctx context.Context, bill *domain.Bill) error {
+	query := `SELECT description, COALESCE(category, ''), amount_minor, currency FROM bill_line_items WHERE bill_id = $1 ORDER BY position`
+	rows, err := r.db.QueryContext(ctx, query, bill.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item domain.BillLineItem
+		if err := rows.Scan(&item.Description, &item.Category, &item.Amount.Minor, &item.Amount.Currency); err != nil {
+			return err
+		}
+		bill.LineItems = append(bill.LineItems, item)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	query = `SELECT quantity::TEXT, unit, period_start, period_end, COALESCE(meter_id, '') FROM usage_readings WHERE bill_id = $1 ORDER BY position`
+	rows, err = r.db.QueryContext(ctx, query, bill.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reading domain.UsageReading
+		if err := rows.Scan(&reading.Quantity, &reading.Unit, &reading.PeriodStart, &reading.PeriodEnd, &reading.MeterID); err != nil {
+			return err
+		}
+		bill.Usage = append(bill.Usage, reading)
+	}
+	return rows.Err()
+}
+
+// recordStatusChange appends a change of a bill's status to its history. An
+// empty from records the status the bill was created with.
+func (r *PostgresRepository) recordStatusChange(ctx context.Context, billID string, from, to domain.BillStatus, source string, at time.Time) error {
+	query := `INSERT INTO bill_status_history (id, bill_id, from_status, to_status, source, changed_at)
+              VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)`
+	_, err := r.db.ExecContext(ctx, query, uuid.New().String(), billID, from, to, source, at)
 	return err
 }
 
 // SaveBill saves a bill
 func (r *PostgresRepository) SaveBill(ctx context.Context, bill domain.Bill) error {
-	query := `INSERT INTO bills (id, linked_account_id, provider_id, amount, due_date, status, bill_date, created_at, updated_at)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT DO NOTHING`
-	_, err := r.db.ExecContext(ctx, query, bill.ID, bill.LinkedAccountID, bill.ProviderID, bill.Amount, bill.DueDate, bill.Status, bill.BillDate, time.Now(), time.Now())
+	if bill.ExternalID == "" {
+		bill.ExternalID = bill.ID
+	}
+	query := `INSERT INTO bills (id, external_id, linked_account_id, provider_id, amount_minor, currency, due_date, status, bill_date, created_at, updated_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) ON CONFLICT DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, bill.ID, bill.ExternalID, bill.LinkedAccountID, bill.ProviderID, bill.Amount.Minor, bill.Amount.Currency, bill.DueDate, bill.Status, bill.BillDate, time.Now(), time.Now())
 	return err
 }
 
+// UpsertBills inserts new bills and updates the amount, due date, status,
+// line items and usage of changed ones in a single transaction. The bill date of a stored bill is kept
+// and bills previously marked missing are restored. A status the stored bill
+// cannot move to is not applied, and the bill keeps its stored status.
+func (r *PostgresRepository) UpsertBills(ctx context.Context, bills []*domain.Bill) (*domain.BillUpsertResult, error) {
+	result := &domain.BillUpsertResult{}
+	err := r.transaction(ctx, func(tx *PostgresRepository) error {
+		for _, bill := range bills {
+			if bill.ExternalID == "" {
+				return fmt.Errorf("bill for linked account %s has no external id", bill.LinkedAccountID)
+			}
+
+			var stored domain.BillStatus
+			var storedDigest string
+			query := `SELECT status, details_digest FROM bills WHERE linked_account_id = $1 AND external_id = $2 FOR UPDATE`
+			err := tx.db.QueryRowContext(ctx, query, bill.LinkedAccountID, bill.ExternalID).Scan(&stored, &storedDigest)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if stored != "" && !stored.CanTransitionTo(bill.Status) {
+				bill.Status = stored
+			}
+
+			// The conditional DO UPDATE returns no row when nothing changed, and
+			// xmax is 0 only for freshly inserted rows
+			var inserted bool
+			now := time.Now()
+			digest := bill.DetailsDigest()
+			err = tx.db.QueryRowContext(ctx, `
+				INSERT INTO bills (id, external_id, linked_account_id, provider_id, amount_minor, currency, due_date, status, bill_date, details_digest, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+				ON CONFLICT (linked_account_id, external_id) DO UPDATE
+				SET amount_minor = EXCLUDED.amount_minor, currency = EXCLUDED.currency, due_date = EXCLUDED.due_date, status = EXCLUDED.status, details_digest = EXCLUDED.details_digest, missing_since = NULL, updated_at = EXCLUDED.updated_at
+				WHERE (bills.amount_minor, bills.currency, bills.due_date, bills.status, bills.details_digest) IS DISTINCT FROM (EXCLUDED.amount_minor, EXCLUDED.currency, EXCLUDED.due_date, EXCLUDED.status, EXCLUDED.details_digest)
+					OR bills.missing_since IS NOT NULL
+				RETURNING id, xmax = 0
+			`,
+				uuid.New().String(),
+				bill.ExternalID,
+				bill.LinkedAccountID,
+				bill.ProviderID,
+				bill.Amount.Minor,
+				bill.Amount.Currency,
+				bill.DueDate,
+				bill.Status,
+				bill.BillDate,
+				digest,
+				now,
+			).Scan(&bill.ID, &inserted)
+
+			switch {
+			case err == sql.ErrNoRows:
+				query := `SELECT id FROM bills WHERE linked_account_id = $1 AND external_id = $2`
+				if err := tx.db.QueryRowContext(ctx, query, bill.LinkedAccountID, bill.ExternalID).Scan(&bill.ID); err != nil {
+					return err
+				}
+				result.Unchanged++
+				continue
+			case err != nil:
+				return err
+			case inserted:
+				result.Inserted++
+			default:
+				result.Updated++
+			}
+
+			if inserted || stored != bill.Status {
+				if err := tx.recordStatusChange(ctx, bill.ID, stored, bill.Status, domain.BillStatusSourceProvider, now); err != nil {
+					return err
+				}
+			}
+			if inserted || storedDigest != digest {
+				if err := tx.replaceBillDetails(ctx, bill); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MarkOverdueBills moves the bills still due whose due date is before now to
+// overdue and records the changes. Rows are locked before they are updated,
+// so concurrent calls never move or record the same bill twice.
+func (r *PostgresRepository) MarkOverdueBills(ctx context.Context, now time.Time) (int, error) {
+	query := `
+		WITH due AS (
+			SELECT id, status FROM bills
+			WHERE status IN ('issued', 'unpaid', 'partially_paid') AND due_date < $1 AND missing_since IS NULL
+			FOR UPDATE
+		), overdue AS (
+			UPDATE bills SET status = 'overdue', updated_at = $1
+			FROM due WHERE bills.id = due.id
+			RETURNING bills.id, due.status
+		)
+		INSERT INTO bill_status_history (id, bill_id, from_status, to_status, source, changed_at)
+		SELECT gen_random_uuid()::text, id, status, 'overdue', $2, $1 FROM overdue
+	`
+	res, err := r.db.ExecContext(ctx, query, now, domain.BillStatusSourceSystem)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// MarkMissingBills flags the bills of a linked account due within from and to
+// that the provider no longer returns. Bills outside the window the provider
+// answered for are left alone. It returns the number of bills newly marked.
+func (r *PostgresRepository) MarkMissingBills(ctx context.Context, linkedAccountID string, seenExternalIDs []string, from, to time.Time) (int, error) {
+	query := `UPDATE bills SET missing_since = $1, updated_at = $1
+              WHERE linked_account_id = $2 AND missing_since IS NULL AND due_date BETWEEN $4 AND $5 AND NOT (external_id = ANY($3))`
+	res, err := r.db.ExecContext(ctx, query, time.Now(), linkedAccountID, pq.Array(seenExternalIDs), from, to)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
 // DeleteBill deletes a bill
 func (r *PostgresRepository) DeleteBill(ctx context.Context, id string) error {
 	query := `DELETE FROM bills WHERE id = $1`
@@ -206,13 +503,18 @@ func (r *PostgresRepository) DeleteBill(ctx context.Context, id string) error {
 
 // CreateProvider creates a new provider
 func (r *PostgresRepository) CreateProvider(ctx context.Context, provider *domain.Provider) error {
-	query := `INSERT INTO providers (id, name, api_endpoint, auth_type, created_at, updated_at)
-              VALUES ($1, $2, $3, $4, $5, $6)`
+	query := `INSERT INTO providers (id, name, api_endpoint, auth_type, auth_config, refresh_cadence, rate_limit_per_minute, rate_limit_burst, category, created_at, updated_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
 	_, err := r.db.ExecContext(ctx, query,
 		provider.ID,
 		provider.Name,
 		provider.APIEndpoint,
 		provider.AuthType,
+		provider.AuthConfig,
+		provider.RefreshCadence,
+		provider.RateLimitPerMinute,
+		provider.RateLimitBurst,
+		provider.Category,
 		time.Now(),
 		time.Now(),
 	)
@@ -226,55 +528,84 @@ func (r *PostgresRepository) DeleteProvider(ctx context.Context, id string) erro
 	return err
 }
 
+// GetBillByID returns a bill with its line items and usage, or nil when it
+// does not exist
 func (r *PostgresRepository) GetBillByID(ctx context.Context, id string) (*domain.Bill, error) {
 	query := `
-		SELECT id, linked_account_id, provider_id, amount, due_date,
-			status, bill_date, created_at, updated_at
+		SELECT id, external_id, linked_account_id, provider_id, amount_minor, currency, due_date,
+			status, bill_date, missing_since, created_at, updated_at
 		FROM bills
 		WHERE id = $1
 	`
 	bill := &domain.Bill{}
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&bill.ID,
+		&bill.ExternalID,
 		&bill.LinkedAccountID,
 		&bill.ProviderID,
-		&bill.Amount,
+		&bill.Amount.Minor,
+		&bill.Amount.Currency,
 		&bill.DueDate,
 		&bill.Status,
 		&bill.BillDate,
+		&bill.MissingSince,
 		&bill.CreatedAt,
 		&bill.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return bill, err
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadBillDetails(ctx, bill); err != nil {
+		return nil, err
+	}
+	return bill, nil
 }
 
+// GetBillSummaryByUserID counts the bills of a user and totals the amounts
+// still due per currency
 func (r *PostgresRepository) GetBillSummaryByUserID(ctx context.Context, userID string) (*domain.BillSummary, error) {
 	query := `
-		SELECT 
+		SELECT b.currency,
 			COUNT(*) as bill_count,
-			COALESCE(SUM(CASE WHEN b.status IN ('unpaid', 'overdue') THEN b.amount ELSE 0 END), 0) as total_due
+			COUNT(*) FILTER (WHERE b.status IN ('issued', 'unpaid', 'partially_paid', 'overdue')) as due_count,
+			COALESCE(SUM(b.amount_minor) FILTER (WHERE b.status IN ('issued', 'unpaid', 'partially_paid', 'overdue')), 0) as total_due
 		FROM bills b
 		JOIN linked_accounts la ON b.linked_account_id = la.id
 		WHERE la.user_id = $1
+		GROUP BY b.currency
+		ORDER BY b.currency
 	`
-	summary := &domain.BillSummary{}
-	err := r.db.QueryRowContext(ctx, query, userID).Scan(
-		&summary.BillCount,
-		&summary.TotalDue,
-	)
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	summary := &domain.BillSummary{TotalDue: []domain.Money{}}
+	for rows.Next() {
+		var count, dueCount int
+		var total domain.Money
+		if err := rows.Scan(&total.Currency, &count, &dueCount, &total.Minor); err != nil {
+			return nil, err
+		}
+		summary.BillCount += count
+		if dueCount > 0 {
+			summary.TotalDue = append(summary.TotalDue, total)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return summary, nil
 }
 
 func (r *PostgresRepository) GetBillsByLinkedAccountID(ctx context.Context, linkedAccountID string) ([]*domain.Bill, error) {
 	query := `
-		SELECT id, linked_account_id, provider_id, amount, due_date,
-			status, bill_date, created_at, updated_at
+		SELECT id, external_id, linked_account_id, provider_id, amount_minor, currency, due_date,
+			status, bill_date, missing_since, created_at, updated_at
 		FROM bills
 		WHERE linked_account_id = $1
 		ORDER BY due_date DESC
@@ -290,12 +621,15 @@ func (r *PostgresRepository) GetBillsByLinkedAccountID(ctx context.Context, link
 		bill := &domain.Bill{}
 		err := rows.Scan(
 			&bill.ID,
+			&bill.ExternalID,
 			&bill.LinkedAccountID,
 			&bill.ProviderID,
-			&bill.Amount,
+			&bill.Amount.Minor,
+			&bill.Amount.Currency,
 			&bill.DueDate,
 			&bill.Status,
 			&bill.BillDate,
+			&bill.MissingSince,
 			&bill.CreatedAt,
 			&bill.UpdatedAt,
 		)
@@ -309,8 +643,8 @@ func (r *PostgresRepository) GetBillsByLinkedAccountID(ctx context.Context, link
 
 func (r *PostgresRepository) GetBillsByUserID(ctx context.Context, userID string) ([]*domain.Bill, error) {
 	query := `
-		SELECT b.id, b.linked_account_id, b.provider_id, b.amount, b.due_date,
-			b.status, b.bill_date, b.created_at, b.updated_at
+		SELECT b.id, b.external_id, b.linked_account_id, b.provider_id, b.amount_minor, b.currency, b.due_date,
+			b.status, b.bill_date, b.missing_since, b.created_at, b.updated_at
 		FROM bills b
 		JOIN linked_accounts la ON b.linked_account_id = la.id
 		WHERE la.user_id = $1
@@ -327,12 +661,15 @@ func (r *PostgresRepository) GetBillsByUserID(ctx context.Context, userID string
 		bill := &domain.Bill{}
 		err := rows.Scan(
 			&bill.ID,
+			&bill.ExternalID,
 			&bill.LinkedAccountID,
 			&bill.ProviderID,
-			&bill.Amount,
+			&bill.Amount.Minor,
+			&bill.Amount.Currency,
 			&bill.DueDate,
 			&bill.Status,
 			&bill.BillDate,
+			&bill.MissingSince,
 			&bill.CreatedAt,
 			&bill.UpdatedAt,
 		)
@@ -344,10 +681,281 @@ func (r *PostgresRepository) GetBillsByUserID(ctx context.Context, userID string
 	return bills, rows.Err()
 }
 
+// billSortColumns are the columns bill searches sort on
+var billSortColumns = map[string]string{
+	domain.BillSortDueDate:  "b.due_date",
+	domain.BillSortAmount:   "b.amount_minor",
+	domain.BillSortBillDate: "b.bill_date",
+}
+
+// billCursor is the position of the last bill of a page: its sort value and
+// id. It names the sort order so it cannot be replayed against another one.
+type billCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeBillCursor(sort string, bill *domain.Bill) string {
+	cursor := billCursor{Sort: sort, ID: bill.ID}
+	switch strings.TrimPrefix(sort, "-") {
+	case domain.BillSortAmount:
+		cursor.Value = strconv.FormatInt(bill.Amount.Minor, 10)
+	case domain.BillSortBillDate:
+		cursor.Value = bill.BillDate.Format(time.RFC3339Nano)
+	default:
+		cursor.Value = bill.DueDate.Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeBillCursor returns the sort value and id encoded in value
+func decodeBillCursor(value, sort string) (interface{}, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, "", domain.ErrInvalidCursor
+	}
+	var cursor billCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sort || cursor.ID == "" {
+		return nil, "", domain.ErrInvalidCursor
+	}
+	if strings.TrimPrefix(sort, "-") == domain.BillSortAmount {
+		minor, err := strconv.ParseInt(cursor.Value, 10, 64)
+		if err != nil {
+			return nil, "", domain.ErrInvalidCursor
+		}
+		return minor, cursor.ID, nil
+	}
+	at, err := time.Parse(time.RFC3339Nano, cursor.Value)
+	if err != nil {
+		return nil, "", domain.ErrInvalidCursor
+	}
+	return at, cursor.ID, nil
+}
+
+// SearchBills returns a page of the bills of a user matching q. Pages are
+// keyed on the sort column and id so that bills stored between requests do
+// not shift the next page.
+func (r *PostgresRepository) SearchBills(ctx context.Context, q domain.BillQuery) (*domain.BillPage, error) {
+	field, desc := q.SortOrder()
+	column, ok := billSortColumns[field]
+	if !ok {
+		return nil, fmt.Errorf("invalid bill sort: %q", q.Sort)
+	}
+	sort := field
+	if desc {
+		sort = "-" + field
+	}
+
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conditions := []string{"la.user_id = " + arg(q.UserID), "b.missing_since IS NULL"}
+	if len(q.Statuses) > 0 {
+		statuses := make([]string, len(q.Statuses))
+		for i, status := range q.Statuses {
+			statuses[i] = string(status)
+		}
+		conditions = append(conditions, "b.status = ANY("+arg(pq.Array(statuses))+")")
+	}
+	if q.ProviderID != "" {
+		conditions = append(conditions, "b.provider_id = "+arg(q.ProviderID))
+	}
+	if q.DueFrom != nil {
+		conditions = append(conditions, "b.due_date >= "+arg(*q.DueFrom))
+	}
+	if q.DueTo != nil {
+		conditions = append(conditions, "b.due_date < "+arg(*q.DueTo))
+	}
+	if q.Currency != "" {
+		conditions = append(conditions, "b.currency = "+arg(q.Currency))
+	}
+	if q.MinAmount != nil {
+		conditions = append(conditions, "b.amount_minor >= "+arg(*q.MinAmount))
+	}
+	if q.MaxAmount != nil {
+		conditions = append(conditions, "b.amount_minor <= "+arg(*q.MaxAmount))
+	}
+
+	direction, after := "ASC", ">"
+	if desc {
+		direction, after = "DESC", "<"
+	}
+	if q.Cursor != "" {
+		value, id, err := decodeBillCursor(q.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, b.id) %s (%s, %s)", column, after, arg(value), arg(id)))
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = domain.DefaultBillPageSize
+	}
+	// One bill more than the page tells whether there is a next page
+	query := fmt.Sprintf(`
+		SELECT b.id, b.external_id, b.linked_account_id, b.provider_id, b.amount_minor, b.currency, b.due_date,
+			b.status, b.bill_date, b.missing_since, b.created_at, b.updated_at
+		FROM bills b
+		JOIN linked_accounts la ON b.linked_account_id = la.id
+		WHERE %s
+		ORDER BY %s %s, b.id %s
+		LIMIT %s
+	`, strings.Join(conditions, " AND "), column, direction, direction, arg(limit+1))
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &domain.BillPage{Bills: []*domain.Bill{}}
+	for rows.Next() {
+		bill := &domain.Bill{}
+		err := rows.Scan(
+			&bill.ID,
+			&bill.ExternalID,
+			&bill.LinkedAccountID,
+			&bill.ProviderID,
+			&bill.Amount.Minor,
+			&bill.Amount.Currency,
+			&bill.DueDate,
+			&bill.Status,
+			&bill.BillDate,
+			&bill.MissingSince,
+			&bill.CreatedAt,
+			&bill.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		page.Bills = append(page.Bills, bill)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Bills) > limit {
+		page.Bills = page.Bills[:limit]
+		page.NextCursor = encodeBillCursor(sort, page.Bills[limit-1])
+	}
+	return page, nil
+}
+
+// spendingFilter selects the bills of a user due in a window that spending
+// insights count. bill_date is when a bill was first fetched, so bills are
+// counted by due date; cancelled bills were never owed and missing ones were
+// withdrawn by the provider.
+const spendingFilter = `la.user_id = $1 AND b.due_date >= $2 AND b.due_date < $3 AND b.status <> 'cancelled' AND b.missing_since IS NULL`
+
+// GetSpendingAggregates totals the bills of q by month of their due date per
+// provider, per utility category and overall, and finds the linked account
+// whose bills grew the most from one month to the next
+func (r *PostgresRepository) GetSpendingAggregates(ctx context.Context, q domain.SpendingQuery) (*domain.SpendingAggregates, error) {
+	aggregates := &domain.SpendingAggregates{}
+
+	query := `
+		SELECT date_trunc('month', b.due_date),
+			COALESCE(b.provider_id, ''), COALESCE(p.name, ''), COALESCE(p.category, ''),
+			SUM(b.amount_minor), COUNT(*)
+		FROM bills b
+		JOIN linked_accounts la ON b.linked_account_id = la.id
+		JOIN providers p ON p.id = b.provider_id
+		WHERE ` + spendingFilter + ` AND b.currency = $4
+		GROUP BY GROUPING SETS (
+			(date_trunc('month', b.due_date), b.provider_id, p.name, p.category),
+			(date_trunc('month', b.due_date), p.category),
+			(date_trunc('month', b.due_date))
+		)
+		ORDER BY 1
+	`
+	rows, err := r.db.QueryContext(ctx, query, q.UserID, q.From, q.To, q.Currency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var total domain.SpendingTotal
+		if err := rows.Scan(&total.Month, &total.ProviderID, &total.ProviderName, &total.Category, &total.Minor, &total.BillCount); err != nil {
+			return nil, err
+		}
+		aggregates.Totals = append(aggregates.Totals, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Monthly totals per linked account, compared with the month before
+	query = `
+		WITH monthly AS (
+			SELECT b.linked_account_id, b.provider_id, date_trunc('month', b.due_date) AS month,
+				SUM(b.amount_minor) AS total,
+				(array_agg(b.id ORDER BY b.due_date DESC, b.id DESC))[1] AS bill_id
+			FROM bills b
+			JOIN linked_accounts la ON b.linked_account_id = la.id
+			WHERE ` + spendingFilter + ` AND b.currency = $4
+			GROUP BY b.linked_account_id, b.provider_id, date_trunc('month', b.due_date)
+		), changes AS (
+			SELECT *,
+				LAG(total) OVER (PARTITION BY linked_account_id ORDER BY month) AS previous,
+				LAG(month) OVER (PARTITION BY linked_account_id ORDER BY month) AS previous_month
+			FROM monthly
+		)
+		SELECT c.bill_id, c.linked_account_id, c.provider_id, p.name, c.month, c.previous, c.total
+		FROM changes c
+		JOIN providers p ON p.id = c.provider_id
+		WHERE c.previous_month = c.month - INTERVAL '1 month' AND c.total > c.previous
+		ORDER BY c.total - c.previous DESC, c.month DESC
+		LIMIT 1
+	`
+	growth := &domain.SpendingGrowth{}
+	err = r.db.QueryRowContext(ctx, query, q.UserID, q.From, q.To, q.Currency).Scan(
+		&growth.BillID,
+		&growth.LinkedAccountID,
+		&growth.ProviderID,
+		&growth.ProviderName,
+		&growth.Month,
+		&growth.Previous,
+		&growth.Current,
+	)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		aggregates.TopGrowth = growth
+	}
+
+	query = `
+		SELECT DISTINCT b.currency
+		FROM bills b
+		JOIN linked_accounts la ON b.linked_account_id = la.id
+		WHERE ` + spendingFilter + `
+		ORDER BY b.currency
+	`
+	rows, err = r.db.QueryContext(ctx, query, q.UserID, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currency string
+		if err := rows.Scan(&currency); err != nil {
+			return nil, err
+		}
+		aggregates.Currencies = append(aggregates.Currencies, currency)
+	}
+	return aggregates, rows.Err()
+}
+
 func (r *PostgresRepository) GetLinkedAccountByID(ctx context.Context, id string) (*domain.LinkedAccount, error) {
 	query := `
 		SELECT id, user_id, provider_id, account_id, credentials,
-			status, created_at, updated_at
+			status, created_at, updated_at, credentials_key_version,
+			last_attempt_at, last_success_at, consecutive_failures, last_error,
+			next_scheduled_at
 		FROM linked_accounts
 		WHERE id = $1
 	`
@@ -361,6 +969,12 @@ func (r *PostgresRepository) GetLinkedAccountByID(ctx context.Context, id string
 		&account.Status,
 		&account.CreatedAt,
 		&account.UpdatedAt,
+		&account.CredentialsKeyVersion,
+		&account.Sync.LastAttemptAt,
+		&account.Sync.LastSuccessAt,
+		&account.Sync.ConsecutiveFailures,
+		&account.Sync.LastError,
+		&account.Sync.NextScheduledAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -371,7 +985,9 @@ func (r *PostgresRepository) GetLinkedAccountByID(ctx context.Context, id string
 func (r *PostgresRepository) GetLinkedAccountsByProviderID(ctx context.Context, providerID string) ([]*domain.LinkedAccount, error) {
 	query := `
 		SELECT id, user_id, provider_id, account_id, credentials,
-			status, created_at, updated_at
+			status, created_at, updated_at, credentials_key_version,
+			last_attempt_at, last_success_at, consecutive_failures, last_error,
+			next_scheduled_at
 		FROM linked_accounts
 		WHERE provider_id = $1
 		ORDER BY created_at DESC
@@ -394,6 +1010,12 @@ func (r *PostgresRepository) GetLinkedAccountsByProviderID(ctx context.Context,
 			&account.Status,
 			&account.CreatedAt,
 			&account.UpdatedAt,
+			&account.CredentialsKeyVersion,
+			&account.Sync.LastAttemptAt,
+			&account.Sync.LastSuccessAt,
+			&account.Sync.ConsecutiveFailures,
+			&account.Sync.LastError,
+			&account.Sync.NextScheduledAt,
 		)
 		if err != nil {
 			return nil, err
@@ -406,7 +1028,9 @@ func (r *PostgresRepository) GetLinkedAccountsByProviderID(ctx context.Context,
 func (r *PostgresRepository) GetLinkedAccountsByUserID(ctx context.Context, userID string) ([]*domain.LinkedAccount, error) {
 	query := `
 		SELECT id, user_id, provider_id, account_id, credentials,
-			status, created_at, updated_at
+			status, created_at, updated_at, credentials_key_version,
+			last_attempt_at, last_success_at, consecutive_failures, last_error,
+			next_scheduled_at
 		FROM linked_accounts
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -429,6 +1053,12 @@ func (r *PostgresRepository) GetLinkedAccountsByUserID(ctx context.Context, user
 			&account.Status,
 			&account.CreatedAt,
 			&account.UpdatedAt,
+			&account.CredentialsKeyVersion,
+			&account.Sync.LastAttemptAt,
+			&account.Sync.LastSuccessAt,
+			&account.Sync.ConsecutiveFailures,
+			&account.Sync.LastError,
+			&account.Sync.NextScheduledAt,
 		)
 		if err != nil {
 			return nil, err
@@ -440,7 +1070,7 @@ func (r *PostgresRepository) GetLinkedAccountsByUserID(ctx context.Context, user
 
 func (r *PostgresRepository) GetProviderByID(ctx context.Context, id string) (*domain.Provider, error) {
 	query := `
-		SELECT id, name, api_endpoint, auth_type, created_at, updated_at
+		SELECT id, name, api_endpoint, auth_type, auth_config, refresh_cadence, rate_limit_per_minute, rate_limit_burst, category, created_at, updated_at
 		FROM providers
 		WHERE id = $1
 	`
@@ -450,6 +1080,11 @@ func (r *PostgresRepository) GetProviderByID(ctx context.Context, id string) (*d
 		&provider.Name,
 		&provider.APIEndpoint,
 		&provider.AuthType,
+		&provider.AuthConfig,
+		&provider.RefreshCadence,
+		&provider.RateLimitPerMinute,
+		&provider.RateLimitBurst,
+		&provider.Category,
 		&provider.CreatedAt,
 		&provider.UpdatedAt,
 	)
@@ -461,7 +1096,7 @@ func (r *PostgresRepository) GetProviderByID(ctx context.Context, id string) (*d
 
 func (r *PostgresRepository) GetProviderByName(ctx context.Context, name string) (*domain.Provider, error) {
 	query := `
-		SELECT id, name, api_endpoint, auth_type, created_at, updated_at
+		SELECT id, name, api_endpoint, auth_type, auth_config, refresh_cadence, rate_limit_per_minute, rate_limit_burst, category, created_at, updated_at
 		FROM providers
 		WHERE name = $1
 	`
@@ -471,6 +1106,11 @@ func (r *PostgresRepository) GetProviderByName(ctx context.Context, name string)
 		&provider.Name,
 		&provider.APIEndpoint,
 		&provider.AuthType,
+		&provider.AuthConfig,
+		&provider.RefreshCadence,
+		&provider.RateLimitPerMinute,
+		&provider.RateLimitBurst,
+		&provider.Category,
 		&provider.CreatedAt,
 		&provider.UpdatedAt,
 	)
@@ -481,7 +1121,7 @@ func (r *PostgresRepository) GetProviderByName(ctx context.Context, name string)
 }
 
 func (r *PostgresRepository) ListProviders(ctx context.Context) ([]*domain.Provider, error) {
-	query := `SELECT id, name, api_endpoint, auth_type, created_at, updated_at FROM providers ORDER BY name`
+	query := `SELECT id, name, api_endpoint, auth_type, auth_config, refresh_cadence, rate_limit_per_minute, rate_limit_burst, category, created_at, updated_at FROM providers ORDER BY name`
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
@@ -496,6 +1136,11 @@ func (r *PostgresRepository) ListProviders(ctx context.Context) ([]*domain.Provi
 			&provider.Name,
 			&provider.APIEndpoint,
 			&provider.AuthType,
+			&provider.AuthConfig,
+			&provider.RefreshCadence,
+			&provider.RateLimitPerMinute,
+			&provider.RateLimitBurst,
+			&provider.Category,
 			&provider.CreatedAt,
 			&provider.UpdatedAt,
 		)
@@ -507,23 +1152,123 @@ func (r *PostgresRepository) ListProviders(ctx context.Context) ([]*domain.Provi
 	return providers, rows.Err()
 }
 
+// UpdateBill updates a bill, returning domain.ErrInvalidBillTransition when
+// its stored status cannot move to the new one
 func (r *PostgresRepository) UpdateBill(ctx context.Context, bill *domain.Bill) error {
-	query := `UPDATE bills SET amount = $1, due_date = $2, status = $3, bill_date = $4, updated_at = $5 WHERE id = $6`
-	_, err := r.db.ExecContext(ctx, query,
-		bill.Amount,
-		bill.DueDate,
-		bill.Status,
-		bill.BillDate,
-		time.Now(),
-		bill.ID,
-	)
+	return r.transaction(ctx, func(tx *PostgresRepository) error {
+		var stored domain.BillStatus
+		err := tx.db.QueryRowContext(ctx, `SELECT status FROM bills WHERE id = $1 FOR UPDATE`, bill.ID).Scan(&stored)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !stored.CanTransitionTo(bill.Status) {
+			return fmt.Errorf("%w: bill %s from %s to %s", domain.ErrInvalidBillTransition, bill.ID, stored, bill.Status)
+		}
+
+		now := time.Now()
+		query := `UPDATE bills SET amount_minor = $1, currency = $2, due_date = $3, status = $4, bill_date = $5, updated_at = $6 WHERE id = $7`
+		_, err = tx.db.ExecContext(ctx, query,
+			bill.Amount.Minor,
+			bill.Amount.Currency,
+			bill.DueDate,
+			bill.Status,
+			bill.BillDate,
+			now,
+			bill.ID,
+		)
+		if err != nil || stored == bill.Status {
+			return err
+		}
+		return tx.recordStatusChange(ctx, bill.ID, stored, bill.Status, domain.BillStatusSourceSystem, now)
+	})
+}
+
+// RecordSyncSuccess marks a linked account active and synced at at without
+// touching its credentials
+func (r *PostgresRepository) RecordSyncSuccess(ctx context.Context, id string, at time.Time) error {
+	query := `UPDATE linked_accounts SET status = 'active', last_attempt_at = $1, last_success_at = $1,
+              consecutive_failures = 0, last_error = '', updated_at = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, at, time.Now(), id)
+	return err
+}
+
+// RecordSyncFailure sets the status of a linked account after a failed sync and counts the failure
+func (r *PostgresRepository) RecordSyncFailure(ctx context.Context, id string, at time.Time, status, cause string) error {
+	query := `UPDATE linked_accounts SET status = $1, last_attempt_at = $2,
+              consecutive_failures = consecutive_failures + 1, last_error = $3, updated_at = $4 WHERE id = $5`
+	_, err := r.db.ExecContext(ctx, query, status, at, cause, time.Now(), id)
+	return err
+}
+
+// ListDueLinkedAccounts returns the active or failing linked accounts due for a scheduled
+// refresh. A user's cadence overrides the cadence of their providers.
+func (r *PostgresRepository) ListDueLinkedAccounts(ctx context.Context, now time.Time, limit int) ([]*domain.ScheduledAccount, error) {
+	query := `
+		SELECT la.id, la.user_id, la.provider_id, la.account_id, la.credentials,
+			la.status, la.created_at, la.updated_at, la.credentials_key_version,
+			la.last_attempt_at, la.last_success_at, la.consecutive_failures, la.last_error,
+			la.next_scheduled_at,
+			COALESCE(u.refresh_cadence, p.refresh_cadence)
+		FROM linked_accounts la
+		JOIN providers p ON p.id = la.provider_id
+		JOIN users u ON u.id = la.user_id
+		WHERE la.status IN ('active', 'error') AND (la.next_scheduled_at IS NULL OR la.next_scheduled_at <= $1)
+		ORDER BY la.next_scheduled_at NULLS FIRST
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*domain.ScheduledAccount
+	for rows.Next() {
+		account := &domain.ScheduledAccount{}
+		err := rows.Scan(
+			&account.ID,
+			&account.UserID,
+			&account.ProviderID,
+			&account.AccountID,
+			&account.Credentials,
+			&account.Status,
+			&account.CreatedAt,
+			&account.UpdatedAt,
+			&account.CredentialsKeyVersion,
+			&account.Sync.LastAttemptAt,
+			&account.Sync.LastSuccessAt,
+			&account.Sync.ConsecutiveFailures,
+			&account.Sync.LastError,
+			&account.Sync.NextScheduledAt,
+			&account.Cadence,
+		)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// ScheduleLinkedAccount sets when a linked account is refreshed next
+func (r *PostgresRepository) ScheduleLinkedAccount(ctx context.Context, id string, next time.Time) error {
+	query := `UPDATE linked_accounts SET next_scheduled_at = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, next, id)
 	return err
 }
 
 func (r *PostgresRepository) UpdateLinkedAccount(ctx context.Context, account *domain.LinkedAccount) error {
-	query := `UPDATE linked_accounts SET credentials = $1, status = $2, updated_at = $3 WHERE id = $4`
-	_, err := r.db.ExecContext(ctx, query,
-		account.Credentials,
+	credentials, keyVersion, err := r.sealCredentials(account)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE linked_accounts SET credentials = $1, credentials_key_version = $2, status = $3, updated_at = $4 WHERE id = $5`
+	_, err = r.db.ExecContext(ctx, query,
+		credentials,
+		keyVersion,
 		account.Status,
 		time.Now(),
 		account.ID,
@@ -531,14 +1276,129 @@ func (r *PostgresRepository) UpdateLinkedAccount(ctx context.Context, account *d
 	return err
 }
 
+// ReencryptCredentials re-seals the credentials of every linked account with
+// target, including rows sealed in the v1 format that is not bound to the
+// account. Rows are opened with the repository vault, which must still hold
+// the keys they were sealed under. It returns the number of rows rewritten.
+func (r *PostgresRepository) ReencryptCredentials(ctx context.Context, target ports.CredentialVault) (int, error) {
+	var count int
+	err := r.transaction(ctx, func(tx *PostgresRepository) error {
+		rows, err := tx.db.QueryContext(ctx, `
+			SELECT id, credentials, credentials_key_version
+			FROM linked_accounts
+			WHERE credentials_key_version <> $1 OR credentials LIKE 'vault:v1:%'
+			FOR UPDATE
+		`, target.KeyVersion())
+		if err != nil {
+			return err
+		}
+
+		var accounts []domain.LinkedAccount
+		for rows.Next() {
+			var account domain.LinkedAccount
+			if err := rows.Scan(&account.ID, &account.Credentials, &account.CredentialsKeyVersion); err != nil {
+				rows.Close()
+				return err
+			}
+			accounts = append(accounts, account)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, account := range accounts {
+			plaintext := account.Credentials
+			if account.CredentialsKeyVersion > 0 {
+				if r.vault == nil {
+					return fmt.Errorf("account %s: no vault to open credentials", account.ID)
+				}
+				if plaintext, err = r.vault.Open(account.Credentials, account.CredentialsKeyVersion, account.ID); err != nil {
+					return fmt.Errorf("account %s: %w", account.ID, err)
+				}
+			}
+
+			sealed, keyVersion, err := target.Seal(plaintext, account.ID)
+			if err != nil {
+				return fmt.Errorf("account %s: %w", account.ID, err)
+			}
+
+			query := `UPDATE linked_accounts SET credentials = $1, credentials_key_version = $2 WHERE id = $3`
+			if _, err := tx.db.ExecContext(ctx, query, sealed, keyVersion, account.ID); err != nil {
+				return err
+			}
+		}
+
+		count = len(accounts)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 func (r *PostgresRepository) UpdateProvider(ctx context.Context, provider *domain.Provider) error {
-	query := `UPDATE providers SET name = $1, api_endpoint = $2, auth_type = $3, updated_at = $4 WHERE id = $5`
+	query := `UPDATE providers SET name = $1, api_endpoint = $2, auth_type = $3, auth_config = $4, refresh_cadence = $5, rate_limit_per_minute = $6, rate_limit_burst = $7, category = $8, updated_at = $9 WHERE id = $10`
 	_, err := r.db.ExecContext(ctx, query,
 		provider.Name,
 		provider.APIEndpoint,
 		provider.AuthType,
+		provider.AuthConfig,
+		provider.RefreshCadence,
+		provider.RateLimitPerMinute,
+		provider.RateLimitBurst,
+		provider.Category,
 		time.Now(),
 		provider.ID,
 	)
 	return err
 }
+
+// ExchangeRates returns the rates last saved through SaveExchangeRates, or
+// nil when none were
+func (r *PostgresRepository) ExchangeRates(ctx context.Context) (*domain.ExchangeRates, error) {
+	query := `SELECT currency, base, rate::TEXT, rate_date FROM exchange_rates ORDER BY currency`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates *domain.ExchangeRates
+	for rows.Next() {
+		var currency, base, rate string
+		var date time.Time
+		if err := rows.Scan(&currency, &base, &rate, &date); err != nil {
+			return nil, err
+		}
+		if rates == nil {
+			rates = &domain.ExchangeRates{Base: base, Date: date}
+		}
+		if err := rates.SetRate(currency, rate); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// SaveExchangeRates replaces the stored rates with rates in one transaction
+func (r *PostgresRepository) SaveExchangeRates(ctx context.Context, rates *domain.ExchangeRates) error {
+	return r.transaction(ctx, func(tx *PostgresRepository) error {
+		if _, err := tx.db.ExecContext(ctx, `DELETE FROM exchange_rates`); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO exchange_rates (currency, base, rate, rate_date, updated_at) VALUES ($1, $2, $3, $4, $5)`
+		now := time.Now()
+		for _, currency := range rates.Currencies() {
+			if _, err := tx.db.ExecContext(ctx, query, currency, rates.Base, rates.FormatRate(currency), rates.Date, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -3,72 +3,364 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/mel-ak/onetap-challenge/internal/domain"
 	"github.com/mel-ak/onetap-challenge/internal/ports"
 )
 
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type repository struct {
-	db *sql.DB
+	conn  *sql.DB
+	db    querier // conn, or tx inside a unit of work
+	tx    *sql.Tx
+	vault ports.CredentialVault
 }
 
-// NewRepository creates a new PostgreSQL repository
-func NewRepository(db *sql.DB) ports.Repository {
-	return &repository{db: db}
+// NewRepository creates a new PostgreSQL repository. Linked account
+// credentials are sealed with vault before they are written.
+func NewRepository(db *sql.DB, vault ports.CredentialVault) ports.Repository {
+	return &repository{conn: db, db: db, vault: vault}
+}
+
+// WithTx runs fn in a transaction that is committed when fn returns nil and
+// rolled back otherwise. Nested calls join the outer transaction.
+func (r *repository) WithTx(ctx context.Context, fn func(tx ports.Repository) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&repository{conn: r.conn, db: tx, tx: tx, vault: r.vault}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sealCredentials returns the credentials to store for account and their key
+// version. Credentials read back from the database are already sealed.
+func (r *repository) sealCredentials(account *domain.LinkedAccount) (string, int, error) {
+	if account.CredentialsKeyVersion > 0 || r.vault == nil {
+		return account.Credentials, account.CredentialsKeyVersion, nil
+	}
+	if account.ID == "" {
+		return "", 0, errors.New("linked account ID is required to seal its credentials")
+	}
+	return r.vault.Seal(account.Credentials, account.ID)
 }
 
 // Bill operations
 func (r *repository) CreateBill(ctx context.Context, bill *domain.Bill) error {
+	if bill.ExternalID == "" {
+		bill.ExternalID = bill.ID
+	}
 	query := `
 		INSERT INTO bills (
-			id, linked_account_id, provider_id, amount, due_date, 
-			status, bill_date, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			id, external_id, linked_account_id, provider_id, amount_minor, currency, due_date, 
+			status, bill_date, details_digest, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
-	_, err := r.db.ExecContext(ctx, query,
-		bill.ID,
-		bill.LinkedAccountID,
-		bill.ProviderID,
-		bill.Amount,
-		bill.DueDate,
-		bill.Status,
-		bill.BillDate,
-		time.Now(),
-		time.Now(),
-	)
+	return r.WithTx(ctx, func(txRepo ports.Repository) error {
+		tx := txRepo.(*repository)
+		now := time.Now()
+		_, err := tx.db.ExecContext(ctx, query,
+			bill.ID,
+			bill.ExternalID,
+			bill.LinkedAccountID,
+			bill.ProviderID,
+			bill.Amount.Minor,
+			bill.Amount.Currency,
+			bill.DueDate,
+			bill.Status,
+			bill.BillDate,
+			bill.DetailsDigest(),
+			now,
+			now,
+		)
+		if err != nil {
+			return err
+		}
+		if err := tx.replaceBillDetails(ctx, bill); err != nil {
+			return err
+		}
+		return tx.recordStatusChange(ctx, bill.ID, "", bill.Status, domain.BillStatusSourceSystem, now)
+	})
+}
+
+// replaceBillDetails replaces the stored line items and usage of a bill with
+// the bill's own
+func (r *repository) replaceBillDetails(ctx context.Context, bill *domain.Bill) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM bill_line_items WHERE bill_id = $1`, bill.ID); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM usage_readings WHERE bill_id = $1`, bill.ID); err != nil {
+		return err
+	}
+
+	for i, item := range bill.LineItems {
+		_, err := r.db.ExecContext(ctx, `
+			INSERT INTO bill_line_items (bill_id, position, description, category, amount_minor, currency)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+		`, bill.ID, i, item.Description, item.Category, item.Amount.Minor, item.Amount.Currency)
+		if err != nil {
+			return err
+		}
+	}
+	for i, reading := range bill.Usage {
+		_, err := r.db.ExecContext(ctx, `
+			INSERT INTO usage_readings (bill_id, position, quantity, unit, period_start, period_end, meter_id)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		`, bill.ID, i, reading.Quantity, reading.Unit, reading.PeriodStart, reading.PeriodEnd, reading.MeterID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadBillDetails reads the line items and usage of bill
+func (r *repository) loadBillDetails(ctx context.Context, bill *domain.Bill) error {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT description, COALESCE(category, ''), amount_minor, currency
+		FROM bill_line_items
+		WHERE bill_id = $1
+		ORDER BY position
+	`, bill.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item domain.BillLineItem
+		if err := rows.Scan(&item.Description, &item.Category, &item.Amount.Minor, &item.Amount.Currency); err != nil {
+			return err
+		}
+		bill.LineItems = append(bill.LineItems, item)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = r.db.QueryContext(ctx, `
+		SELECT quantity::TEXT, unit, period_start, period_end, COALESCE(meter_id, '')
+		FROM usage_readings
+		WHERE bill_id = $1
+		ORDER BY position
+	`, bill.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reading domain.UsageReading
+		if err := rows.Scan(&reading.Quantity, &reading.Unit, &reading.PeriodStart, &reading.PeriodEnd, &reading.MeterID); err != nil {
+			return err
+		}
+		bill.Usage = append(bill.Usage, reading)
+	}
+	return rows.Err()
+}
+
+// recordStatusChange appends a change of a bill's status to its history. An
+// empty from records the status the bill was created with.
+func (r *repository) recordStatusChange(ctx context.Context, billID string, from, to domain.BillStatus, source string, at time.Time) error {
+	query := `
+		INSERT INTO bill_status_history (id, bill_id, from_status, to_status, source, changed_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+	`
+	_, err := r.db.ExecContext(ctx, query, uuid.New().String(), billID, from, to, source, at)
 	return err
 }
 
+func (r *repository) UpsertBills(ctx context.Context, bills []*domain.Bill) (*domain.BillUpsertResult, error) {
+	query := `
+		INSERT INTO bills (
+			id, external_id, linked_account_id, provider_id, amount_minor, currency, due_date,
+			status, bill_date, details_digest, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+		ON CONFLICT (linked_account_id, external_id) DO UPDATE
+		SET amount_minor = EXCLUDED.amount_minor, currency = EXCLUDED.currency, due_date = EXCLUDED.due_date,
+			status = EXCLUDED.status, details_digest = EXCLUDED.details_digest, missing_since = NULL,
+			updated_at = EXCLUDED.updated_at
+		WHERE (bills.amount_minor, bills.currency, bills.due_date, bills.status, bills.details_digest)
+			IS DISTINCT FROM (EXCLUDED.amount_minor, EXCLUDED.currency, EXCLUDED.due_date, EXCLUDED.status, EXCLUDED.details_digest)
+			OR bills.missing_since IS NOT NULL
+		RETURNING id, xmax = 0
+	`
+
+	result := &domain.BillUpsertResult{}
+	err := r.WithTx(ctx, func(txRepo ports.Repository) error {
+		tx := txRepo.(*repository)
+		for _, bill := range bills {
+			if bill.ExternalID == "" {
+				return fmt.Errorf("bill for linked account %s has no external id", bill.LinkedAccountID)
+			}
+
+			// A status the stored bill cannot move to is not applied
+			var stored domain.BillStatus
+			var storedDigest string
+			err := tx.db.QueryRowContext(ctx, `
+				SELECT status, details_digest FROM bills WHERE linked_account_id = $1 AND external_id = $2
+				FOR UPDATE
+			`, bill.LinkedAccountID, bill.ExternalID).Scan(&stored, &storedDigest)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if stored != "" && !stored.CanTransitionTo(bill.Status) {
+				bill.Status = stored
+			}
+
+			var inserted bool
+			now := time.Now()
+			digest := bill.DetailsDigest()
+			err = tx.db.QueryRowContext(ctx, query,
+				uuid.New().String(),
+				bill.ExternalID,
+				bill.LinkedAccountID,
+				bill.ProviderID,
+				bill.Amount.Minor,
+				bill.Amount.Currency,
+				bill.DueDate,
+				bill.Status,
+				bill.BillDate,
+				digest,
+				now,
+			).Scan(&bill.ID, &inserted)
+
+			switch {
+			case err == sql.ErrNoRows:
+				// Unchanged bills are skipped by the conditional update
+				err = tx.db.QueryRowContext(ctx, `
+					SELECT id FROM bills WHERE linked_account_id = $1 AND external_id = $2
+				`, bill.LinkedAccountID, bill.ExternalID).Scan(&bill.ID)
+				if err != nil {
+					return err
+				}
+				result.Unchanged++
+				continue
+			case err != nil:
+				return err
+			case inserted:
+				result.Inserted++
+			default:
+				result.Updated++
+			}
+
+			if inserted || stored != bill.Status {
+				err := tx.recordStatusChange(ctx, bill.ID, stored, bill.Status, domain.BillStatusSourceProvider, now)
+				if err != nil {
+					return err
+				}
+			}
+			// Line items and usage are rewritten only when they changed
+			if inserted || storedDigest != digest {
+				if err := tx.replaceBillDetails(ctx, bill); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *repository) MarkOverdueBills(ctx context.Context, now time.Time) (int, error) {
+	// Rows are locked before the update so concurrent calls never move or
+	// record the same bill twice
+	query := `
+		WITH due AS (
+			SELECT id, status FROM bills
+			WHERE status IN ('issued', 'unpaid', 'partially_paid')
+				AND due_date < $1 AND missing_since IS NULL
+			FOR UPDATE
+		), overdue AS (
+			UPDATE bills SET status = 'overdue', updated_at = $1
+			FROM due WHERE bills.id = due.id
+			RETURNING bills.id, due.status
+		)
+		INSERT INTO bill_status_history (id, bill_id, from_status, to_status, source, changed_at)
+		SELECT gen_random_uuid()::text, id, status, 'overdue', $2, $1 FROM overdue
+	`
+	res, err := r.db.ExecContext(ctx, query, now, domain.BillStatusSourceSystem)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (r *repository) MarkMissingBills(ctx context.Context, linkedAccountID string, seenExternalIDs []string, from, to time.Time) (int, error) {
+	query := `
+		UPDATE bills
+		SET missing_since = $1, updated_at = $1
+		WHERE linked_account_id = $2 AND missing_since IS NULL
+			AND due_date BETWEEN $4 AND $5
+			AND NOT (external_id = ANY($3))
+	`
+	res, err := r.db.ExecContext(ctx, query, time.Now(), linkedAccountID, pq.Array(seenExternalIDs), from, to)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
 func (r *repository) GetBillByID(ctx context.Context, id string) (*domain.Bill, error) {
 	query := `
-		SELECT id, linked_account_id, provider_id, amount, due_date,
-			status, bill_date, created_at, updated_at
+		SELECT id, external_id, linked_account_id, provider_id, amount_minor, currency, due_date,
+			status, bill_date, missing_since, created_at, updated_at
 		FROM bills
 		WHERE id = $1
 	`
 	bill := &domain.Bill{}
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&bill.ID,
+		&bill.ExternalID,
 		&bill.LinkedAccountID,
 		&bill.ProviderID,
-		&bill.Amount,
+		&bill.Amount.Minor,
+		&bill.Amount.Currency,
 		&bill.DueDate,
 		&bill.Status,
 		&bill.BillDate,
+		&bill.MissingSince,
 		&bill.CreatedAt,
 		&bill.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return bill, err
+	if err != nil {
+		return nil, err
+	}
+	if err := r.loadBillDetails(ctx, bill); err != nil {
+		return nil, err
+	}
+	return bill, nil
 }
 
 func (r *repository) GetBillsByLinkedAccountID(ctx context.Context, linkedAccountID string) ([]*domain.Bill, error) {
 	query := `
-		SELECT id, linked_account_id, provider_id, amount, due_date,
-			status, bill_date, created_at, updated_at
+		SELECT id, external_id, linked_account_id, provider_id, amount_minor, currency, due_date,
+			status, bill_date, missing_since, created_at, updated_at
 		FROM bills
 		WHERE linked_account_id = $1
 		ORDER BY due_date DESC
@@ -84,12 +376,15 @@ func (r *repository) GetBillsByLinkedAccountID(ctx context.Context, linkedAccoun
 		bill := &domain.Bill{}
 		err := rows.Scan(
 			&bill.ID,
+			&bill.ExternalID,
 			&bill.LinkedAccountID,
 			&bill.ProviderID,
-			&bill.Amount,
+			&bill.Amount.Minor,
+			&bill.Amount.Currency,
 			&bill.DueDate,
 			&bill.Status,
 			&bill.BillDate,
+			&bill.MissingSince,
 			&bill.CreatedAt,
 			&bill.UpdatedAt,
 		)
@@ -103,8 +398,8 @@ func (r *repository) GetBillsByLinkedAccountID(ctx context.Context, linkedAccoun
 
 func (r *repository) GetBillsByUserID(ctx context.Context, userID string) ([]*domain.Bill, error) {
 	query := `
-		SELECT b.id, b.linked_account_id, b.provider_id, b.amount, b.due_date,
-			b.status, b.bill_date, b.created_at, b.updated_at
+		SELECT b.id, b.external_id, b.linked_account_id, b.provider_id, b.amount_minor, b.currency, b.due_date,
+			b.status, b.bill_date, b.missing_since, b.created_at, b.updated_at
 		FROM bills b
 		JOIN linked_accounts la ON b.linked_account_id = la.id
 		WHERE la.user_id = $1
@@ -121,12 +416,15 @@ func (r *repository) GetBillsByUserID(ctx context.Context, userID string) ([]*do
 		bill := &domain.Bill{}
 		err := rows.Scan(
 			&bill.ID,
+			&bill.ExternalID,
 			&bill.LinkedAccountID,
 			&bill.ProviderID,
-			&bill.Amount,
+			&bill.Amount.Minor,
+			&bill.Amount.Currency,
 			&bill.DueDate,
 			&bill.Status,
 			&bill.BillDate,
+			&bill.MissingSince,
 			&bill.CreatedAt,
 			&bill.UpdatedAt,
 		)
@@ -139,22 +437,39 @@ func (r *repository) GetBillsByUserID(ctx context.Context, userID string) ([]*do
 }
 
 func (r *repository) GetBillSummaryByUserID(ctx context.Context, userID string) (*domain.BillSummary, error) {
+	// Amounts due are totalled per currency
 	query := `
-		SELECT 
+		SELECT b.currency,
 			COUNT(*) as bill_count,
-			COALESCE(SUM(CASE WHEN b.status IN ('unpaid', 'overdue') THEN b.amount ELSE 0 END), 0) as total_due
+			COUNT(*) FILTER (WHERE b.status IN ('issued', 'unpaid', 'partially_paid', 'overdue')) as due_count,
+			COALESCE(SUM(b.amount_minor) FILTER (WHERE b.status IN ('issued', 'unpaid', 'partially_paid', 'overdue')), 0) as total_due
 		FROM bills b
 		JOIN linked_accounts la ON b.linked_account_id = la.id
 		WHERE la.user_id = $1
+		GROUP BY b.currency
+		ORDER BY b.currency
 	`
-	summary := &domain.BillSummary{}
-	err := r.db.QueryRowContext(ctx, query, userID).Scan(
-		&summary.BillCount,
-		&summary.TotalDue,
-	)
+	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	summary := &domain.BillSummary{TotalDue: []domain.Money{}}
+	for rows.Next() {
+		var count, dueCount int
+		var total domain.Money
+		if err := rows.Scan(&total.Currency, &count, &dueCount, &total.Minor); err != nil {
+			return nil, err
+		}
+		summary.BillCount += count
+		if dueCount > 0 {
+			summary.TotalDue = append(summary.TotalDue, total)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	// Get the actual bills
 	bills, err := r.GetBillsByUserID(ctx, userID)
@@ -173,18 +488,38 @@ func (r *repository) GetBillSummaryByUserID(ctx context.Context, userID string)
 func (r *repository) UpdateBill(ctx context.Context, bill *domain.Bill) error {
 	query := `
 		UPDATE bills
-		SET amount = $1, due_date = $2, status = $3, bill_date = $4, updated_at = $5
-		WHERE id = $6
+		SET amount_minor = $1, currency = $2, due_date = $3, status = $4, bill_date = $5, updated_at = $6
+		WHERE id = $7
 	`
-	_, err := r.db.ExecContext(ctx, query,
-		bill.Amount,
-		bill.DueDate,
-		bill.Status,
-		bill.BillDate,
-		time.Now(),
-		bill.ID,
-	)
-	return err
+	return r.WithTx(ctx, func(txRepo ports.Repository) error {
+		tx := txRepo.(*repository)
+		var stored domain.BillStatus
+		err := tx.db.QueryRowContext(ctx, `SELECT status FROM bills WHERE id = $1 FOR UPDATE`, bill.ID).Scan(&stored)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !stored.CanTransitionTo(bill.Status) {
+			return fmt.Errorf("%w: bill %s from %s to %s", domain.ErrInvalidBillTransition, bill.ID, stored, bill.Status)
+		}
+
+		now := time.Now()
+		_, err = tx.db.ExecContext(ctx, query,
+			bill.Amount.Minor,
+			bill.Amount.Currency,
+			bill.DueDate,
+			bill.Status,
+			bill.BillDate,
+			now,
+			bill.ID,
+		)
+		if err != nil || stored == bill.Status {
+			return err
+		}
+		return tx.recordStatusChange(ctx, bill.ID, stored, bill.Status, domain.BillStatusSourceSystem, now)
+	})
 }
 
 func (r *repository) DeleteBill(ctx context.Context, id string) error {
@@ -211,7 +546,7 @@ func (r *repository) CreateUser(ctx context.Context, user *domain.User) error {
 
 func (r *repository) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
 	query := `
-		SELECT id, email, password, created_at, updated_at
+		SELECT id, email, password, created_at, updated_at, COALESCE(refresh_cadence, ''), COALESCE(preferred_currency, '')
 		FROM users
 		WHERE id = $1
 	`
@@ -222,6 +557,8 @@ func (r *repository) GetUserByID(ctx context.Context, id string) (*domain.User,
 		&user.Password,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.RefreshCadence,
+		&user.PreferredCurrency,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -231,7 +568,7 @@ func (r *repository) GetUserByID(ctx context.Context, id string) (*domain.User,
 
 func (r *repository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
 	query := `
-		SELECT id, email, password, created_at, updated_at
+		SELECT id, email, password, created_at, updated_at, COALESCE(refresh_cadence, ''), COALESCE(preferred_currency, '')
 		FROM users
 		WHERE email = $1
 	`
@@ -242,6 +579,8 @@ func (r *repository) GetUserByEmail(ctx context.Context, email string) (*domain.
 		&user.Password,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.RefreshCadence,
+		&user.PreferredCurrency,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -252,12 +591,14 @@ func (r *repository) GetUserByEmail(ctx context.Context, email string) (*domain.
 func (r *repository) UpdateUser(ctx context.Context, user *domain.User) error {
 	query := `
 		UPDATE users
-		SET email = $1, password = $2, updated_at = $3
-		WHERE id = $4
+		SET email = $1, password = $2, refresh_cadence = NULLIF($3, ''), preferred_currency = NULLIF($4, ''), updated_at = $5
+		WHERE id = $6
 	`
 	_, err := r.db.ExecContext(ctx, query,
 		user.Email,
 		user.Password,
+		user.RefreshCadence,
+		user.PreferredCurrency,
 		time.Now(),
 		user.ID,
 	)
@@ -297,14 +638,19 @@ func (r *repository) ListUsers(ctx context.Context) ([]*domain.User, error) {
 // Provider operations
 func (r *repository) CreateProvider(ctx context.Context, provider *domain.Provider) error {
 	query := `
-		INSERT INTO providers (id, name, api_endpoint, auth_type, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO providers (id, name, api_endpoint, auth_type, auth_config, refresh_cadence, rate_limit_per_minute, rate_limit_burst, category, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 	_, err := r.db.ExecContext(ctx, query,
 		provider.ID,
 		provider.Name,
 		provider.APIEndpoint,
 		provider.AuthType,
+		provider.AuthConfig,
+		provider.RefreshCadence,
+		provider.RateLimitPerMinute,
+		provider.RateLimitBurst,
+		provider.Category,
 		time.Now(),
 		time.Now(),
 	)
@@ -313,7 +659,7 @@ func (r *repository) CreateProvider(ctx context.Context, provider *domain.Provid
 
 func (r *repository) GetProviderByID(ctx context.Context, id string) (*domain.Provider, error) {
 	query := `
-		SELECT id, name, api_endpoint, auth_type, created_at, updated_at
+		SELECT id, name, api_endpoint, auth_type, auth_config, refresh_cadence, rate_limit_per_minute, rate_limit_burst, category, created_at, updated_at
 		FROM providers
 		WHERE id = $1
 	`
@@ -323,6 +669,11 @@ func (r *repository) GetProviderByID(ctx context.Context, id string) (*domain.Pr
 		&provider.Name,
 		&provider.APIEndpoint,
 		&provider.AuthType,
+		&provider.AuthConfig,
+		&provider.RefreshCadence,
+		&provider.RateLimitPerMinute,
+		&provider.RateLimitBurst,
+		&provider.Category,
 		&provider.CreatedAt,
 		&provider.UpdatedAt,
 	)
@@ -334,7 +685,7 @@ func (r *repository) GetProviderByID(ctx context.Context, id string) (*domain.Pr
 
 func (r *repository) GetProviderByName(ctx context.Context, name string) (*domain.Provider, error) {
 	query := `
-		SELECT id, name, api_endpoint, auth_type, created_at, updated_at
+		SELECT id, name, api_endpoint, auth_type, auth_config, refresh_cadence, rate_limit_per_minute, rate_limit_burst, category, created_at, updated_at
 		FROM providers
 		WHERE name = $1
 	`
@@ -344,6 +695,11 @@ func (r *repository) GetProviderByName(ctx context.Context, name string) (*domai
 		&provider.Name,
 		&provider.APIEndpoint,
 		&provider.AuthType,
+		&provider.AuthConfig,
+		&provider.RefreshCadence,
+		&provider.RateLimitPerMinute,
+		&provider.RateLimitBurst,
+		&provider.Category,
 		&provider.CreatedAt,
 		&provider.UpdatedAt,
 	)
@@ -355,7 +711,7 @@ func (r *repository) GetProviderByName(ctx context.Context, name string) (*domai
 
 func (r *repository) ListProviders(ctx context.Context) ([]*domain.Provider, error) {
 	query := `
-		SELECT id, name, api_endpoint, auth_type, created_at, updated_at
+		SELECT id, name, api_endpoint, auth_type, auth_config, refresh_cadence, rate_limit_per_minute, rate_limit_burst, category, created_at, updated_at
 		FROM providers
 		ORDER BY name
 	`
@@ -373,6 +729,11 @@ func (r *repository) ListProviders(ctx context.Context) ([]*domain.Provider, err
 			&provider.Name,
 			&provider.APIEndpoint,
 			&provider.AuthType,
+			&provider.AuthConfig,
+			&provider.RefreshCadence,
+			&provider.RateLimitPerMinute,
+			&provider.RateLimitBurst,
+			&provider.Category,
 			&provider.CreatedAt,
 			&provider.UpdatedAt,
 		)
@@ -387,13 +748,19 @@ func (r *repository) ListProviders(ctx context.Context) ([]*domain.Provider, err
 func (r *repository) UpdateProvider(ctx context.Context, provider *domain.Provider) error {
 	query := `
 		UPDATE providers
-		SET name = $1, api_endpoint = $2, auth_type = $3, updated_at = $4
-		WHERE id = $5
+		SET name = $1, api_endpoint = $2, auth_type = $3, auth_config = $4, refresh_cadence = $5,
+			rate_limit_per_minute = $6, rate_limit_burst = $7, category = $8, updated_at = $9
+		WHERE id = $10
 	`
 	_, err := r.db.ExecContext(ctx, query,
 		provider.Name,
 		provider.APIEndpoint,
 		provider.AuthType,
+		provider.AuthConfig,
+		provider.RefreshCadence,
+		provider.RateLimitPerMinute,
+		provider.RateLimitBurst,
+		provider.Category,
 		time.Now(),
 		provider.ID,
 	)
@@ -408,18 +775,23 @@ func (r *repository) DeleteProvider(ctx context.Context, id string) error {
 
 // LinkedAccount operations
 func (r *repository) CreateLinkedAccount(ctx context.Context, account *domain.LinkedAccount) error {
+	credentials, keyVersion, err := r.sealCredentials(account)
+	if err != nil {
+		return err
+	}
 	query := `
 		INSERT INTO linked_accounts (
 			id, user_id, provider_id, account_id, credentials,
-			status, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			credentials_key_version, status, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
-	_, err := r.db.ExecContext(ctx, query,
+	_, err = r.db.ExecContext(ctx, query,
 		account.ID,
 		account.UserID,
 		account.ProviderID,
 		account.AccountID,
-		account.Credentials,
+		credentials,
+		keyVersion,
 		account.Status,
 		time.Now(),
 		time.Now(),
@@ -430,7 +802,9 @@ func (r *repository) CreateLinkedAccount(ctx context.Context, account *domain.Li
 func (r *repository) GetLinkedAccountByID(ctx context.Context, id string) (*domain.LinkedAccount, error) {
 	query := `
 		SELECT id, user_id, provider_id, account_id, credentials,
-			status, created_at, updated_at
+			status, created_at, updated_at, credentials_key_version,
+			last_attempt_at, last_success_at, consecutive_failures, last_error,
+			next_scheduled_at
 		FROM linked_accounts
 		WHERE id = $1
 	`
@@ -444,6 +818,12 @@ func (r *repository) GetLinkedAccountByID(ctx context.Context, id string) (*doma
 		&account.Status,
 		&account.CreatedAt,
 		&account.UpdatedAt,
+		&account.CredentialsKeyVersion,
+		&account.Sync.LastAttemptAt,
+		&account.Sync.LastSuccessAt,
+		&account.Sync.ConsecutiveFailures,
+		&account.Sync.LastError,
+		&account.Sync.NextScheduledAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -454,7 +834,9 @@ func (r *repository) GetLinkedAccountByID(ctx context.Context, id string) (*doma
 func (r *repository) GetLinkedAccountsByUserID(ctx context.Context, userID string) ([]*domain.LinkedAccount, error) {
 	query := `
 		SELECT id, user_id, provider_id, account_id, credentials,
-			status, created_at, updated_at
+			status, created_at, updated_at, credentials_key_version,
+			last_attempt_at, last_success_at, consecutive_failures, last_error,
+			next_scheduled_at
 		FROM linked_accounts
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -477,6 +859,12 @@ func (r *repository) GetLinkedAccountsByUserID(ctx context.Context, userID strin
 			&account.Status,
 			&account.CreatedAt,
 			&account.UpdatedAt,
+			&account.CredentialsKeyVersion,
+			&account.Sync.LastAttemptAt,
+			&account.Sync.LastSuccessAt,
+			&account.Sync.ConsecutiveFailures,
+			&account.Sync.LastError,
+			&account.Sync.NextScheduledAt,
 		)
 		if err != nil {
 			return nil, err
@@ -489,7 +877,9 @@ func (r *repository) GetLinkedAccountsByUserID(ctx context.Context, userID strin
 func (r *repository) GetLinkedAccountsByProviderID(ctx context.Context, providerID string) ([]*domain.LinkedAccount, error) {
 	query := `
 		SELECT id, user_id, provider_id, account_id, credentials,
-			status, created_at, updated_at
+			status, created_at, updated_at, credentials_key_version,
+			last_attempt_at, last_success_at, consecutive_failures, last_error,
+			next_scheduled_at
 		FROM linked_accounts
 		WHERE provider_id = $1
 		ORDER BY created_at DESC
@@ -512,6 +902,12 @@ func (r *repository) GetLinkedAccountsByProviderID(ctx context.Context, provider
 			&account.Status,
 			&account.CreatedAt,
 			&account.UpdatedAt,
+			&account.CredentialsKeyVersion,
+			&account.Sync.LastAttemptAt,
+			&account.Sync.LastSuccessAt,
+			&account.Sync.ConsecutiveFailures,
+			&account.Sync.LastError,
+			&account.Sync.NextScheduledAt,
 		)
 		if err != nil {
 			return nil, err
@@ -521,14 +917,99 @@ func (r *repository) GetLinkedAccountsByProviderID(ctx context.Context, provider
 	return accounts, rows.Err()
 }
 
+func (r *repository) RecordSyncSuccess(ctx context.Context, id string, at time.Time) error {
+	query := `
+		UPDATE linked_accounts
+		SET status = 'active', last_attempt_at = $1, last_success_at = $1,
+			consecutive_failures = 0, last_error = '', updated_at = $2
+		WHERE id = $3
+	`
+	_, err := r.db.ExecContext(ctx, query, at, time.Now(), id)
+	return err
+}
+
+func (r *repository) RecordSyncFailure(ctx context.Context, id string, at time.Time, status, cause string) error {
+	query := `
+		UPDATE linked_accounts
+		SET status = $1, last_attempt_at = $2,
+			consecutive_failures = consecutive_failures + 1, last_error = $3, updated_at = $4
+		WHERE id = $5
+	`
+	_, err := r.db.ExecContext(ctx, query, status, at, cause, time.Now(), id)
+	return err
+}
+
+func (r *repository) ListDueLinkedAccounts(ctx context.Context, now time.Time, limit int) ([]*domain.ScheduledAccount, error) {
+	query := `
+		SELECT la.id, la.user_id, la.provider_id, la.account_id, la.credentials,
+			la.status, la.created_at, la.updated_at, la.credentials_key_version,
+			la.last_attempt_at, la.last_success_at, la.consecutive_failures, la.last_error,
+			la.next_scheduled_at,
+			COALESCE(u.refresh_cadence, p.refresh_cadence)
+		FROM linked_accounts la
+		JOIN providers p ON p.id = la.provider_id
+		JOIN users u ON u.id = la.user_id
+		WHERE la.status IN ('active', 'error') AND (la.next_scheduled_at IS NULL OR la.next_scheduled_at <= $1)
+		ORDER BY la.next_scheduled_at NULLS FIRST
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*domain.ScheduledAccount
+	for rows.Next() {
+		account := &domain.ScheduledAccount{}
+		err := rows.Scan(
+			&account.ID,
+			&account.UserID,
+			&account.ProviderID,
+			&account.AccountID,
+			&account.Credentials,
+			&account.Status,
+			&account.CreatedAt,
+			&account.UpdatedAt,
+			&account.CredentialsKeyVersion,
+			&account.Sync.LastAttemptAt,
+			&account.Sync.LastSuccessAt,
+			&account.Sync.ConsecutiveFailures,
+			&account.Sync.LastError,
+			&account.Sync.NextScheduledAt,
+			&account.Cadence,
+		)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+func (r *repository) ScheduleLinkedAccount(ctx context.Context, id string, next time.Time) error {
+	query := `
+		UPDATE linked_accounts
+		SET next_scheduled_at = $1
+		WHERE id = $2
+	`
+	_, err := r.db.ExecContext(ctx, query, next, id)
+	return err
+}
+
 func (r *repository) UpdateLinkedAccount(ctx context.Context, account *domain.LinkedAccount) error {
+	credentials, keyVersion, err := r.sealCredentials(account)
+	if err != nil {
+		return err
+	}
 	query := `
 		UPDATE linked_accounts
-		SET credentials = $1, status = $2, updated_at = $3
-		WHERE id = $4
+		SET credentials = $1, credentials_key_version = $2, status = $3, updated_at = $4
+		WHERE id = $5
 	`
-	_, err := r.db.ExecContext(ctx, query,
-		account.Credentials,
+	_, err = r.db.ExecContext(ctx, query,
+		credentials,
+		keyVersion,
 		account.Status,
 		time.Now(),
 		account.ID,
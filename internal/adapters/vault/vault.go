@@ -0,0 +1,232 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mel-ak/onetap-challenge/internal/config"
+)
+
+// Prefixes of sealed values. v1 values are not bound to an account and are
+// only read; Seal writes v2 values, which are.
+const (
+	sealedPrefixV1 = "vault:v1:"
+	sealedPrefix   = "vault:v2:"
+)
+
+// Vault implements envelope encryption for provider credentials. Every value
+// is encrypted with its own AES-256-GCM data key, and the data key is wrapped
+// with a versioned master key. Older master keys stay in the keyring so rows
+// can be read until they are re-encrypted under the current version.
+type Vault struct {
+	keys    map[int][]byte
+	current int
+}
+
+// New creates a vault from a keyring of 32-byte master keys
+func New(keys map[int][]byte, current int) (*Vault, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("master key version %d not found", current)
+	}
+	for version, key := range keys {
+		if version <= 0 {
+			return nil, fmt.Errorf("invalid master key version %d", version)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("master key version %d must be 32 bytes, got %d", version, len(key))
+		}
+	}
+	return &Vault{keys: keys, current: current}, nil
+}
+
+// NewFromConfig loads the master key from the config value or key file
+func NewFromConfig(cfg config.VaultConfig) (*Vault, error) {
+	encoded := cfg.MasterKey
+	if encoded == "" && cfg.MasterKeyFile != "" {
+		data, err := os.ReadFile(cfg.MasterKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read master key file: %w", err)
+		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return nil, errors.New("no credentials master key configured")
+	}
+
+	key, err := DecodeKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[int][]byte{cfg.KeyVersion: key}
+
+	// Previous keys are listed as "version:base64key" pairs separated by commas
+	for _, entry := range strings.Split(cfg.PreviousKeys, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		versionStr, encodedKey, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed previous key entry %q", entry)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("malformed previous key version %q", versionStr)
+		}
+		if keys[version], err = DecodeKey(encodedKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return New(keys, cfg.KeyVersion)
+}
+
+// DecodeKey parses a base64 encoded master key
+func DecodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode master key: %w", err)
+	}
+	return key, nil
+}
+
+// GenerateKey returns a new random base64 encoded master key
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// IsSealed reports whether value was produced by Seal
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix) || strings.HasPrefix(value, sealedPrefixV1)
+}
+
+// KeyVersion returns the master key version used for new values
+func (v *Vault) KeyVersion() int {
+	return v.current
+}
+
+// Rotate returns a vault that keeps the current keyring for reading and
+// seals new values with key under version
+func (v *Vault) Rotate(key []byte, version int) (*Vault, error) {
+	if _, ok := v.keys[version]; ok {
+		return nil, fmt.Errorf("master key version %d already in use", version)
+	}
+	keys := make(map[int][]byte, len(v.keys)+1)
+	for existing, existingKey := range v.keys {
+		keys[existing] = existingKey
+	}
+	keys[version] = key
+	return New(keys, version)
+}
+
+// Seal encrypts plaintext under the current master key and returns the
+// ciphertext together with the key version used. The ciphertext is bound to
+// aad, e.g. the ID of the account it belongs to, and only opens with it.
+func (v *Vault) Seal(plaintext, aad string) (string, int, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", 0, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedKey, err := encrypt(v.keys[v.current], dataKey, []byte(aad))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	ciphertext, err := encrypt(dataKey, []byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+
+	sealed := sealedPrefix +
+		base64.StdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext)
+	return sealed, v.current, nil
+}
+
+// Open decrypts a value sealed under the given key version for aad. Values
+// written before the vault existed (key version 0) are returned unchanged and
+// v1 values, which predate aad, are opened without it.
+func (v *Vault) Open(sealed string, keyVersion int, aad string) (string, error) {
+	if keyVersion == 0 && !IsSealed(sealed) {
+		return sealed, nil
+	}
+
+	masterKey, ok := v.keys[keyVersion]
+	if !ok {
+		return "", fmt.Errorf("master key version %d not loaded", keyVersion)
+	}
+
+	var additional []byte
+	encoded, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if ok {
+		additional = []byte(aad)
+	} else if encoded, ok = strings.CutPrefix(sealed, sealedPrefixV1); !ok {
+		return "", errors.New("malformed sealed value")
+	}
+	parts := strings.Split(encoded, ":")
+	if len(parts) != 2 {
+		return "", errors.New("malformed sealed value")
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("malformed data key: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed ciphertext: %w", err)
+	}
+
+	dataKey, err := decrypt(masterKey, wrappedKey, additional)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	plaintext, err := decrypt(dataKey, ciphertext, additional)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// encrypt seals data and aad with AES-GCM and prepends the nonce
+func encrypt(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, aad), nil
+}
+
+// decrypt opens data produced by encrypt with the same aad
+func decrypt(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,97 @@
+package vault
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKey(t *testing.T) []byte {
+	encoded, err := GenerateKey()
+	assert.NoError(t, err)
+	key, err := DecodeKey(encoded)
+	assert.NoError(t, err)
+	return key
+}
+
+func TestSealOpen(t *testing.T) {
+	v, err := New(map[int][]byte{1: newTestKey(t)}, 1)
+	assert.NoError(t, err)
+
+	sealed, version, err := v.Seal(`{"username":"jane","password":"secret"}`, "acc1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.True(t, IsSealed(sealed))
+	assert.NotContains(t, sealed, "secret")
+
+	plaintext, err := v.Open(sealed, version, "acc1")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"username":"jane","password":"secret"}`, plaintext)
+
+	// Credentials copied to another account's row do not open
+	_, err = v.Open(sealed, version, "acc2")
+	assert.Error(t, err)
+
+	// Legacy plaintext rows are passed through
+	plaintext, err = v.Open("legacy-token", 0, "acc1")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy-token", plaintext)
+}
+
+func TestOpenWithWrongKeyFails(t *testing.T) {
+	v1, _ := New(map[int][]byte{1: newTestKey(t)}, 1)
+	other, _ := New(map[int][]byte{1: newTestKey(t)}, 1)
+
+	sealed, version, err := v1.Seal("secret", "acc1")
+	assert.NoError(t, err)
+
+	_, err = other.Open(sealed, version, "acc1")
+	assert.Error(t, err)
+
+	_, err = v1.Open(sealed, 2, "acc1")
+	assert.Error(t, err)
+}
+
+func TestRotate(t *testing.T) {
+	v1, _ := New(map[int][]byte{1: newTestKey(t)}, 1)
+	sealedV1, _, err := v1.Seal("secret", "acc1")
+	assert.NoError(t, err)
+
+	v2, err := v1.Rotate(newTestKey(t), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v2.KeyVersion())
+
+	// The rotated vault still reads values sealed under the old key
+	plaintext, err := v2.Open(sealedV1, 1, "acc1")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", plaintext)
+
+	sealedV2, version, err := v2.Seal("secret", "acc1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	_, err = v1.Open(sealedV2, version, "acc1")
+	assert.Error(t, err)
+
+	_, err = v2.Rotate(newTestKey(t), 2)
+	assert.Error(t, err)
+}
+
+func TestOpenUnboundV1Values(t *testing.T) {
+	key := newTestKey(t)
+	v, _ := New(map[int][]byte{1: key}, 1)
+
+	// Values sealed before credentials were bound to their account
+	dataKey := newTestKey(t)
+	wrappedKey, err := encrypt(key, dataKey, nil)
+	assert.NoError(t, err)
+	ciphertext, err := encrypt(dataKey, []byte("secret"), nil)
+	assert.NoError(t, err)
+	sealed := sealedPrefixV1 + base64.StdEncoding.EncodeToString(wrappedKey) + ":" + base64.StdEncoding.EncodeToString(ciphertext)
+	assert.True(t, IsSealed(sealed))
+
+	plaintext, err := v.Open(sealed, 1, "acc1")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", plaintext)
+}
@@ -2,15 +2,28 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 	"time"
 )
 
 // Config holds all configuration for our application
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Redis       RedisConfig
+	JWT         JWTConfig
+	Vault       VaultConfig
+	ProviderTLS ProviderTLSConfig
+	OAuth2      OAuth2Config
+	Queue       QueueConfig
+	Scheduler   SchedulerConfig
+	Breaker     BreakerConfig
+	Retry       RetryConfig
+	Quota       ProviderQuotaConfig
+	RateLimit   APIRateLimitConfig
+	Rates       ExchangeRateConfig
+	Notify      NotificationConfig
 }
 
 // ServerConfig holds HTTP server configuration
@@ -45,6 +58,128 @@ type JWTConfig struct {
 	TokenDuration time.Duration
 }
 
+// VaultConfig holds the master key used to encrypt provider credentials.
+// MasterKey takes precedence over MasterKeyFile; both hold a base64 encoded
+// 32-byte key. PreviousKeys lists retired keys as "version:key" pairs so rows
+// not yet re-encrypted stay readable.
+type VaultConfig struct {
+	MasterKey     string
+	MasterKeyFile string
+	KeyVersion    int
+	PreviousKeys  string
+}
+
+// ProviderTLSConfig holds the directory the client certificates, keys and
+// CAs of mutual TLS providers are read from. Provider auth configs can only
+// name files inside it.
+type ProviderTLSConfig struct {
+	CertDir string
+}
+
+// OAuth2Config holds settings for linking OAuth2 providers
+type OAuth2Config struct {
+	// RedirectURL is the public URL of GET /accounts/link/callback
+	RedirectURL string
+}
+
+// QueueConfig holds the background job queue and worker settings
+type QueueConfig struct {
+	// VisibilityTimeout is how long a dequeued job stays reserved before it
+	// is delivered to another worker
+	VisibilityTimeout time.Duration
+	MaxAttempts       int
+	// Failed jobs are retried after RetryBackoff, doubling up to MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// WorkerConcurrency is the number of jobs a worker process runs at once
+	WorkerConcurrency int
+}
+
+// SchedulerConfig holds the periodic refresh scheduler settings. Only the
+// worker holding the leader lease schedules refreshes.
+type SchedulerConfig struct {
+	// Interval is how often the leader looks for accounts due for a refresh
+	Interval time.Duration
+	// LeaseTTL is how long leadership lasts without being renewed
+	LeaseTTL time.Duration
+	// BatchSize caps the accounts scheduled per interval
+	BatchSize int
+	// JitterPercent spreads the next refresh of an account by up to this
+	// percentage of its cadence in either direction
+	JitterPercent int
+	// OverdueInterval is how often bills past their due date are moved to
+	// overdue
+	OverdueInterval time.Duration
+}
+
+// BreakerConfig holds the per-provider circuit breaker settings. A breaker
+// opens when, within one window of at least MinRequests calls, the share of
+// failed or slow calls reaches its threshold. After OpenTimeout it lets
+// HalfOpenProbes calls through and closes once they all succeed.
+type BreakerConfig struct {
+	Window             time.Duration
+	MinRequests        int
+	FailureRatePercent int
+	// Calls slower than SlowCallDuration count as slow
+	SlowCallDuration    time.Duration
+	SlowCallRatePercent int
+	OpenTimeout         time.Duration
+	HalfOpenProbes      int
+}
+
+// RetryConfig holds the retry policy of provider calls. Retryable failures are
+// retried up to MaxAttempts calls in total after a random delay of up to
+// BaseDelay, doubling per attempt up to MaxDelay, or after the provider's
+// Retry-After when it sent one.
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// ProviderQuotaConfig holds how calls wait for the rate limit of their
+// provider. The limits themselves are stored on each provider.
+type ProviderQuotaConfig struct {
+	// MaxWait is the longest a call waits for its provider's quota when its
+	// context has no earlier deadline
+	MaxWait time.Duration
+}
+
+// APIRateLimitConfig holds the limits on requests to the API. Requests are
+// counted per user, or per client IP before login, over a sliding window.
+type APIRateLimitConfig struct {
+	Window time.Duration
+	// Default is the limit of routes without a stricter one
+	Default int
+	Login   int
+	Refresh int
+	// TrustedProxies lists comma separated IPs or CIDRs of the proxies whose
+	// X-Forwarded-For header tells the client IP
+	TrustedProxies string
+}
+
+// ExchangeRateConfig holds where the exchange rates used to convert bill
+// totals come from: the exchange_rates table, replaced through
+// PUT /exchange-rates, when Source is "database", or File when it is "file"
+type ExchangeRateConfig struct {
+	Source string
+	File   string
+	// AdminToken authorizes PUT /exchange-rates and GET /debug/vars through
+	// the X-Admin-Token header; both are disabled when it is empty
+	AdminToken string
+}
+
+// NotificationConfig holds the SMTP settings used to notify administrators.
+// Notifications are only logged when SMTPHost is empty.
+type NotificationConfig struct {
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+	AdminEmail   string
+}
+
 // NewDefaultConfig returns a new Config with default values
 func NewDefaultConfig() *Config {
 	return &Config{
@@ -72,7 +207,97 @@ func NewDefaultConfig() *Config {
 			SecretKey:     "your-secret-key",
 			TokenDuration: 24 * time.Hour,
 		},
+		Vault: VaultConfig{
+			MasterKey:     os.Getenv("CREDENTIALS_MASTER_KEY"),
+			MasterKeyFile: getEnv("CREDENTIALS_MASTER_KEY_FILE", ".secrets/master.key"),
+			KeyVersion:    getEnvInt("CREDENTIALS_KEY_VERSION", 1),
+			PreviousKeys:  os.Getenv("CREDENTIALS_PREVIOUS_KEYS"),
+		},
+		ProviderTLS: ProviderTLSConfig{
+			CertDir: getEnv("PROVIDER_CERT_DIR", ".secrets/providers"),
+		},
+		OAuth2: OAuth2Config{
+			RedirectURL: getEnv("OAUTH2_REDIRECT_URL", "http://localhost:8081/accounts/link/callback"),
+		},
+		Queue: QueueConfig{
+			VisibilityTimeout: getEnvDuration("QUEUE_VISIBILITY_TIMEOUT", 5*time.Minute),
+			MaxAttempts:       getEnvInt("QUEUE_MAX_ATTEMPTS", 5),
+			RetryBackoff:      getEnvDuration("QUEUE_RETRY_BACKOFF", 5*time.Second),
+			MaxRetryBackoff:   getEnvDuration("QUEUE_MAX_RETRY_BACKOFF", 10*time.Minute),
+			WorkerConcurrency: getEnvInt("WORKER_CONCURRENCY", 4),
+		},
+		Scheduler: SchedulerConfig{
+			Interval:        getEnvDuration("SCHEDULER_INTERVAL", time.Minute),
+			LeaseTTL:        getEnvDuration("SCHEDULER_LEASE_TTL", 30*time.Second),
+			BatchSize:       getEnvInt("SCHEDULER_BATCH_SIZE", 500),
+			JitterPercent:   getEnvInt("SCHEDULER_JITTER_PERCENT", 10),
+			OverdueInterval: getEnvDuration("SCHEDULER_OVERDUE_INTERVAL", 15*time.Minute),
+		},
+		Breaker: BreakerConfig{
+			Window:              getEnvDuration("BREAKER_WINDOW", time.Minute),
+			MinRequests:         getEnvInt("BREAKER_MIN_REQUESTS", 10),
+			FailureRatePercent:  getEnvInt("BREAKER_FAILURE_RATE_PERCENT", 50),
+			SlowCallDuration:    getEnvDuration("BREAKER_SLOW_CALL_DURATION", 5*time.Second),
+			SlowCallRatePercent: getEnvInt("BREAKER_SLOW_CALL_RATE_PERCENT", 80),
+			OpenTimeout:         getEnvDuration("BREAKER_OPEN_TIMEOUT", 30*time.Second),
+			HalfOpenProbes:      getEnvInt("BREAKER_HALF_OPEN_PROBES", 3),
+		},
+		Retry: RetryConfig{
+			MaxAttempts: getEnvInt("PROVIDER_RETRY_MAX_ATTEMPTS", 3),
+			BaseDelay:   getEnvDuration("PROVIDER_RETRY_BASE_DELAY", 500*time.Millisecond),
+			MaxDelay:    getEnvDuration("PROVIDER_RETRY_MAX_DELAY", 10*time.Second),
+		},
+		Quota: ProviderQuotaConfig{
+			MaxWait: getEnvDuration("PROVIDER_QUOTA_MAX_WAIT", 5*time.Second),
+		},
+		RateLimit: APIRateLimitConfig{
+			Window:         getEnvDuration("API_RATE_LIMIT_WINDOW", time.Minute),
+			Default:        getEnvInt("API_RATE_LIMIT_DEFAULT", 100),
+			Login:          getEnvInt("API_RATE_LIMIT_LOGIN", 10),
+			Refresh:        getEnvInt("API_RATE_LIMIT_REFRESH", 5),
+			TrustedProxies: os.Getenv("TRUSTED_PROXIES"),
+		},
+		Rates: ExchangeRateConfig{
+			Source:     getEnv("EXCHANGE_RATES_SOURCE", "database"),
+			File:       getEnv("EXCHANGE_RATES_FILE", "exchange_rates.json"),
+			AdminToken: os.Getenv("ADMIN_API_TOKEN"),
+		},
+		Notify: NotificationConfig{
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+			From:         getEnv("NOTIFY_FROM", "bill-aggregator@localhost"),
+			AdminEmail:   os.Getenv("NOTIFY_ADMIN_EMAIL"),
+		},
+	}
+}
+
+// getEnv returns the environment variable or fallback when unset
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt returns the environment variable as an int or fallback when unset or invalid
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvDuration returns the environment variable as a duration (e.g. "30s")
+// or fallback when unset or invalid
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
 	}
+	return value
 }
 
 // DBConn returns the database connection string
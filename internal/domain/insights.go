@@ -0,0 +1,248 @@
+package domain
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// monthLayout is how months of spending insights are written
+const monthLayout = "2006-01"
+
+// SpendingQuery selects the bills spending insights are computed over: the
+// bills of a user in one currency due from From up to, excluding, To
+type SpendingQuery struct {
+	UserID   string
+	Currency string
+	From     time.Time
+	To       time.Time
+}
+
+// SpendingWindow returns the query covering the month of now and the
+// months-1 months before it
+func SpendingWindow(userID, currency string, months int, now time.Time) SpendingQuery {
+	now = now.UTC()
+	to := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	return SpendingQuery{
+		UserID:   userID,
+		Currency: currency,
+		From:     to.AddDate(0, -months, 0),
+		To:       to,
+	}
+}
+
+// months returns the first day of every month of the window
+func (q SpendingQuery) months() []time.Time {
+	var months []time.Time
+	for month := q.From; month.Before(q.To); month = month.AddDate(0, 1, 0) {
+		months = append(months, month)
+	}
+	return months
+}
+
+// SpendingTotal is the total of the bills of a month, of one provider when
+// ProviderID is set, of one category when only Category is and of every bill
+// otherwise
+type SpendingTotal struct {
+	Month        time.Time
+	ProviderID   string
+	ProviderName string
+	Category     string
+	Minor        int64
+	BillCount    int
+}
+
+// SpendingGrowth is the largest increase of a linked account's bills from
+// one month to the next. BillID is the latest bill of Month.
+type SpendingGrowth struct {
+	BillID          string
+	LinkedAccountID string
+	ProviderID      string
+	ProviderName    string
+	Month           time.Time
+	Previous        int64
+	Current         int64
+}
+
+// SpendingAggregates are the totals spending insights are computed from
+type SpendingAggregates struct {
+	Totals    []SpendingTotal
+	TopGrowth *SpendingGrowth
+	// Currencies lists every currency the user was billed in over the
+	// window, including those of other queries
+	Currencies []string
+}
+
+// SpendingInsights summarize a user's spending month by month
+type SpendingInsights struct {
+	Currency string `json:"currency"`
+	// From and To are the first and last months of the window, e.g. "2024-05"
+	From           string            `json:"from"`
+	To             string            `json:"to"`
+	Months         []MonthlySpending `json:"months"`
+	Total          Money             `json:"total"`
+	Average        Money             `json:"monthly_average"`
+	Providers      []SpendingSeries  `json:"providers"`
+	Categories     []SpendingSeries  `json:"categories"`
+	TopGrowingBill *BillGrowth       `json:"top_growing_bill,omitempty"`
+	Currencies     []string          `json:"currencies"`
+}
+
+// SpendingSeries is the spending of one provider or utility category
+type SpendingSeries struct {
+	ProviderID   string            `json:"provider_id,omitempty"`
+	ProviderName string            `json:"provider_name,omitempty"`
+	Category     string            `json:"category"`
+	Months       []MonthlySpending `json:"months"`
+	Total        Money             `json:"total"`
+	Average      Money             `json:"monthly_average"`
+}
+
+// MonthlySpending is the spending of a month. Change is relative to the
+// month before and omitted for the first month of the window.
+type MonthlySpending struct {
+	Month     string          `json:"month"`
+	Total     Money           `json:"total"`
+	BillCount int             `json:"bill_count"`
+	Change    *SpendingChange `json:"change,omitempty"`
+}
+
+// SpendingChange is how much spending changed from one month to the next.
+// Percent is omitted when nothing was spent the month before.
+type SpendingChange struct {
+	Amount  Money    `json:"amount"`
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+// BillGrowth is the recurring bill that grew the most between two months
+type BillGrowth struct {
+	BillID          string         `json:"bill_id"`
+	LinkedAccountID string         `json:"linked_account_id"`
+	ProviderID      string         `json:"provider_id"`
+	ProviderName    string         `json:"provider_name"`
+	Month           string         `json:"month"`
+	Previous        Money          `json:"previous"`
+	Current         Money          `json:"current"`
+	Change          SpendingChange `json:"change"`
+}
+
+// spendingChange returns the change from previous to current
+func spendingChange(previous, current int64, currency string) SpendingChange {
+	change := SpendingChange{Amount: Money{Minor: current - previous, Currency: currency}}
+	if previous != 0 {
+		percent := math.Round(float64(current-previous)*1000/math.Abs(float64(previous))) / 10
+		change.Percent = &percent
+	}
+	return change
+}
+
+// spendingSeries fills the months of the window without bills with zeros
+// and totals and averages them
+func spendingSeries(months []time.Time, totals map[time.Time]SpendingTotal, currency string) SpendingSeries {
+	series := SpendingSeries{
+		Months: make([]MonthlySpending, len(months)),
+		Total:  Money{Currency: currency},
+	}
+	for i, month := range months {
+		total := totals[month]
+		series.Months[i] = MonthlySpending{
+			Month:     month.Format(monthLayout),
+			Total:     Money{Minor: total.Minor, Currency: currency},
+			BillCount: total.BillCount,
+		}
+		if i > 0 {
+			change := spendingChange(totals[months[i-1]].Minor, total.Minor, currency)
+			series.Months[i].Change = &change
+		}
+		series.Total.Minor += total.Minor
+	}
+	series.Average = Money{Currency: currency}
+	if len(months) > 0 {
+		// Totals of minor units divided by a few months cannot overflow
+		series.Average.Minor, _ = roundHalfAway(big.NewRat(series.Total.Minor, int64(len(months))))
+	}
+	return series
+}
+
+// NewSpendingInsights computes the insights of q from its aggregates
+func NewSpendingInsights(q SpendingQuery, aggregates *SpendingAggregates) *SpendingInsights {
+	months := q.months()
+	overall := make(map[time.Time]SpendingTotal)
+	providers := make(map[string]map[time.Time]SpendingTotal)
+	categories := make(map[string]map[time.Time]SpendingTotal)
+	var providerOrder, categoryOrder []SpendingTotal
+	for _, total := range aggregates.Totals {
+		month := total.Month.UTC()
+		switch {
+		case total.ProviderID != "":
+			if providers[total.ProviderID] == nil {
+				providers[total.ProviderID] = make(map[time.Time]SpendingTotal)
+				providerOrder = append(providerOrder, total)
+			}
+			providers[total.ProviderID][month] = total
+		case total.Category != "":
+			if categories[total.Category] == nil {
+				categories[total.Category] = make(map[time.Time]SpendingTotal)
+				categoryOrder = append(categoryOrder, total)
+			}
+			categories[total.Category][month] = total
+		default:
+			overall[month] = total
+		}
+	}
+
+	all := spendingSeries(months, overall, q.Currency)
+	insights := &SpendingInsights{
+		Currency:   q.Currency,
+		From:       q.From.Format(monthLayout),
+		To:         q.To.AddDate(0, -1, 0).Format(monthLayout),
+		Months:     all.Months,
+		Total:      all.Total,
+		Average:    all.Average,
+		Providers:  []SpendingSeries{},
+		Categories: []SpendingSeries{},
+		Currencies: aggregates.Currencies,
+	}
+	if insights.Currencies == nil {
+		insights.Currencies = []string{}
+	}
+
+	for _, provider := range providerOrder {
+		series := spendingSeries(months, providers[provider.ProviderID], q.Currency)
+		series.ProviderID, series.ProviderName, series.Category = provider.ProviderID, provider.ProviderName, provider.Category
+		insights.Providers = append(insights.Providers, series)
+	}
+	for _, category := range categoryOrder {
+		series := spendingSeries(months, categories[category.Category], q.Currency)
+		series.Category = category.Category
+		insights.Categories = append(insights.Categories, series)
+	}
+	// Biggest spending first
+	sortSeries(insights.Providers, func(s SpendingSeries) string { return s.ProviderName + s.ProviderID })
+	sortSeries(insights.Categories, func(s SpendingSeries) string { return s.Category })
+
+	if growth := aggregates.TopGrowth; growth != nil {
+		insights.TopGrowingBill = &BillGrowth{
+			BillID:          growth.BillID,
+			LinkedAccountID: growth.LinkedAccountID,
+			ProviderID:      growth.ProviderID,
+			ProviderName:    growth.ProviderName,
+			Month:           growth.Month.UTC().Format(monthLayout),
+			Previous:        Money{Minor: growth.Previous, Currency: q.Currency},
+			Current:         Money{Minor: growth.Current, Currency: q.Currency},
+			Change:          spendingChange(growth.Previous, growth.Current, q.Currency),
+		}
+	}
+	return insights
+}
+
+// sortSeries sorts series by total, largest first, then by name
+func sortSeries(series []SpendingSeries, name func(SpendingSeries) string) {
+	sort.SliceStable(series, func(i, j int) bool {
+		if series[i].Total.Minor != series[j].Total.Minor {
+			return series[i].Total.Minor > series[j].Total.Minor
+		}
+		return name(series[i]) < name(series[j])
+	})
+}
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpendingWindow(t *testing.T) {
+	q := SpendingWindow("user1", "EUR", 3, time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC), q.From)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), q.To)
+	assert.Len(t, q.months(), 3)
+}
+
+func TestNewSpendingInsights(t *testing.T) {
+	q := SpendingWindow("user1", "USD", 3, time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC))
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := jan.AddDate(0, 1, 0)
+	mar := jan.AddDate(0, 2, 0)
+	aggregates := &SpendingAggregates{
+		Totals: []SpendingTotal{
+			{Month: jan, Minor: 10000, BillCount: 2},
+			{Month: jan, Category: CategoryElectricity, Minor: 6000, BillCount: 1},
+			{Month: jan, Category: CategoryWater, Minor: 4000, BillCount: 1},
+			{Month: jan, ProviderID: "p1", ProviderName: "Electricity Co", Category: CategoryElectricity, Minor: 6000, BillCount: 1},
+			{Month: jan, ProviderID: "p2", ProviderName: "Water Works", Category: CategoryWater, Minor: 4000, BillCount: 1},
+			// Nothing was billed in February
+			{Month: mar, Minor: 9001, BillCount: 1},
+			{Month: mar, Category: CategoryElectricity, Minor: 9001, BillCount: 1},
+			{Month: mar, ProviderID: "p1", ProviderName: "Electricity Co", Category: CategoryElectricity, Minor: 9001, BillCount: 1},
+		},
+		TopGrowth: &SpendingGrowth{
+			BillID: "bill9", LinkedAccountID: "acc1", ProviderID: "p1", ProviderName: "Electricity Co",
+			Month: feb, Previous: 6000, Current: 7500,
+		},
+		Currencies: []string{"EUR", "USD"},
+	}
+
+	insights := NewSpendingInsights(q, aggregates)
+	assert.Equal(t, "2024-01", insights.From)
+	assert.Equal(t, "2024-03", insights.To)
+	assert.Equal(t, Money{19001, "USD"}, insights.Total)
+	// 190.01 over three months rounds half up to 63.34
+	assert.Equal(t, Money{6334, "USD"}, insights.Average)
+
+	assert.Len(t, insights.Months, 3)
+	assert.Nil(t, insights.Months[0].Change)
+	assert.Equal(t, MonthlySpending{Month: "2024-02", Total: Money{0, "USD"}, Change: &SpendingChange{
+		Amount: Money{-10000, "USD"}, Percent: floatPtr(-100),
+	}}, insights.Months[1])
+	// No percentage from a month without spending
+	assert.Equal(t, &SpendingChange{Amount: Money{9001, "USD"}}, insights.Months[2].Change)
+
+	assert.Len(t, insights.Providers, 2)
+	assert.Equal(t, "p1", insights.Providers[0].ProviderID)
+	assert.Equal(t, CategoryElectricity, insights.Providers[0].Category)
+	assert.Equal(t, Money{15001, "USD"}, insights.Providers[0].Total)
+	assert.Equal(t, Money{5000, "USD"}, insights.Providers[0].Average)
+	assert.Equal(t, "p2", insights.Providers[1].ProviderID)
+
+	assert.Len(t, insights.Categories, 2)
+	assert.Equal(t, CategoryElectricity, insights.Categories[0].Category)
+	assert.Empty(t, insights.Categories[0].ProviderID)
+	assert.Equal(t, CategoryWater, insights.Categories[1].Category)
+	assert.Equal(t, int64(-4000), insights.Categories[1].Months[1].Change.Amount.Minor)
+
+	assert.Equal(t, &BillGrowth{
+		BillID: "bill9", LinkedAccountID: "acc1", ProviderID: "p1", ProviderName: "Electricity Co", Month: "2024-02",
+		Previous: Money{6000, "USD"}, Current: Money{7500, "USD"},
+		Change: SpendingChange{Amount: Money{1500, "USD"}, Percent: floatPtr(25)},
+	}, insights.TopGrowingBill)
+	assert.Equal(t, []string{"EUR", "USD"}, insights.Currencies)
+}
+
+func TestNewSpendingInsightsWithoutBills(t *testing.T) {
+	q := SpendingWindow("user1", "USD", 2, time.Now())
+	insights := NewSpendingInsights(q, &SpendingAggregates{})
+	assert.Len(t, insights.Months, 2)
+	assert.Equal(t, Money{0, "USD"}, insights.Average)
+	assert.NotNil(t, insights.Providers)
+	assert.NotNil(t, insights.Categories)
+	assert.NotNil(t, insights.Currencies)
+	assert.Nil(t, insights.TopGrowingBill)
+}
+
+func TestParseUtilityCategory(t *testing.T) {
+	category, err := ParseUtilityCategory(" Electricity ")
+	assert.NoError(t, err)
+	assert.Equal(t, CategoryElectricity, category)
+
+	category, err = ParseUtilityCategory("")
+	assert.NoError(t, err)
+	assert.Equal(t, CategoryOther, category)
+
+	_, err = ParseUtilityCategory("groceries")
+	assert.Error(t, err)
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
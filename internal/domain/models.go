@@ -1,9 +1,75 @@
 package domain
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
 	"time"
 )
 
+// ErrInvalidCredentials is returned when a provider rejects account credentials
+var ErrInvalidCredentials = errors.New("invalid provider credentials")
+
+// ErrCircuitOpen is returned without calling a provider while its circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("provider circuit breaker is open")
+
+// ErrRateLimited is returned when a call is refused by a rate limit
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ErrInvalidBillTransition is returned when a bill cannot move to a status
+var ErrInvalidBillTransition = errors.New("invalid bill status transition")
+
+// ErrInvalidCursor is returned for a page cursor that was not issued for the
+// same search
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ProviderError is returned when a provider answers with an unexpected status
+// other than a credentials rejection
+type ProviderError struct {
+	StatusCode int
+	// RetryAfter is how long the provider asked callers to wait before
+	// retrying, 0 when it did not say
+	RetryAfter time.Duration
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// Retryable reports whether a provider call failed for a transient reason:
+// a timeout, a dropped connection, a 5xx response or a 429. Rejected
+// credentials, other 4xx responses, an open circuit breaker and any other
+// error are permanent.
+func Retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		code := providerErr.StatusCode
+		return code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
 // User represents a user in the system
 type User struct {
 	ID        string    `json:"id"`
@@ -11,16 +77,164 @@ type User struct {
 	Password  string    `json:"-"` // Password is not exposed in JSON
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// RefreshCadence overrides the refresh cadence of the user's providers;
+	// empty means each provider's cadence applies
+	RefreshCadence string `json:"refresh_cadence,omitempty"`
+
+	// PreferredCurrency is the currency bill totals are converted to; empty
+	// means the default currency
+	PreferredCurrency string `json:"preferred_currency,omitempty"`
+}
+
+// Currency returns the currency the user's totals are converted to
+func (u *User) Currency() string {
+	if u.PreferredCurrency == "" {
+		return DefaultCurrency
+	}
+	return u.PreferredCurrency
+}
+
+// Refresh cadences of scheduled bill refreshes
+const (
+	RefreshDaily  = "daily"
+	RefreshWeekly = "weekly"
+)
+
+// RefreshInterval returns the time between scheduled refreshes of cadence
+// and whether the cadence is known
+func RefreshInterval(cadence string) (time.Duration, bool) {
+	switch cadence {
+	case RefreshDaily:
+		return 24 * time.Hour, true
+	case RefreshWeekly:
+		return 7 * 24 * time.Hour, true
+	default:
+		return 0, false
+	}
+}
+
+// Utility categories of providers, which spending insights are grouped by
+const (
+	CategoryElectricity = "electricity"
+	CategoryWater       = "water"
+	CategoryGas         = "gas"
+	CategoryInternet    = "internet"
+	CategoryPhone       = "phone"
+	CategoryOther       = "other"
+)
+
+// ParseUtilityCategory checks that category is a utility category and returns
+// it in lower case. An empty category is CategoryOther.
+func ParseUtilityCategory(category string) (string, error) {
+	category = strings.ToLower(strings.TrimSpace(category))
+	switch category {
+	case "":
+		return CategoryOther, nil
+	case CategoryElectricity, CategoryWater, CategoryGas, CategoryInternet, CategoryPhone, CategoryOther:
+		return category, nil
+	}
+	return "", fmt.Errorf("invalid utility category: %q", category)
 }
 
 // Provider represents a utility provider
 type Provider struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	APIEndpoint string    `json:"api_endpoint"`
-	AuthType    string    `json:"auth_type"` // e.g., "oauth2", "api_key", "basic"
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	APIEndpoint string             `json:"api_endpoint"`
+	AuthType    string             `json:"auth_type"` // "none", "api_key", "basic", "bearer", "hmac", "mtls" or "oauth2"
+	AuthConfig  ProviderAuthConfig `json:"-"`         // May hold client secrets, never exposed
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+
+	// RefreshCadence is how often the bills of linked accounts are refreshed
+	// in the background, "daily" or "weekly"
+	RefreshCadence string `json:"refresh_cadence"`
+
+	// RateLimitPerMinute caps the calls made to the provider by all replicas
+	// together, 0 for no limit. RateLimitBurst is how many calls may be made
+	// at once after a quiet period, defaulting to the per-minute limit.
+	RateLimitPerMinute int `json:"rate_limit_per_minute"`
+	RateLimitBurst     int `json:"rate_limit_burst"`
+
+	// Category is the utility the provider bills for, one of the Category
+	// values
+	Category string `json:"category"`
+}
+
+// ProviderAuthConfig holds the per-provider settings of its auth type
+type ProviderAuthConfig struct {
+	// OAuth2 authorization-code flow
+	AuthorizeURL string   `json:"authorize_url,omitempty"`
+	TokenURL     string   `json:"token_url,omitempty"`
+	ClientID     string   `json:"client_id,omitempty"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+
+	// API key and HMAC signing headers, defaulting to X-API-Key, X-Signature and X-Timestamp
+	HeaderName       string `json:"header_name,omitempty"`
+	SignatureHeader  string `json:"signature_header,omitempty"`
+	TimestampHeader  string `json:"timestamp_header,omitempty"`
+	SigningAlgorithm string `json:"signing_algorithm,omitempty"` // "hmac-sha256" (default) or "hmac-sha512"
+
+	// Static bearer token shared by every account of the provider
+	BearerToken string `json:"bearer_token,omitempty"`
+
+	// Client certificate for mutual TLS, as names of files in the provider
+	// certificate directory
+	ClientCertFile string `json:"client_cert_file,omitempty"`
+	ClientKeyFile  string `json:"client_key_file,omitempty"`
+	CAFile         string `json:"ca_file,omitempty"`
+}
+
+// Value stores the auth config as JSON
+func (c ProviderAuthConfig) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+// Scan reads the auth config from a JSON column
+func (c *ProviderAuthConfig) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c = ProviderAuthConfig{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("cannot scan %T into ProviderAuthConfig", src)
+	}
+}
+
+// ProviderCapabilities describes the optional features a provider adapter supports
+type ProviderCapabilities struct {
+	SupportsPagination           bool `json:"supports_pagination"`
+	SupportsWebhooks             bool `json:"supports_webhooks"`
+	SupportsCredentialValidation bool `json:"supports_credential_validation"`
+}
+
+// Credentials holds the decrypted secrets used to authenticate with a provider
+// (e.g. "username"/"password", "api_key", "access_token")
+type Credentials map[string]string
+
+// ParseCredentials decodes the credentials stored on a linked account.
+// Values that are not a JSON object are treated as a single token.
+func ParseCredentials(raw string) Credentials {
+	var creds Credentials
+	if err := json.Unmarshal([]byte(raw), &creds); err == nil && creds != nil {
+		return creds
+	}
+	return Credentials{"token": raw}
+}
+
+// Encode serializes the credentials for storage
+func (c Credentials) Encode() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
 
 // LinkedAccount represents a user's linked utility account
@@ -30,27 +244,400 @@ type LinkedAccount struct {
 	ProviderID  string    `json:"provider_id"`
 	AccountID   string    `json:"account_id"` // Provider's account ID
 	Credentials string    `json:"-"`          // Encrypted credentials
-	Status      string    `json:"status"`     // active, inactive, error
+	Status      string    `json:"status"`     // active, inactive, error (last sync failed), invalid_credentials
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// CredentialsKeyVersion is the master key version Credentials are sealed
+	// under; 0 means the value has not been encrypted yet
+	CredentialsKeyVersion int `json:"-"`
+
+	Sync SyncState `json:"sync"`
 }
 
-// Bill represents a utility bill
-type Bill struct {
-	ID              string    `json:"id"`
+// SyncState records how fetching the bills of a linked account went
+type SyncState struct {
+	LastAttemptAt       *time.Time `json:"last_attempt_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"` // When the bills are "as of"
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	NextScheduledAt     *time.Time `json:"next_scheduled_at,omitempty"` // Next background refresh
+}
+
+// RecordSuccess records a successful sync at at
+func (s *SyncState) RecordSuccess(at time.Time) {
+	s.LastAttemptAt = &at
+	s.LastSuccessAt = &at
+	s.ConsecutiveFailures = 0
+	s.LastError = ""
+}
+
+// RecordFailure records a sync that failed at at with cause
+func (s *SyncState) RecordFailure(at time.Time, cause string) {
+	s.LastAttemptAt = &at
+	s.ConsecutiveFailures++
+	s.LastError = cause
+}
+
+// Stale reports whether the account has never synced or last synced more
+// than maxAge before now
+func (s SyncState) Stale(now time.Time, maxAge time.Duration) bool {
+	return s.LastSuccessAt == nil || now.Sub(*s.LastSuccessAt) > maxAge
+}
+
+// AccountSyncStatus reports the sync state of a linked account alongside its bills
+type AccountSyncStatus struct {
 	LinkedAccountID string    `json:"linked_account_id"`
 	ProviderID      string    `json:"provider_id"`
-	Amount          float64   `json:"amount"`
-	DueDate         time.Time `json:"due_date"`
-	Status          string    `json:"status"` // paid, unpaid, overdue
-	BillDate        time.Time `json:"bill_date"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	Sync            SyncState `json:"sync"`
+	Stale           bool      `json:"stale"`
+	// Source tells where the account's bills in the response come from and
+	// AsOf when they were last fetched from the provider
+	Source string     `json:"source,omitempty"`
+	AsOf   *time.Time `json:"as_of,omitempty"`
+	// Status tells whether the account's bills are up to date. ErrorCode and
+	// Error say why they could not be fetched from the provider.
+	Status    string `json:"status"`
+	ErrorCode string `json:"error_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Statuses of the bills of an account in bill responses
+const (
+	AccountBillsOK          = "ok"           // Bills are up to date
+	AccountBillsStale       = "stale"        // The provider failed, older bills are returned
+	AccountBillsRateLimited = "rate_limited" // The fetch was throttled, older bills are returned
+	AccountBillsFailed      = "failed"       // No bills could be returned
+)
+
+// Error codes of accounts whose bills could not be fetched from the provider
+const (
+	AccountErrorInvalidCredentials  = "invalid_credentials"  // The provider rejected the credentials
+	AccountErrorRateLimited         = "rate_limited"         // Our or the provider's rate limit was hit
+	AccountErrorCircuitOpen         = "circuit_open"         // The provider's circuit breaker is open
+	AccountErrorProviderUnavailable = "provider_unavailable" // The provider timed out or failed
+	AccountErrorProviderRejected    = "provider_rejected"    // The provider refused the request
+	AccountErrorInternal            = "internal_error"       // Anything else
+)
+
+// Sources of the bills of an account in bill responses
+const (
+	BillSourceLive     = "live"     // Fetched from the provider for this request
+	BillSourceCache    = "cache"    // Served from the bill cache
+	BillSourceDatabase = "database" // Stored by the last successful sync
+)
+
+// ScheduledAccount is a linked account due for a scheduled refresh with the
+// cadence that applies to it
+type ScheduledAccount struct {
+	LinkedAccount
+	Cadence string
+}
+
+// Bill represents a utility bill
+type Bill struct {
+	ID              string     `json:"id"`
+	ExternalID      string     `json:"external_id"` // Bill ID assigned by the provider, unique per linked account
+	LinkedAccountID string     `json:"linked_account_id"`
+	ProviderID      string     `json:"provider_id"`
+	Amount          Money      `json:"amount"`
+	DueDate         time.Time  `json:"due_date"`
+	Status          BillStatus `json:"status"`
+	BillDate        time.Time  `json:"bill_date"`
+	MissingSince    *time.Time `json:"missing_since,omitempty"` // Set when the provider stopped returning the bill
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// LineItems and Usage detail what the bill charges for, when the
+	// provider sends them
+	LineItems []BillLineItem `json:"line_items,omitempty"`
+	Usage     []UsageReading `json:"usage,omitempty"`
+}
+
+// DetailsDigest fingerprints the line items and usage of the bill so stored
+// details are only rewritten when they change. It is empty when the bill has
+// neither.
+func (b *Bill) DetailsDigest() string {
+	if len(b.LineItems) == 0 && len(b.Usage) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(struct {
+		LineItems []BillLineItem `json:"line_items"`
+		Usage     []UsageReading `json:"usage"`
+	}{b.LineItems, b.Usage})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// BillLineItem is one charge of a bill, e.g. an energy charge, a delivery fee
+// or a tax. Its amount is in the currency of the bill.
+type BillLineItem struct {
+	Description string `json:"description"`
+	Category    string `json:"category,omitempty"` // As named by the provider, e.g. "energy", "delivery", "tax"
+	Amount      Money  `json:"amount"`
+}
+
+// UsageReading is a quantity consumed over a period, e.g. 350 kWh of
+// electricity. Quantity is an exact decimal.
+type UsageReading struct {
+	Quantity    string     `json:"quantity"`
+	Unit        string     `json:"unit"`
+	PeriodStart *time.Time `json:"period_start,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+	MeterID     string     `json:"meter_id,omitempty"`
+}
+
+// usageUnits spells the usage units providers commonly send
+var usageUnits = map[string]string{
+	"kwh": "kWh", "mwh": "MWh", "m3": "m³", "m³": "m³", "ccf": "ccf", "therm": "therm", "therms": "therm",
+	"gal": "gal", "gallon": "gal", "gallons": "gal", "l": "L", "liter": "L", "liters": "L",
+	"mb": "MB", "gb": "GB", "tb": "TB", "min": "min", "minutes": "min", "sms": "SMS",
+}
+
+// ParseUsageReading checks a reading sent by a provider. The quantity must be
+// a non-negative decimal; common units are spelled consistently and other
+// units are kept as sent.
+func ParseUsageReading(quantity, unit string) (UsageReading, error) {
+	quantity = strings.TrimSpace(quantity)
+	whole, fraction, _ := strings.Cut(quantity, ".")
+	if whole == "" || !digitsOnly(whole) || !digitsOnly(fraction) {
+		return UsageReading{}, fmt.Errorf("invalid usage quantity: %q", quantity)
+	}
+	unit = strings.TrimSpace(unit)
+	if unit == "" {
+		return UsageReading{}, fmt.Errorf("usage quantity %s has no unit", quantity)
+	}
+	if known, ok := usageUnits[strings.ToLower(unit)]; ok {
+		unit = known
+	}
+	return UsageReading{Quantity: quantity, Unit: unit}, nil
+}
+
+// BillStatus is where a bill is in its lifecycle
+type BillStatus string
+
+// Bill statuses
+const (
+	BillIssued        BillStatus = "issued"
+	BillUnpaid        BillStatus = "unpaid"
+	BillPartiallyPaid BillStatus = "partially_paid"
+	BillPaid          BillStatus = "paid"
+	BillOverdue       BillStatus = "overdue"
+	BillDisputed      BillStatus = "disputed"
+	BillCancelled     BillStatus = "cancelled"
+)
+
+// billTransitions lists the statuses each status can move to. A cancelled
+// bill stays cancelled, and an overdue bill only leaves overdue once it is
+// paid, disputed or cancelled.
+var billTransitions = map[BillStatus][]BillStatus{
+	BillIssued:        {BillUnpaid, BillPartiallyPaid, BillPaid, BillOverdue, BillDisputed, BillCancelled},
+	BillUnpaid:        {BillPartiallyPaid, BillPaid, BillOverdue, BillDisputed, BillCancelled},
+	BillPartiallyPaid: {BillPaid, BillOverdue, BillDisputed, BillCancelled},
+	BillOverdue:       {BillPartiallyPaid, BillPaid, BillDisputed, BillCancelled},
+	BillDisputed:      {BillUnpaid, BillPartiallyPaid, BillPaid, BillOverdue, BillCancelled},
+	BillPaid:          {BillDisputed},
+	BillCancelled:     nil,
+}
+
+// ParseBillStatus reads a bill status as sent by a provider, ignoring case
+// and accepting "canceled" and spaces for underscores
+func ParseBillStatus(value string) (BillStatus, error) {
+	status := BillStatus(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(value)), " ", "_"))
+	if status == "canceled" {
+		status = BillCancelled
+	}
+	if _, ok := billTransitions[status]; !ok {
+		return "", fmt.Errorf("unknown bill status: %q", value)
+	}
+	return status, nil
+}
+
+// CanTransitionTo reports whether a bill can move from s to next. Staying in
+// the same status is always allowed.
+func (s BillStatus) CanTransitionTo(next BillStatus) bool {
+	if s == next {
+		return true
+	}
+	for _, allowed := range billTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Due reports whether a bill in status s still has to be paid
+func (s BillStatus) Due() bool {
+	switch s {
+	case BillIssued, BillUnpaid, BillPartiallyPaid, BillOverdue:
+		return true
+	}
+	return false
+}
+
+// MarkOverdue moves a bill still due to overdue once its due date is before
+// now, reporting whether it moved. Bills the provider no longer returns are
+// left as they are.
+func (b *Bill) MarkOverdue(now time.Time) bool {
+	if b.MissingSince != nil || !b.Status.Due() || b.Status == BillOverdue || !b.DueDate.Before(now) {
+		return false
+	}
+	b.Status = BillOverdue
+	return true
+}
+
+// Sources of bill status changes
+const (
+	BillStatusSourceProvider = "provider" // The provider returned the new status
+	BillStatusSourceSystem   = "system"   // Changed here, e.g. when the due date passed
+)
+
+// BillUpsertResult counts the outcome of an idempotent bill upsert
+type BillUpsertResult struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Missing   int `json:"missing"`
+}
+
+// Background job types
+const (
+	JobTypeBillRefresh  = "bill_refresh"
+	JobTypeNotification = "notification"
+)
+
+// Job is a unit of background work delivered through the job queue
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"` // Deliveries so far, including the current one
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	EnqueuedAt  time.Time       `json:"enqueued_at"`
+}
+
+// Refresh job statuses
+const (
+	RefreshJobQueued    = "queued"
+	RefreshJobRunning   = "running"
+	RefreshJobCompleted = "completed"
+	RefreshJobPartial   = "partial" // Some accounts failed
+	RefreshJobFailed    = "failed"
+)
+
+// Account refresh statuses
+const (
+	AccountRefreshPending   = "pending"
+	AccountRefreshSucceeded = "succeeded"
+	AccountRefreshSkipped   = "skipped" // Bills were refreshed recently and are still cached
+	AccountRefreshFailed    = "failed"
+)
+
+// Refresh job triggers
+const (
+	RefreshTriggerManual     = "manual"     // Requested through POST /bills/refresh
+	RefreshTriggerScheduled  = "scheduled"  // Queued by the refresh scheduler
+	RefreshTriggerRevalidate = "revalidate" // Queued after GET /bills served fallback bills
+)
+
+// RefreshJob tracks an asynchronous refresh of a user's bills
+type RefreshJob struct {
+	ID          string           `json:"id"`
+	UserID      string           `json:"user_id"`
+	Trigger     string           `json:"trigger"`
+	Status      string           `json:"status"`
+	Error       string           `json:"error,omitempty"`
+	Accounts    []AccountRefresh `json:"accounts"`
+	Totals      BillUpsertResult `json:"totals"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty"`
+}
+
+// AccountRefresh reports the progress of one linked account within a refresh job
+type AccountRefresh struct {
+	LinkedAccountID string           `json:"linked_account_id"`
+	ProviderID      string           `json:"provider_id"`
+	Status          string           `json:"status"`
+	Attempts        int              `json:"attempts"`
+	Error           string           `json:"error,omitempty"`
+	Bills           BillUpsertResult `json:"bills"`
 }
 
 // BillSummary represents aggregated bill information
 type BillSummary struct {
 	BillCount int     `json:"bill_count"`
 	Bills     []Bill  `json:"bills"`
-	TotalDue  float64 `json:"total_due"`
+	TotalDue  []Money `json:"total_due"` // Per currency
+	// Total is TotalDue converted to the user's currency, omitted when some
+	// currency has no exchange rate
+	Total    *ConvertedTotal     `json:"total,omitempty"`
+	Accounts []AccountSyncStatus `json:"accounts,omitempty"`
+}
+
+// Orders bill searches can be sorted in; a "-" prefix sorts descending
+const (
+	BillSortDueDate  = "due_date"
+	BillSortAmount   = "amount"
+	BillSortBillDate = "bill_date"
+)
+
+// Number of bills on a page of a bill search
+const (
+	DefaultBillPageSize = 50
+	MaxBillPageSize     = 200
+)
+
+// BillQuery selects a page of the bills stored for a user. Zero fields do not
+// filter. Bills the provider no longer returns are left out.
+type BillQuery struct {
+	UserID     string
+	Statuses   []BillStatus
+	ProviderID string
+	// DueFrom and DueTo select bills due at or after DueFrom and before DueTo
+	DueFrom *time.Time
+	DueTo   *time.Time
+	// Currency selects bills in one currency, which MinAmount and MaxAmount
+	// are in. Both bounds are inclusive minor units.
+	Currency  string
+	MinAmount *int64
+	MaxAmount *int64
+	// Sort is one of the bill sort orders, newest due date first when empty
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// SortOrder returns the field q sorts on and whether it sorts descending
+func (q BillQuery) SortOrder() (string, bool) {
+	if q.Sort == "" {
+		return BillSortDueDate, true
+	}
+	return strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+}
+
+// ValidBillSort reports whether sort is a bill sort order
+func ValidBillSort(sort string) bool {
+	switch strings.TrimPrefix(sort, "-") {
+	case BillSortDueDate, BillSortAmount, BillSortBillDate:
+		return true
+	}
+	return false
+}
+
+// BillPage is a page of bills. NextCursor fetches the next page and is empty
+// on the last one.
+type BillPage struct {
+	Bills      []*Bill `json:"bills"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// RateLimitResult is the outcome of counting a request against a limit
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the window frees room for another request
+	Reset time.Duration
 }
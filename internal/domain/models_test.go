@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBillStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to BillStatus
+		want     bool
+	}{
+		{BillUnpaid, BillUnpaid, true},
+		{BillIssued, BillUnpaid, true},
+		{BillUnpaid, BillOverdue, true},
+		{BillOverdue, BillPaid, true},
+		{BillOverdue, BillUnpaid, false},
+		{BillPaid, BillDisputed, true},
+		{BillPaid, BillUnpaid, false},
+		{BillDisputed, BillUnpaid, true},
+		{BillCancelled, BillPaid, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.from.CanTransitionTo(tt.to), "%s to %s", tt.from, tt.to)
+	}
+}
+
+func TestParseBillStatus(t *testing.T) {
+	for value, want := range map[string]BillStatus{
+		"paid":           BillPaid,
+		" Overdue ":      BillOverdue,
+		"partially paid": BillPartiallyPaid,
+		"canceled":       BillCancelled,
+	} {
+		status, err := ParseBillStatus(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, want, status, value)
+	}
+
+	_, err := ParseBillStatus("refunded")
+	assert.Error(t, err)
+}
+
+func TestBillMarkOverdue(t *testing.T) {
+	now := time.Now()
+	missing := now.Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		bill Bill
+		want BillStatus
+	}{
+		{"past due", Bill{Status: BillUnpaid, DueDate: now.Add(-time.Hour)}, BillOverdue},
+		{"partially paid", Bill{Status: BillPartiallyPaid, DueDate: now.Add(-time.Hour)}, BillOverdue},
+		{"not yet due", Bill{Status: BillUnpaid, DueDate: now.Add(time.Hour)}, BillUnpaid},
+		{"paid", Bill{Status: BillPaid, DueDate: now.Add(-time.Hour)}, BillPaid},
+		{"disputed", Bill{Status: BillDisputed, DueDate: now.Add(-time.Hour)}, BillDisputed},
+		{"missing", Bill{Status: BillUnpaid, DueDate: now.Add(-time.Hour), MissingSince: &missing}, BillUnpaid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved := tt.bill.MarkOverdue(now)
+			assert.Equal(t, tt.want, tt.bill.Status)
+			assert.Equal(t, tt.want == BillOverdue, moved)
+		})
+	}
+}
+
+func TestParseUsageReading(t *testing.T) {
+	reading, err := ParseUsageReading(" 350.5 ", "KWH")
+	assert.NoError(t, err)
+	assert.Equal(t, UsageReading{Quantity: "350.5", Unit: "kWh"}, reading)
+
+	reading, err = ParseUsageReading("12", "m3")
+	assert.NoError(t, err)
+	assert.Equal(t, "m³", reading.Unit)
+
+	reading, err = ParseUsageReading("3", "kiloliters")
+	assert.NoError(t, err)
+	assert.Equal(t, "kiloliters", reading.Unit)
+
+	for _, invalid := range [][2]string{{"-1", "kWh"}, {"1e3", "kWh"}, {"", "kWh"}, {"10", " "}} {
+		_, err := ParseUsageReading(invalid[0], invalid[1])
+		assert.Error(t, err, invalid[0]+" "+invalid[1])
+	}
+}
+
+func TestBillDetailsDigest(t *testing.T) {
+	bill := Bill{}
+	assert.Empty(t, bill.DetailsDigest())
+
+	bill.LineItems = []BillLineItem{{Description: "Energy charge", Amount: Money{4120, "EUR"}}}
+	digest := bill.DetailsDigest()
+	assert.NotEmpty(t, digest)
+
+	bill.LineItems[0].Amount.Minor = 4121
+	assert.NotEqual(t, digest, bill.DetailsDigest())
+}
@@ -0,0 +1,192 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts that do not name one
+const DefaultCurrency = "USD"
+
+// Money is an exact amount in the minor units of an ISO 4217 currency, e.g.
+// cents for USD
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// minorDigits lists the currencies whose minor unit is not a hundredth
+var minorDigits = map[string]int{
+	"BHD": 3, "BIF": 0, "CLF": 4, "CLP": 0, "DJF": 0, "GNF": 0, "IQD": 3,
+	"ISK": 0, "JOD": 3, "JPY": 0, "KMF": 0, "KRW": 0, "KWD": 3, "LYD": 3,
+	"OMR": 3, "PYG": 0, "RWF": 0, "TND": 3, "UGX": 0, "UYI": 0, "UYW": 4,
+	"VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// MinorDigits returns the number of decimals of currency's minor unit
+func MinorDigits(currency string) int {
+	if digits, ok := minorDigits[currency]; ok {
+		return digits
+	}
+	return 2
+}
+
+// ParseCurrency checks that code is an ISO 4217 code and returns it in
+// upper case. An empty code is the default currency.
+func ParseCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("invalid currency: %q", code)
+	}
+	return code, nil
+}
+
+// ParseMoney reads a decimal amount such as "12.34" in currency. Amounts more
+// precise than the currency's minor unit are rejected rather than rounded.
+func ParseMoney(amount, currency string) (Money, error) {
+	m, _, err := parseMoney(amount, currency, false)
+	return m, err
+}
+
+// ParseMoneyRounded reads a decimal amount like ParseMoney, but rounds
+// amounts more precise than the currency's minor unit half to even. rounded
+// reports whether the amount lost precision.
+func ParseMoneyRounded(amount, currency string) (m Money, rounded bool, err error) {
+	return parseMoney(amount, currency, true)
+}
+
+// parseMoney reads a decimal amount, rounding it half to even when it is
+// more precise than currency allows and round is set
+func parseMoney(amount, currency string, round bool) (Money, bool, error) {
+	currency, err := ParseCurrency(currency)
+	if err != nil {
+		return Money{}, false, err
+	}
+
+	value := strings.TrimSpace(amount)
+	sign := ""
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		sign, value = value[:1], value[1:]
+	}
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" || !digitsOnly(whole) || !digitsOnly(fraction) {
+		return Money{}, false, fmt.Errorf("invalid amount: %q", amount)
+	}
+
+	digits := MinorDigits(currency)
+	rounded, roundUp := false, false
+	if len(fraction) > digits {
+		// The dropped digits without trailing zeros compare to "5" as the
+		// dropped fraction compares to a half
+		dropped := strings.TrimRight(fraction[digits:], "0")
+		if dropped != "" {
+			if !round {
+				return Money{}, false, fmt.Errorf("amount %q is more precise than %s allows", amount, currency)
+			}
+			rounded = true
+			kept := whole + fraction[:digits]
+			roundUp = dropped > "5" || (dropped == "5" && (kept[len(kept)-1]-'0')%2 == 1)
+		}
+		fraction = fraction[:digits]
+	}
+	fraction += strings.Repeat("0", digits-len(fraction))
+
+	minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, false, fmt.Errorf("invalid amount: %q", amount)
+	}
+	if roundUp {
+		minor++
+	}
+	if sign == "-" {
+		minor = -minor
+	}
+	return Money{Minor: minor, Currency: currency}, rounded, nil
+}
+
+func digitsOnly(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
+
+// Decimal formats the amount without its currency, e.g. "12.34"
+func (m Money) Decimal() string {
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	digits := MinorDigits(m.Currency)
+	if digits == 0 {
+		return sign + strconv.FormatInt(minor, 10)
+	}
+	padded := fmt.Sprintf("%0*d", digits+1, minor)
+	return sign + padded[:len(padded)-digits] + "." + padded[len(padded)-digits:]
+}
+
+// String formats the amount with its currency, e.g. "12.34 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// moneyJSON is how Money is encoded: the amount is a decimal string so that
+// clients parsing it as a float do so knowingly
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"amount": "12.34", "currency": "USD"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Decimal(), Currency: m.Currency})
+}
+
+// UnmarshalJSON decodes Money encoded by MarshalJSON. A bare number, as
+// stored before amounts had a currency, is read in the default currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		parsed, err := ParseMoney(number.String(), DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	var encoded moneyJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	parsed, err := ParseMoney(encoded.Amount, encoded.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MoneyTotals sums amounts per currency
+type MoneyTotals map[string]int64
+
+// Add adds m to the total of its currency
+func (t MoneyTotals) Add(m Money) {
+	t[m.Currency] += m.Minor
+}
+
+// List returns the totals sorted by currency
+func (t MoneyTotals) List() []Money {
+	totals := make([]Money, 0, len(t))
+	for currency, minor := range t {
+		totals = append(totals, Money{Minor: minor, Currency: currency})
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return totals[i].Currency < totals[j].Currency
+	})
+	return totals
+}
@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		want             Money
+	}{
+		{"12.34", "USD", Money{1234, "USD"}},
+		{"12.3", "usd", Money{1230, "USD"}},
+		{"12", "", Money{1200, DefaultCurrency}},
+		{"-0.05", "EUR", Money{-5, "EUR"}},
+		{"12.3400", "USD", Money{1234, "USD"}},
+		{"1500", "JPY", Money{1500, "JPY"}},
+		{"1.234", "KWD", Money{1234, "KWD"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.amount, tt.currency)
+		assert.NoError(t, err, tt.amount)
+		assert.Equal(t, tt.want, got, tt.amount)
+	}
+
+	for _, invalid := range [][2]string{{"12.345", "USD"}, {"1.5", "JPY"}, {"1e3", "USD"}, {"", "USD"}, {"12", "US"}, {"12", "U$D"}} {
+		_, err := ParseMoney(invalid[0], invalid[1])
+		assert.Error(t, err, invalid[0]+" "+invalid[1])
+	}
+}
+
+func TestParseMoneyRounded(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		want             Money
+		rounded          bool
+	}{
+		{"12.34", "USD", Money{1234, "USD"}, false},
+		{"12.3400", "USD", Money{1234, "USD"}, false},
+		{"0.125", "USD", Money{12, "USD"}, true},
+		{"0.135", "USD", Money{14, "USD"}, true},
+		{"0.1251", "USD", Money{13, "USD"}, true},
+		{"0.1249", "USD", Money{12, "USD"}, true},
+		{"-0.135", "EUR", Money{-14, "EUR"}, true},
+		{"1.5", "JPY", Money{2, "JPY"}, true},
+		{"2.5", "JPY", Money{2, "JPY"}, true},
+		{"1.2345", "KWD", Money{1234, "KWD"}, true},
+	}
+	for _, tt := range tests {
+		got, rounded, err := ParseMoneyRounded(tt.amount, tt.currency)
+		assert.NoError(t, err, tt.amount)
+		assert.Equal(t, tt.want, got, tt.amount)
+		assert.Equal(t, tt.rounded, rounded, tt.amount)
+	}
+
+	_, _, err := ParseMoneyRounded("1e3", "USD")
+	assert.Error(t, err)
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	assert.Equal(t, "12.34", Money{1234, "USD"}.Decimal())
+	assert.Equal(t, "0.05", Money{5, "USD"}.Decimal())
+	assert.Equal(t, "-0.05", Money{-5, "USD"}.Decimal())
+	assert.Equal(t, "1500", Money{1500, "JPY"}.Decimal())
+	assert.Equal(t, "1.234 KWD", Money{1234, "KWD"}.String())
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(Money{1234, "EUR"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount": "12.34", "currency": "EUR"}`, string(data))
+
+	var decoded Money
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, Money{1234, "EUR"}, decoded)
+
+	// Amounts cached before they had a currency are plain numbers
+	assert.NoError(t, json.Unmarshal([]byte(`42.5`), &decoded))
+	assert.Equal(t, Money{4250, DefaultCurrency}, decoded)
+}
+
+func TestMoneyTotals(t *testing.T) {
+	totals := MoneyTotals{}
+	// Summing as floats would give 0.30000000000000004
+	totals.Add(Money{10, "USD"})
+	totals.Add(Money{20, "USD"})
+	totals.Add(Money{500, "EUR"})
+	assert.Equal(t, []Money{{500, "EUR"}, {30, "USD"}}, totals.List())
+}
@@ -0,0 +1,217 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoExchangeRate is returned when an amount cannot be converted for lack
+// of a rate
+var ErrNoExchangeRate = errors.New("no exchange rate")
+
+// rateDateLayout is how exchange rate dates are written
+const rateDateLayout = "2006-01-02"
+
+// ExchangeRates are the rates of currencies against a base currency on a
+// date: 1 unit of Base is worth Rates[currency] units of currency. Rates are
+// exact so converting the same amounts always gives the same total.
+type ExchangeRates struct {
+	Base  string
+	Date  time.Time
+	Rates map[string]*big.Rat
+}
+
+// SetRate sets the rate of currency from a decimal such as "0.9215"
+func (r *ExchangeRates) SetRate(currency, rate string) error {
+	currency, err := ParseCurrency(currency)
+	if err != nil {
+		return err
+	}
+	value, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok || value.Sign() <= 0 {
+		return fmt.Errorf("invalid exchange rate for %s: %q", currency, rate)
+	}
+	if r.Rates == nil {
+		r.Rates = make(map[string]*big.Rat)
+	}
+	r.Rates[currency] = value
+	return nil
+}
+
+// rate returns the rate of currency, 1 for the base currency
+func (r *ExchangeRates) rate(currency string) (*big.Rat, bool) {
+	if currency == r.Base {
+		return big.NewRat(1, 1), true
+	}
+	rate, ok := r.Rates[currency]
+	return rate, ok
+}
+
+// Convert converts m to currency to, rounding half away from zero to the
+// minor unit of to
+func (r *ExchangeRates) Convert(m Money, to string) (Money, error) {
+	return r.sum([]Money{m}, to)
+}
+
+// Total converts amounts to currency to and sums them. The sum is rounded
+// once, after converting every amount exactly.
+func (r *ExchangeRates) Total(amounts []Money, to string) (*ConvertedTotal, error) {
+	total, err := r.sum(amounts, to)
+	if err != nil {
+		return nil, err
+	}
+	return &ConvertedTotal{Money: total, RatesDate: r.Date}, nil
+}
+
+func (r *ExchangeRates) sum(amounts []Money, to string) (Money, error) {
+	toRate, ok := r.rate(to)
+	if !ok {
+		return Money{}, fmt.Errorf("%w for %s", ErrNoExchangeRate, to)
+	}
+
+	// Each amount in minor units of to is
+	// minor / 10^digits(from) / rate(from) * rate(to) * 10^digits(to)
+	sum := new(big.Rat)
+	for _, m := range amounts {
+		fromRate, ok := r.rate(m.Currency)
+		if !ok {
+			return Money{}, fmt.Errorf("%w for %s", ErrNoExchangeRate, m.Currency)
+		}
+		amount := new(big.Rat).SetInt64(m.Minor)
+		amount.Quo(amount, fromRate)
+		amount.Mul(amount, toRate)
+		amount.Mul(amount, minorScale(MinorDigits(to)))
+		amount.Quo(amount, minorScale(MinorDigits(m.Currency)))
+		sum.Add(sum, amount)
+	}
+
+	minor, err := roundHalfAway(sum)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Minor: minor, Currency: to}, nil
+}
+
+// minorScale returns 10^digits
+func minorScale(digits int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil))
+}
+
+// roundHalfAway rounds x to the nearest integer, halves away from zero
+func roundHalfAway(x *big.Rat) (int64, error) {
+	num := new(big.Int).Abs(x.Num())
+	quo, rem := new(big.Int).QuoRem(num, x.Denom(), new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(x.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if x.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("converted amount %s is out of range", x.FloatString(2))
+	}
+	return quo.Int64(), nil
+}
+
+// exchangeRatesJSON is how ExchangeRates are read, e.g.
+// {"base": "USD", "date": "2024-05-01", "rates": {"EUR": "0.9215"}}
+type exchangeRatesJSON struct {
+	Base  string                 `json:"base"`
+	Date  string                 `json:"date"`
+	Rates map[string]json.Number `json:"rates"`
+}
+
+// MarshalJSON encodes the rates as decimal strings
+func (r ExchangeRates) MarshalJSON() ([]byte, error) {
+	rates := make(map[string]string, len(r.Rates))
+	for currency, rate := range r.Rates {
+		rates[currency] = formatRate(rate)
+	}
+	return json.Marshal(struct {
+		Base  string            `json:"base"`
+		Date  string            `json:"date"`
+		Rates map[string]string `json:"rates"`
+	}{r.Base, r.Date.Format(rateDateLayout), rates})
+}
+
+// UnmarshalJSON decodes and validates rates. Rates may be decimal strings or
+// numbers; the base defaults to the default currency.
+func (r *ExchangeRates) UnmarshalJSON(data []byte) error {
+	var encoded exchangeRatesJSON
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	base, err := ParseCurrency(encoded.Base)
+	if err != nil {
+		return err
+	}
+	date, err := time.Parse(rateDateLayout, encoded.Date)
+	if err != nil {
+		return fmt.Errorf("invalid exchange rate date: %q", encoded.Date)
+	}
+	if len(encoded.Rates) == 0 {
+		return errors.New("exchange rates are empty")
+	}
+
+	parsed := ExchangeRates{Base: base, Date: date}
+	for currency, rate := range encoded.Rates {
+		if err := parsed.SetRate(currency, rate.String()); err != nil {
+			return err
+		}
+	}
+	// The base is worth 1 of itself whatever the rates say
+	delete(parsed.Rates, base)
+	*r = parsed
+	return nil
+}
+
+// Currencies returns the currencies with a rate, sorted
+func (r *ExchangeRates) Currencies() []string {
+	currencies := make([]string, 0, len(r.Rates))
+	for currency := range r.Rates {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// formatRate writes rate as a decimal without trailing zeros
+func formatRate(rate *big.Rat) string {
+	value := rate.FloatString(12)
+	if strings.Contains(value, ".") {
+		value = strings.TrimRight(strings.TrimRight(value, "0"), ".")
+	}
+	return value
+}
+
+// FormatRate writes the rate of currency as a decimal, "" when it has none
+func (r *ExchangeRates) FormatRate(currency string) string {
+	rate, ok := r.rate(currency)
+	if !ok {
+		return ""
+	}
+	return formatRate(rate)
+}
+
+// ConvertedTotal is a total of amounts in several currencies converted to one
+type ConvertedTotal struct {
+	Money
+	// RatesDate is the date of the exchange rates used
+	RatesDate time.Time
+}
+
+// MarshalJSON encodes the total as
+// {"amount": "12.34", "currency": "EUR", "rates_date": "2024-05-01"}
+func (t ConvertedTotal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount    string `json:"amount"`
+		Currency  string `json:"currency"`
+		RatesDate string `json:"rates_date"`
+	}{t.Decimal(), t.Currency, t.RatesDate.Format(rateDateLayout)})
+}
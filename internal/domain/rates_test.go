@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangeRatesConvert(t *testing.T) {
+	var rates ExchangeRates
+	assert.NoError(t, json.Unmarshal([]byte(`{"base": "usd", "date": "2024-05-01", "rates": {"EUR": "0.9215", "JPY": 155.3, "GBP": "0.8", "USD": "2"}}`), &rates))
+	assert.Equal(t, "USD", rates.Base)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), rates.Date)
+	assert.Equal(t, []string{"EUR", "GBP", "JPY"}, rates.Currencies())
+
+	tests := []struct {
+		from Money
+		to   string
+		want Money
+	}{
+		{Money{1000, "USD"}, "EUR", Money{922, "EUR"}},   // 9.215 rounds up
+		{Money{-1000, "USD"}, "EUR", Money{-922, "EUR"}}, // and away from zero
+		{Money{1000, "USD"}, "JPY", Money{1553, "JPY"}},
+		{Money{1553, "JPY"}, "USD", Money{1000, "USD"}},
+		{Money{500, "GBP"}, "EUR", Money{576, "EUR"}}, // Through the base: 5 / 0.8 * 0.9215
+		{Money{1234, "EUR"}, "EUR", Money{1234, "EUR"}},
+	}
+	for _, tt := range tests {
+		got, err := rates.Convert(tt.from, tt.to)
+		assert.NoError(t, err, tt.from.String())
+		assert.Equal(t, tt.want, got, tt.from.String())
+	}
+
+	// Totals are rounded once: 3 x 1 XYZ is 1 USD, not 3 x 0.33
+	var thirds ExchangeRates
+	assert.NoError(t, thirds.SetRate("XYZ", "3"))
+	thirds.Base = "USD"
+	total, err := thirds.Total([]Money{{100, "XYZ"}, {100, "XYZ"}, {100, "XYZ"}}, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, Money{100, "USD"}, total.Money)
+
+	_, err = rates.Convert(Money{100, "CHF"}, "USD")
+	assert.True(t, errors.Is(err, ErrNoExchangeRate))
+	_, err = rates.Total([]Money{{100, "USD"}}, "CHF")
+	assert.True(t, errors.Is(err, ErrNoExchangeRate))
+}
+
+func TestExchangeRatesJSON(t *testing.T) {
+	var rates ExchangeRates
+	for _, invalid := range []string{
+		`{"base": "USD", "date": "2024-05-01", "rates": {}}`,
+		`{"base": "USD", "date": "May 1", "rates": {"EUR": "0.9"}}`,
+		`{"base": "USD", "date": "2024-05-01", "rates": {"EUR": "0"}}`,
+		`{"base": "USD", "date": "2024-05-01", "rates": {"EUR": "-1"}}`,
+		`{"base": "USD", "date": "2024-05-01", "rates": {"EURO": "0.9"}}`,
+	} {
+		assert.Error(t, json.Unmarshal([]byte(invalid), &rates), invalid)
+	}
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"date": "2024-05-01", "rates": {"EUR": "0.92150", "JPY": "155"}}`), &rates))
+	data, err := json.Marshal(rates)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"base": "USD", "date": "2024-05-01", "rates": {"EUR": "0.9215", "JPY": "155"}}`, string(data))
+
+	total, err := rates.Total([]Money{{1000, "USD"}}, "EUR")
+	assert.NoError(t, err)
+	data, err = json.Marshal(total)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount": "9.22", "currency": "EUR", "rates_date": "2024-05-01"}`, string(data))
+}
@@ -0,0 +1,172 @@
+package mock
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessTokenTTL is kept short so token refresh is exercised locally
+const accessTokenTTL = 5 * time.Minute
+
+// authServer is a minimal OAuth2 authorization server supporting the
+// authorization-code grant with PKCE and refresh tokens. Every authorization
+// is approved automatically for a new subject.
+type authServer struct {
+	mu            sync.Mutex
+	subjects      int
+	codes         map[string]authCode
+	accessTokens  map[string]accessToken
+	refreshTokens map[string]string // refresh token -> subject
+}
+
+type authCode struct {
+	subject       string
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+type accessToken struct {
+	subject   string
+	expiresAt time.Time
+}
+
+func newAuthServer() *authServer {
+	return &authServer{
+		codes:         make(map[string]authCode),
+		accessTokens:  make(map[string]accessToken),
+		refreshTokens: make(map[string]string),
+	}
+}
+
+// handleAuthorize implements GET /oauth/authorize
+func (a *authServer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("client_id") == "" {
+		http.Error(w, "unsupported authorization request", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	a.mu.Lock()
+	a.subjects++
+	code := randomToken()
+	a.codes[code] = authCode{
+		subject:       fmt.Sprintf("oauth-user-%d", a.subjects),
+		clientID:      query.Get("client_id"),
+		redirectURI:   redirectURI.String(),
+		codeChallenge: query.Get("code_challenge"),
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	a.mu.Unlock()
+
+	callback := redirectURI.Query()
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// handleToken implements POST /oauth/token
+func (a *authServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, "invalid_request")
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var subject string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, ok := a.codes[r.PostForm.Get("code")]
+		delete(a.codes, r.PostForm.Get("code"))
+		if !ok || time.Now().After(code.expiresAt) ||
+			code.clientID != r.PostForm.Get("client_id") ||
+			code.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != code.codeChallenge {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		subject = code.subject
+	case "refresh_token":
+		var ok bool
+		subject, ok = a.refreshTokens[r.PostForm.Get("refresh_token")]
+		if !ok {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		// Refresh tokens are rotated on every use
+		delete(a.refreshTokens, r.PostForm.Get("refresh_token"))
+	default:
+		writeOAuthError(w, "unsupported_grant_type")
+		return
+	}
+
+	access, refresh := randomToken(), randomToken()
+	a.accessTokens[access] = accessToken{subject: subject, expiresAt: time.Now().Add(accessTokenTTL)}
+	a.refreshTokens[refresh] = subject
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  access,
+		"refresh_token": refresh,
+		"token_type":    "Bearer",
+		"expires_in":    int(accessTokenTTL.Seconds()),
+	})
+}
+
+// subject returns the subject of a valid bearer token on r. ok is false when
+// the request carries no bearer token; valid is false when it is unknown or expired.
+func (a *authServer) subject(r *http.Request) (subject string, ok, valid bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return "", false, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	issued, exists := a.accessTokens[token]
+	if !exists || time.Now().After(issued.expiresAt) {
+		return "", true, false
+	}
+	return issued.subject, true, true
+}
+
+func writeOAuthError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func randomToken() string {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
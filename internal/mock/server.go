@@ -3,28 +3,58 @@ package mock
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
 	"net/http"
 	"time"
 )
 
 type Bill struct {
-	ID          string    `json:"id"`
-	Provider    string    `json:"provider"`
-	Amount      float64   `json:"amount"`
-	DueDate     time.Time `json:"due_date"`
-	Status      string    `json:"status"`
-	Description string    `json:"description"`
+	ID          string     `json:"id"`
+	Provider    string     `json:"provider"`
+	Amount      float64    `json:"amount"`
+	DueDate     time.Time  `json:"due_date"`
+	Status      string     `json:"status"`
+	Description string     `json:"description"`
+	LineItems   []LineItem `json:"line_items,omitempty"`
+	Usage       []Usage    `json:"usage,omitempty"`
+}
+
+// LineItem is one charge of a bill
+type LineItem struct {
+	Description string  `json:"description"`
+	Category    string  `json:"category"`
+	Amount      float64 `json:"amount"`
+}
+
+// Usage is what was consumed over a bill's period
+type Usage struct {
+	Quantity    float64   `json:"quantity"`
+	Unit        string    `json:"unit"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	MeterID     string    `json:"meter_id"`
+}
+
+// usageUnits is the unit usage of each provider is measured in
+var usageUnits = map[string]string{
+	"Electricity Co":    "kWh",
+	"Water Works":       "m3",
+	"Gas Supply":        "therm",
+	"Internet Provider": "GB",
+	"Phone Company":     "min",
 }
 
 type MockServer struct {
 	port      int
 	providers []string
+	auth      *authServer
 }
 
 func NewMockServer(port int) *MockServer {
 	return &MockServer{
 		port: port,
+		auth: newAuthServer(),
 		providers: []string{
 			"Electricity Co",
 			"Water Works",
@@ -38,6 +68,9 @@ func NewMockServer(port int) *MockServer {
 func (s *MockServer) Start() error {
 	http.HandleFunc("/bills", s.handleBills)
 	http.HandleFunc("/bills/", s.handleBill)
+	http.HandleFunc("/accounts/validate", s.handleValidate)
+	http.HandleFunc("/oauth/authorize", s.auth.handleAuthorize)
+	http.HandleFunc("/oauth/token", s.auth.handleToken)
 	http.HandleFunc("/health", s.handleHealth)
 
 	addr := fmt.Sprintf(":%d", s.port)
@@ -50,7 +83,66 @@ func (s *MockServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+// handleValidate accepts any non-empty credentials except a password or token
+// of "invalid", or a valid OAuth2 bearer token, and returns account numbers
+// derived from them
+func (s *MockServer) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if subject, ok, valid := s.auth.subject(r); ok {
+		if !valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid access token"})
+			return
+		}
+		s.writeAccounts(w, subject)
+		return
+	}
+
+	var req struct {
+		Credentials map[string]string `json:"credentials"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Credentials) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if req.Credentials["password"] == "invalid" || req.Credentials["token"] == "invalid" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid credentials"})
+		return
+	}
+
+	identity := req.Credentials["username"]
+	if identity == "" {
+		identity = req.Credentials["token"]
+	}
+	s.writeAccounts(w, identity)
+}
+
+// writeAccounts responds with the account number derived from identity
+func (s *MockServer) writeAccounts(w http.ResponseWriter, identity string) {
+	h := fnv.New32a()
+	h.Write([]byte(identity))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{
+		"accounts": {fmt.Sprintf("ACC-%08d", h.Sum32()%100000000)},
+	})
+}
+
 func (s *MockServer) handleBills(w http.ResponseWriter, r *http.Request) {
+	// Requests from OAuth2 providers must carry a valid access token
+	if _, ok, valid := s.auth.subject(r); ok && !valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid access token"})
+		return
+	}
+
 	// Simulate random delay
 	time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
 
@@ -61,7 +153,12 @@ func (s *MockServer) handleBills(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bills := s.generateRandomBills(5)
+	var bills []Bill
+	if accountID := r.URL.Query().Get("account_id"); accountID != "" {
+		bills = s.generateAccountBills(accountID, 5)
+	} else {
+		bills = s.generateRandomBills(5)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(bills)
 }
@@ -90,6 +187,61 @@ func (s *MockServer) generateRandomBills(count int) []Bill {
 	return bills
 }
 
+// generateAccountBills returns one bill per month for the last count months.
+// Bill IDs and amounts are stable for an account so repeated fetches return
+// the same bills; only the status of the latest bill changes over time.
+func (s *MockServer) generateAccountBills(accountID string, count int) []Bill {
+	h := fnv.New64a()
+	h.Write([]byte(accountID))
+	seed := h.Sum64()
+	provider := s.providers[seed%uint64(len(s.providers))]
+
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	bills := make([]Bill, count)
+	for i := 0; i < count; i++ {
+		period := month.AddDate(0, -i, 0)
+		rng := rand.New(rand.NewSource(int64(seed) + period.Unix()))
+
+		dueDate := period.AddDate(0, 0, 24)
+		status := "paid"
+		if i == 0 {
+			status = "unpaid"
+			if now.After(dueDate) {
+				status = "overdue"
+			}
+		}
+
+		// The charges add up to the bill: a tenth is tax and up to a fifth
+		// of the rest is the delivery fee
+		cents := rng.Intn(100000)
+		tax := cents / 10
+		delivery := rng.Intn((cents-tax)/5 + 1)
+		bills[i] = Bill{
+			ID:          fmt.Sprintf("BILL-%s-%s", accountID, period.Format("200601")),
+			Provider:    provider,
+			Amount:      float64(cents) / 100,
+			DueDate:     dueDate,
+			Status:      status,
+			Description: fmt.Sprintf("%s bill for %s", provider, period.Format("January 2006")),
+			LineItems: []LineItem{
+				{Description: "Usage charge", Category: "usage", Amount: float64(cents-tax-delivery) / 100},
+				{Description: "Delivery fee", Category: "delivery", Amount: float64(delivery) / 100},
+				{Description: "Taxes", Category: "tax", Amount: float64(tax) / 100},
+			},
+			Usage: []Usage{{
+				Quantity:    float64(rng.Intn(100000)) / 100,
+				Unit:        usageUnits[provider],
+				PeriodStart: period.AddDate(0, -1, 0),
+				PeriodEnd:   period,
+				MeterID:     fmt.Sprintf("MTR-%s", accountID),
+			}},
+		}
+	}
+	return bills
+}
+
 func (s *MockServer) generateRandomBill() Bill {
 	statuses := []string{"paid", "unpaid", "overdue"}
 	status := statuses[rand.Intn(len(statuses))]
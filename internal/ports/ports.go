@@ -17,21 +17,84 @@ type UserRepository interface {
 	ListUsers(ctx context.Context) ([]*domain.User, error)
 }
 
+// ProviderRepository defines the persistence used by provider adapters
+type ProviderRepository interface {
+	GetProviderByID(ctx context.Context, id string) (*domain.Provider, error)
+	ListProviders(ctx context.Context) ([]*domain.Provider, error)
+	UpdateLinkedAccount(ctx context.Context, account *domain.LinkedAccount) error
+}
+
 // AccountRepository defines the interface for account persistence
 type AccountRepository interface {
-	SaveAccount(ctx context.Context, account domain.LinkedAccount) (string, error)
+	// SaveAccounts stores accounts in a single transaction, none of them when
+	// one fails
+	SaveAccounts(ctx context.Context, accounts []domain.LinkedAccount) error
 	GetAccountsByUserID(ctx context.Context, userID string) ([]domain.LinkedAccount, error)
 	DeleteAccount(ctx context.Context, accountID string) (bool, error)
 }
 
+// SyncStateRepository records the outcome of fetching the bills of linked accounts
+type SyncStateRepository interface {
+	RecordSyncSuccess(ctx context.Context, id string, at time.Time) error
+	RecordSyncFailure(ctx context.Context, id string, at time.Time, status, cause string) error
+}
+
 // BillRepository defines the interface for bill persistence
 type BillRepository interface {
 	SaveBill(ctx context.Context, bill domain.Bill) error
+	// GetBillByID returns a bill with its line items and usage, or nil when
+	// it does not exist
+	GetBillByID(ctx context.Context, id string) (*domain.Bill, error)
+	GetBillsByLinkedAccountID(ctx context.Context, linkedAccountID string) ([]*domain.Bill, error)
+	// SearchBills returns a page of the stored bills of q.UserID. It returns
+	// domain.ErrInvalidCursor for a cursor from another search.
+	SearchBills(ctx context.Context, q domain.BillQuery) (*domain.BillPage, error)
+}
+
+// InsightsRepository aggregates the stored bills spending insights are
+// computed from
+type InsightsRepository interface {
+	GetSpendingAggregates(ctx context.Context, q domain.SpendingQuery) (*domain.SpendingAggregates, error)
+}
+
+// ProviderAdapter defines the contract every third-party provider integration implements
+type ProviderAdapter interface {
+	// FetchBills retrieves the bills of a linked account using its decrypted credentials
+	FetchBills(ctx context.Context, account domain.LinkedAccount, credentials domain.Credentials) ([]*domain.Bill, error)
+
+	// ValidateCredentials validates the provided credentials with the provider and
+	// returns the provider-side account numbers they give access to. It returns
+	// domain.ErrInvalidCredentials when the provider rejects the credentials.
+	ValidateCredentials(ctx context.Context, credentials domain.Credentials) ([]string, error)
+
+	// Capabilities reports the optional features the provider supports
+	Capabilities() domain.ProviderCapabilities
+
+	// GetProviderInfo returns information about the provider
+	GetProviderInfo() *domain.Provider
 }
 
-// ProviderAPIService defines the interface for third-party provider APIs
-type ProviderAPIService interface {
-	FetchBills(ctx context.Context, account domain.LinkedAccount) ([]*domain.Bill, error)
+// ProviderRegistry resolves provider adapters and the credentials they need
+type ProviderRegistry interface {
+	// Get returns the adapter for a registered provider
+	Get(ctx context.Context, providerID string) (ProviderAdapter, error)
+
+	// Credentials returns the decrypted credentials of a linked account
+	Credentials(account domain.LinkedAccount) (domain.Credentials, error)
+}
+
+// CredentialVault encrypts provider credentials at rest
+type CredentialVault interface {
+	// Seal encrypts plaintext and returns the ciphertext and master key
+	// version used. The ciphertext only opens with the same aad, the ID of
+	// the linked account it belongs to.
+	Seal(plaintext, aad string) (string, int, error)
+
+	// Open decrypts a value sealed under the given master key version for aad
+	Open(sealed string, keyVersion int, aad string) (string, error)
+
+	// KeyVersion returns the master key version used for new values
+	KeyVersion() int
 }
 
 // CacheService defines the interface for caching and rate limiting
@@ -44,6 +107,92 @@ type CacheService interface {
 	RateLimit(ctx context.Context, key string, limit int, window int64) error
 }
 
+// RefreshJobStore keeps the state of asynchronous refresh jobs
+type RefreshJobStore interface {
+	SaveRefreshJob(ctx context.Context, job *domain.RefreshJob) error
+	// GetRefreshJob returns nil when the job does not exist or has expired
+	GetRefreshJob(ctx context.Context, id string) (*domain.RefreshJob, error)
+}
+
+// JobQueue is a durable at-least-once queue of background jobs
+type JobQueue interface {
+	// Enqueue adds a job, filling in its ID, enqueue time and attempt limit
+	Enqueue(ctx context.Context, job *domain.Job) error
+
+	// Dequeue waits up to wait for a job and reserves it for the visibility
+	// timeout, after which it is delivered again unless acknowledged. It
+	// returns nil when no job is available.
+	Dequeue(ctx context.Context, wait time.Duration) (*domain.Job, error)
+
+	// Extend pushes the visibility timeout of a reserved job back to a full
+	// timeout from now. It fails when the job is no longer reserved, e.g.
+	// because its timeout expired and it was delivered again.
+	Extend(ctx context.Context, jobID string) error
+
+	// Ack removes a processed job from the queue
+	Ack(ctx context.Context, job *domain.Job) error
+
+	// Nack schedules a failed job for retry with backoff, or moves it to the
+	// dead-letter list once it has used all its attempts
+	Nack(ctx context.Context, job *domain.Job, cause error) error
+}
+
+// CircuitBreaker stops calls to providers that keep failing or responding
+// slowly. Its state is shared by every process using the same store.
+type CircuitBreaker interface {
+	// Allow returns domain.ErrCircuitOpen when calls to providerID must fail fast
+	Allow(ctx context.Context, providerID string) error
+
+	// Record reports the latency of a call Allow let through and whether the
+	// provider failed it
+	Record(ctx context.Context, providerID string, latency time.Duration, failed bool) error
+}
+
+// ProviderRateLimiter keeps calls within the quota of each provider's API.
+// Quotas are shared by every process using the same store.
+type ProviderRateLimiter interface {
+	// Wait blocks until a call to provider fits its quota. It returns
+	// domain.ErrRateLimited right away when the wait would outlast ctx's
+	// deadline or the limiter's maximum wait.
+	Wait(ctx context.Context, provider *domain.Provider) error
+}
+
+// RequestRateLimiter counts requests over a sliding window. Counts are shared
+// by every process using the same store.
+type RequestRateLimiter interface {
+	// Allow counts a request under key unless limit requests were already
+	// counted within the last window
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (domain.RateLimitResult, error)
+}
+
+// ExchangeRateSource provides the exchange rates used to convert amounts
+type ExchangeRateSource interface {
+	// ExchangeRates returns the latest rates, or nil when none are known
+	ExchangeRates(ctx context.Context) (*domain.ExchangeRates, error)
+}
+
+// ExchangeRateStore is an ExchangeRateSource whose rates can be replaced
+type ExchangeRateStore interface {
+	ExchangeRateSource
+
+	// SaveExchangeRates replaces the stored rates with rates
+	SaveExchangeRates(ctx context.Context, rates *domain.ExchangeRates) error
+}
+
+// LockService provides leases shared between processes. A lease is held by
+// the caller that acquired it until it expires or is released.
+type LockService interface {
+	// AcquireLock takes the lease on key for ttl and returns its token, or
+	// an empty token when another holder has it
+	AcquireLock(ctx context.Context, key string, ttl time.Duration) (string, error)
+
+	// RefreshLock extends a held lease to ttl and reports whether token still holds it
+	RefreshLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+
+	// ReleaseLock gives up the lease if token still holds it
+	ReleaseLock(ctx context.Context, key, token string) error
+}
+
 // NotificationService handles system notifications
 type NotificationService interface {
 	NotifyAdmin(ctx context.Context, message string, severity string) error
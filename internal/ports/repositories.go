@@ -2,12 +2,17 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"github.com/mel-ak/onetap-challenge/internal/domain"
 )
 
 // Repository defines the interface for all repository operations
 type Repository interface {
+	// WithTx runs fn in a single transaction, committing when it returns nil
+	// and rolling back otherwise. Nested calls join the outer transaction.
+	WithTx(ctx context.Context, fn func(tx Repository) error) error
+
 	// User operations
 	CreateUser(ctx context.Context, user *domain.User) error
 	GetUserByID(ctx context.Context, id string) (*domain.User, error)
@@ -31,6 +36,18 @@ type Repository interface {
 	GetLinkedAccountsByProviderID(ctx context.Context, providerID string) ([]*domain.LinkedAccount, error)
 	UpdateLinkedAccount(ctx context.Context, account *domain.LinkedAccount) error
 	DeleteLinkedAccount(ctx context.Context, id string) error
+	// RecordSyncSuccess marks a linked account active and synced at at,
+	// clearing its failures, without touching credentials
+	RecordSyncSuccess(ctx context.Context, id string, at time.Time) error
+	// RecordSyncFailure sets the status of a linked account after a sync
+	// that failed at at and counts the consecutive failure
+	RecordSyncFailure(ctx context.Context, id string, at time.Time, status, cause string) error
+	// ListDueLinkedAccounts returns up to limit active or failing linked
+	// accounts whose next scheduled refresh is unset or not after now, oldest first, with the
+	// user's cadence override or else the provider's cadence
+	ListDueLinkedAccounts(ctx context.Context, now time.Time, limit int) ([]*domain.ScheduledAccount, error)
+	// ScheduleLinkedAccount sets the next scheduled refresh of a linked account
+	ScheduleLinkedAccount(ctx context.Context, id string, next time.Time) error
 
 	// Bill operations
 	CreateBill(ctx context.Context, bill *domain.Bill) error
@@ -40,6 +57,17 @@ type Repository interface {
 	GetBillSummaryByUserID(ctx context.Context, userID string) (*domain.BillSummary, error)
 	UpdateBill(ctx context.Context, bill *domain.Bill) error
 	DeleteBill(ctx context.Context, id string) error
+	// UpsertBills inserts new bills and updates changed ones, matching them by
+	// linked account and external ID, in a single transaction. Bill IDs are
+	// set to the stored row IDs.
+	UpsertBills(ctx context.Context, bills []*domain.Bill) (*domain.BillUpsertResult, error)
+	// MarkOverdueBills moves the bills still due whose due date is before now
+	// to overdue, recording each change, and returns how many moved
+	MarkOverdueBills(ctx context.Context, now time.Time) (int, error)
+	// MarkMissingBills flags the bills of a linked account due from from to
+	// to, inclusive, whose external IDs are not in seenExternalIDs and returns
+	// how many were newly flagged
+	MarkMissingBills(ctx context.Context, linkedAccountID string, seenExternalIDs []string, from, to time.Time) (int, error)
 }
 
 // AccountRepository defines the interface for account-related database operations
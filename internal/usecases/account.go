@@ -3,33 +3,53 @@ package usecases
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/providers"
 	"github.com/mel-ak/onetap-challenge/internal/domain"
 	"github.com/mel-ak/onetap-challenge/internal/ports"
 
 	"github.com/gorilla/mux"
 )
 
+// oauth2StateTTL bounds how long a user has to complete a provider authorization
+const oauth2StateTTL = 10 * time.Minute
+
+// errAlreadyLinked is returned when every discovered account is already linked
+var errAlreadyLinked = errors.New("account already linked")
+
 // AccountUsecase handles account-related business logic
 type AccountUsecase struct {
-	repo  ports.AccountRepository
-	cache ports.CacheService
+	repo             ports.AccountRepository
+	providers        ports.ProviderRegistry
+	cache            ports.CacheService
+	oauthRedirectURL string
+	httpClient       *http.Client
 }
 
-// NewAccountUsecase creates a new account use case
-func NewAccountUsecase(repo ports.AccountRepository, cache ports.CacheService) *AccountUsecase {
-	return &AccountUsecase{repo: repo, cache: cache}
+// NewAccountUsecase creates a new account use case. oauthRedirectURL is the
+// public URL of the OAuth2 callback endpoint registered with providers.
+func NewAccountUsecase(repo ports.AccountRepository, providers ports.ProviderRegistry, cache ports.CacheService, oauthRedirectURL string) *AccountUsecase {
+	return &AccountUsecase{
+		repo:             repo,
+		providers:        providers,
+		cache:            cache,
+		oauthRedirectURL: oauthRedirectURL,
+		httpClient:       &http.Client{Timeout: 10 * time.Second},
+	}
 }
 
 // LinkAccount handles POST /accounts/link
 func (u *AccountUsecase) LinkAccount(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		ProviderID  string `json:"provider_id"`
-		Credentials string `json:"credentials"`
+		ProviderID  string          `json:"provider_id"`
+		AccountID   string          `json:"account_id"`
+		Credentials json.RawMessage `json:"credentials"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -45,36 +65,282 @@ func (u *AccountUsecase) LinkAccount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Input validation
-	if req.ProviderID == "" || req.Credentials == "" {
+	credentials := parseRequestCredentials(req.Credentials)
+	if req.ProviderID == "" || len(credentials) == 0 {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
-	account := domain.LinkedAccount{
-		ID:          uuid.New().String(),
-		UserID:      userID,
-		ProviderID:  req.ProviderID,
-		AccountID:   req.Credentials,
-		Credentials: req.Credentials,
-		Status:      "active",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	adapter, err := u.providers.Get(r.Context(), req.ProviderID)
+	if err != nil {
+		log.Printf("Failed to resolve provider %s: %v", req.ProviderID, err)
+		http.Error(w, "Unknown provider", http.StatusBadRequest)
+		return
+	}
+	if adapter.GetProviderInfo().AuthType == "oauth2" {
+		http.Error(w, "This provider is linked through /accounts/link/{provider_id}/authorize", http.StatusBadRequest)
+		return
+	}
+
+	// Ask the provider which accounts the credentials give access to
+	accountNumbers := []string{req.AccountID}
+	if adapter.Capabilities().SupportsCredentialValidation {
+		accountNumbers, err = adapter.ValidateCredentials(r.Context(), credentials)
+		if err != nil {
+			writeValidationError(w, req.ProviderID, err)
+			return
+		}
+	} else if req.AccountID == "" {
+		http.Error(w, "account_id is required for this provider", http.StatusBadRequest)
+		return
+	}
+
+	// Only the requested account is linked; without one every account the
+	// credentials give access to is
+	if req.AccountID != "" {
+		if !slices.Contains(accountNumbers, req.AccountID) {
+			http.Error(w, "The credentials do not give access to this account", http.StatusUnprocessableEntity)
+			return
+		}
+		accountNumbers = []string{req.AccountID}
+	}
+
+	accounts, err := u.linkAccounts(r.Context(), userID, req.ProviderID, credentials, accountNumbers)
+	if err != nil {
+		writeLinkError(w, err)
+		return
+	}
+	writeLinkedAccounts(w, accounts)
+}
+
+// AuthorizeOAuth2 handles GET /accounts/link/{provider_id}/authorize by
+// redirecting the user to the provider authorize URL with PKCE and state
+func (u *AccountUsecase) AuthorizeOAuth2(w http.ResponseWriter, r *http.Request) {
+	providerID := mux.Vars(r)["provider_id"]
+
+	// Get user ID from context (set by auth middleware)
+	userID := r.Context().Value("user_id").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
 	}
 
-	accountID, err := u.repo.SaveAccount(context.Background(), account)
+	adapter, err := u.providers.Get(r.Context(), providerID)
 	if err != nil {
-		log.Printf("Failed to link account: %v", err)
-		http.Error(w, "Failed to link account", http.StatusInternalServerError)
+		log.Printf("Failed to resolve provider %s: %v", providerID, err)
+		http.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+	provider := adapter.GetProviderInfo()
+	if provider.AuthType != "oauth2" {
+		http.Error(w, "Provider does not use OAuth2", http.StatusBadRequest)
 		return
 	}
 
+	verifier, challenge, err := providers.NewPKCE()
+	if err != nil {
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+
+	state := uuid.New().String()
+	pending, err := json.Marshal(oauth2State{
+		UserID:       userID,
+		ProviderID:   providerID,
+		CodeVerifier: verifier,
+	})
+	if err != nil {
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+	if err := u.cache.Set(r.Context(), oauth2StateKey(state), string(pending), oauth2StateTTL); err != nil {
+		log.Printf("Failed to store OAuth2 state: %v", err)
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := providers.AuthCodeURL(provider.AuthConfig, u.oauthRedirectURL, state, challenge)
+	if err != nil {
+		log.Printf("Failed to build authorize URL for provider %s: %v", providerID, err)
+		http.Error(w, "Provider is misconfigured", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OAuth2Callback handles GET /accounts/link/callback. It exchanges the
+// authorization code for tokens and links the accounts they give access to.
+func (u *AccountUsecase) OAuth2Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		http.Error(w, "Authorization denied: "+reason, http.StatusBadRequest)
+		return
+	}
+
+	state, code := query.Get("state"), query.Get("code")
+	if state == "" || code == "" {
+		http.Error(w, "Missing state or code", http.StatusBadRequest)
+		return
+	}
+
+	// State is single use
+	data, err := u.cache.Get(r.Context(), oauth2StateKey(state))
+	if err != nil {
+		http.Error(w, "Invalid or expired state", http.StatusBadRequest)
+		return
+	}
+	u.cache.Delete(r.Context(), oauth2StateKey(state))
+
+	var pending oauth2State
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		http.Error(w, "Invalid or expired state", http.StatusBadRequest)
+		return
+	}
+
+	adapter, err := u.providers.Get(r.Context(), pending.ProviderID)
+	if err != nil {
+		log.Printf("Failed to resolve provider %s: %v", pending.ProviderID, err)
+		http.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+
+	credentials, err := providers.ExchangeCode(r.Context(), u.httpClient, adapter.GetProviderInfo().AuthConfig, code, pending.CodeVerifier, u.oauthRedirectURL)
+	if err != nil {
+		writeValidationError(w, pending.ProviderID, err)
+		return
+	}
+
+	accountNumbers, err := adapter.ValidateCredentials(r.Context(), credentials)
+	if err != nil {
+		writeValidationError(w, pending.ProviderID, err)
+		return
+	}
+
+	accounts, err := u.linkAccounts(r.Context(), pending.UserID, pending.ProviderID, credentials, accountNumbers)
+	if err != nil {
+		writeLinkError(w, err)
+		return
+	}
+	writeLinkedAccounts(w, accounts)
+}
+
+// oauth2State is the pending authorization stored between authorize and callback
+type oauth2State struct {
+	UserID       string `json:"user_id"`
+	ProviderID   string `json:"provider_id"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+func oauth2StateKey(state string) string {
+	return "oauth2_state:" + state
+}
+
+// linkAccounts stores a linked account for every provider account number the
+// user has not linked yet, all of them or none
+func (u *AccountUsecase) linkAccounts(ctx context.Context, userID, providerID string, credentials domain.Credentials, accountNumbers []string) ([]domain.LinkedAccount, error) {
+	encoded, err := credentials.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := u.repo.GetAccountsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	linked := make(map[string]bool, len(existing))
+	for _, acc := range existing {
+		if acc.ProviderID == providerID {
+			linked[acc.AccountID] = true
+		}
+	}
+
+	var accounts []domain.LinkedAccount
+	for _, accountNumber := range accountNumbers {
+		if linked[accountNumber] {
+			continue
+		}
+
+		account := domain.LinkedAccount{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			ProviderID:  providerID,
+			AccountID:   accountNumber,
+			Credentials: encoded,
+			Status:      "active",
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+		accounts = append(accounts, account)
+	}
+
+	if len(accounts) == 0 {
+		return nil, errAlreadyLinked
+	}
+	if err := u.repo.SaveAccounts(ctx, accounts); err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		accounts[i].Credentials = "" // Don't expose credentials
+	}
+	return accounts, nil
+}
+
+// writeValidationError reports a failed credential check with the provider
+func writeValidationError(w http.ResponseWriter, providerID string, err error) {
+	if errors.Is(err, domain.ErrInvalidCredentials) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":  "invalid_credentials",
+			"reason": "The provider rejected the supplied credentials",
+		})
+		return
+	}
+
+	log.Printf("Failed to validate credentials with provider %s: %v", providerID, err)
+	http.Error(w, "Provider unavailable, please try again later", http.StatusBadGateway)
+}
+
+// writeLinkError reports a failure to store linked accounts
+func writeLinkError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errAlreadyLinked) {
+		http.Error(w, "Account already linked", http.StatusConflict)
+		return
+	}
+
+	log.Printf("Failed to link account: %v", err)
+	http.Error(w, "Failed to link account", http.StatusInternalServerError)
+}
+
+// writeLinkedAccounts writes the response for newly linked accounts
+func writeLinkedAccounts(w http.ResponseWriter, accounts []domain.LinkedAccount) {
 	resp := map[string]interface{}{
-		"account_id": accountID,
+		"account_id": accounts[0].ID,
+		"accounts":   accounts,
 		"message":    "Account linked successfully",
 	}
 	json.NewEncoder(w).Encode(resp)
 }
 
+// parseRequestCredentials accepts credentials posted either as a JSON object
+// or as a plain string
+func parseRequestCredentials(raw json.RawMessage) domain.Credentials {
+	var token string
+	if err := json.Unmarshal(raw, &token); err == nil {
+		if token == "" {
+			return nil
+		}
+		return domain.Credentials{"token": token}
+	}
+
+	var credentials domain.Credentials
+	if err := json.Unmarshal(raw, &credentials); err != nil {
+		return nil
+	}
+	return credentials
+}
+
 // DeleteAccount handles DELETE /accounts/{account_id}
 func (u *AccountUsecase) DeleteAccount(w http.ResponseWriter, r *http.Request) {
 	accountIDStr := mux.Vars(r)["account_id"]
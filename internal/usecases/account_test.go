@@ -0,0 +1,118 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mel-ak/onetap-challenge/internal/adapters/providers"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubAccountRepository struct {
+	accounts []domain.LinkedAccount
+	saveErr  error
+}
+
+func (s *stubAccountRepository) SaveAccounts(ctx context.Context, accounts []domain.LinkedAccount) error {
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.accounts = append(s.accounts, accounts...)
+	return nil
+}
+
+func (s *stubAccountRepository) GetAccountsByUserID(ctx context.Context, userID string) ([]domain.LinkedAccount, error) {
+	return s.accounts, nil
+}
+
+func (s *stubAccountRepository) DeleteAccount(ctx context.Context, accountID string) (bool, error) {
+	return false, nil
+}
+
+func newLinkRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/accounts/link", strings.NewReader(body))
+	return req.WithContext(context.WithValue(req.Context(), "user_id", "user1"))
+}
+
+func TestLinkAccountValidatesCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Credentials map[string]string `json:"credentials"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Credentials["password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"accounts": {"ACC-1", "ACC-2"}})
+	}))
+	defer srv.Close()
+
+	mockRepo := new(MockRepository)
+	registry := providers.NewRegistry(mockRepo, nil)
+	assert.NoError(t, registry.Register(&domain.Provider{ID: "p1", APIEndpoint: srv.URL, AuthType: "basic"}))
+
+	repo := &stubAccountRepository{}
+	usecase := NewAccountUsecase(repo, registry, nil, "")
+
+	// Rejected credentials are not stored
+	rec := httptest.NewRecorder()
+	usecase.LinkAccount(rec, newLinkRequest(`{"provider_id":"p1","credentials":{"username":"jane","password":"wrong"}}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Empty(t, repo.accounts)
+
+	// Valid credentials link every discovered provider account
+	rec = httptest.NewRecorder()
+	usecase.LinkAccount(rec, newLinkRequest(`{"provider_id":"p1","credentials":{"username":"jane","password":"secret"}}`))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.Len(t, repo.accounts, 2) {
+		assert.Equal(t, "ACC-1", repo.accounts[0].AccountID)
+		assert.Equal(t, "ACC-2", repo.accounts[1].AccountID)
+		assert.Equal(t, "active", repo.accounts[0].Status)
+	}
+
+	// Linking the same credentials again is a conflict
+	rec = httptest.NewRecorder()
+	usecase.LinkAccount(rec, newLinkRequest(`{"provider_id":"p1","credentials":{"username":"jane","password":"secret"}}`))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestLinkAccountLinksOnlyTheRequestedAccount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]string{"accounts": {"ACC-1", "ACC-2"}})
+	}))
+	defer srv.Close()
+
+	registry := providers.NewRegistry(new(MockRepository), nil)
+	assert.NoError(t, registry.Register(&domain.Provider{ID: "p1", APIEndpoint: srv.URL, AuthType: "basic"}))
+
+	repo := &stubAccountRepository{}
+	usecase := NewAccountUsecase(repo, registry, nil, "")
+
+	// An account the credentials do not give access to is not linked
+	rec := httptest.NewRecorder()
+	usecase.LinkAccount(rec, newLinkRequest(`{"provider_id":"p1","account_id":"ACC-3","credentials":{"username":"jane","password":"secret"}}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Empty(t, repo.accounts)
+
+	// Nothing is linked when saving fails
+	repo.saveErr = errors.New("connection reset")
+	rec = httptest.NewRecorder()
+	usecase.LinkAccount(rec, newLinkRequest(`{"provider_id":"p1","credentials":{"username":"jane","password":"secret"}}`))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, repo.accounts)
+
+	repo.saveErr = nil
+	rec = httptest.NewRecorder()
+	usecase.LinkAccount(rec, newLinkRequest(`{"provider_id":"p1","account_id":"ACC-2","credentials":{"username":"jane","password":"secret"}}`))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.Len(t, repo.accounts, 1) {
+		assert.Equal(t, "ACC-2", repo.accounts[0].AccountID)
+	}
+}
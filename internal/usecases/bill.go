@@ -3,7 +3,9 @@ package usecases
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"sync"
 	"time"
@@ -13,106 +15,508 @@ import (
 	"github.com/mel-ak/onetap-challenge/internal/ports"
 )
 
+// syncStaleAfter is how long after its last successful sync an account's
+// bills are reported stale
+const syncStaleAfter = 48 * time.Hour
+
 // BillUsecase handles bill-related business logic
 type BillUsecase struct {
-	repo     ports.AccountRepository
-	provider ports.ProviderAPIService
-	cache    ports.CacheService
+	repo      ports.AccountRepository
+	bills     ports.BillRepository
+	store     ports.Repository
+	providers ports.ProviderRegistry
+	cache     ports.CacheService
+	retry     RetryPolicy
+	fetches   *fetchCoalescer
+	refresh   *BillRefreshUsecase
+	users     ports.UserRepository
+	rates     ports.ExchangeRateSource
 }
 
-// NewBillUsecase creates a new bill use case
-func NewBillUsecase(repo ports.AccountRepository, provider ports.ProviderAPIService, cache ports.CacheService) *BillUsecase {
-	return &BillUsecase{repo: repo, provider: provider, cache: cache}
+// NewBillUsecase creates a new bill use case. Provider fetches are retried
+// according to retry and coalesced per account across processes through
+// locks; fetched bills and the outcome of each fetch are saved in store.
+// When a provider cannot be reached the bills cached in cache or stored in
+// bills are served.
+func NewBillUsecase(repo ports.AccountRepository, bills ports.BillRepository, store ports.Repository, providers ports.ProviderRegistry, cache ports.CacheService, locks ports.LockService, retry RetryPolicy) *BillUsecase {
+	return &BillUsecase{
+		repo:      repo,
+		bills:     bills,
+		store:     store,
+		providers: providers,
+		cache:     cache,
+		retry:     retry,
+		fetches:   newFetchCoalescer(locks, cache),
+	}
 }
 
-// FetchBills handles GET /bills
+// FetchBills handles GET /bills and GET /bills/search. The user's accounts
+// are loaded from their providers, falling back to cached or stored bills,
+// and a page of the stored bills matching the search parameters is served
+// along with the sync status of every account and the amount still due.
+// Every call is paginated, with or without parameters.
 func (u *BillUsecase) FetchBills(w http.ResponseWriter, r *http.Request) {
-	userIDStr := r.URL.Query().Get("user_id")
+	userIDStr := requestUserID(r)
+	q, err := parseBillQuery(r.URL.Query(), userIDStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Fetch accounts
-	accounts, err := u.repo.GetAccountsByUserID(context.Background(), userIDStr)
+	accounts, err := u.repo.GetAccountsByUserID(r.Context(), userIDStr)
 	if err != nil {
 		http.Error(w, "Failed to fetch accounts", http.StatusInternalServerError)
 		return
 	}
 
-	// Fetch bills concurrently
-	billsChan := make(chan []*domain.Bill, len(accounts))
-	var wg sync.WaitGroup
+	// Bills fetched live are stored before the search, so the page includes them
+	allBills, statuses := u.collectBills(r.Context(), accounts)
 
-	for _, acc := range accounts {
+	// Calculate total amount due per currency over every account, whatever
+	// the filters and page
+	totalDue := domain.MoneyTotals{}
+	for _, bill := range allBills {
+		if bill.Status.Due() {
+			totalDue.Add(bill.Amount)
+		}
+	}
+
+	page, err := u.bills.SearchBills(r.Context(), q)
+	if errors.Is(err, domain.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to search bills of user %s: %v", userIDStr, err)
+		http.Error(w, "Failed to search bills", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	for _, bill := range page.Bills {
+		bill.MarkOverdue(now)
+	}
+
+	resp := map[string]interface{}{
+		"bills":      page.Bills,
+		"total_due":  totalDue.List(),
+		"bill_count": len(page.Bills),
+		"accounts":   statuses,
+	}
+	if page.NextCursor != "" {
+		resp["next_cursor"] = page.NextCursor
+	}
+	if total := u.convertTotal(r.Context(), userIDStr, totalDue.List()); total != nil {
+		resp["total"] = total
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// collectBills loads the bills of accounts concurrently and reports where
+// each account's bills come from. Accounts served fallback bills are queued
+// for revalidation in the background.
+func (u *BillUsecase) collectBills(ctx context.Context, accounts []domain.LinkedAccount) ([]*domain.Bill, []domain.AccountSyncStatus) {
+	results := make([]accountBills, len(accounts))
+	var wg sync.WaitGroup
+	for i := range accounts {
 		wg.Add(1)
-		go func(acc domain.LinkedAccount) {
+		go func(i int) {
 			defer wg.Done()
-			bills, err := u.fetchBillsWithRetry(context.Background(), acc)
-			if err != nil {
-				return
-			}
-			billsChan <- bills
-		}(acc)
+			results[i] = u.loadAccountBills(ctx, &accounts[i])
+		}(i)
 	}
+	wg.Wait()
 
-	// Close channel when all goroutines are done
-	go func() {
-		wg.Wait()
-		close(billsChan)
-	}()
-
-	// Collect bills
+	// Bills fetched or cached since their due date passed are overdue even
+	// before the provider or the overdue sweep says so
+	now := time.Now()
 	var allBills []*domain.Bill
-	for bills := range billsChan {
-		allBills = append(allBills, bills...)
+	var stale []*domain.LinkedAccount
+	statuses := syncStatuses(accounts)
+	for i, result := range results {
+		for _, bill := range result.bills {
+			bill.MarkOverdue(now)
+		}
+		allBills = append(allBills, result.bills...)
+		reportAccount(&statuses[i], result)
+		if result.revalidate {
+			stale = append(stale, &accounts[i])
+		}
 	}
 
-	// Calculate total amount due
-	var totalDue float64
-	for _, bill := range allBills {
-		// if bill.Status == "unpaid" || bill.Status == "overdue" {
-		totalDue += bill.Amount
-		// }
+	if len(stale) > 0 {
+		go u.revalidate(context.WithoutCancel(ctx), stale)
 	}
+	return allBills, statuses
+}
 
-	resp := map[string]interface{}{
-		"bills":      allBills,
-		"total_due":  totalDue,
-		"bill_count": len(allBills),
+// Stale-while-revalidate settings of GET /bills
+const (
+	// billsFreshFor is how long after a successful sync cached bills are
+	// served without calling the provider
+	billsFreshFor = time.Hour
+	// billsCacheTTL is how long cached bills are kept to fall back on
+	billsCacheTTL = 24 * time.Hour
+	// revalidateEvery throttles background refreshes of an account whose
+	// fallback bills were served
+	revalidateEvery = 5 * time.Minute
+)
+
+// accountBills are the bills loaded for one account
+type accountBills struct {
+	bills  []*domain.Bill
+	source string // One of the domain.BillSource values, "" when none could be loaded
+	err    error  // Why the bills could not be fetched from the provider
+	// revalidate is set when fallback bills were served and a refresh may
+	// bring them up to date
+	revalidate bool
+}
+
+// reportAccount fills the status of an account in a bill response from the
+// bills loaded for it
+func reportAccount(status *domain.AccountSyncStatus, loaded accountBills) {
+	if loaded.source != "" {
+		status.Source = loaded.source
+		status.AsOf = status.Sync.LastSuccessAt
+	}
+	if loaded.err == nil {
+		status.Status = domain.AccountBillsOK
+		return
+	}
+
+	status.ErrorCode = errorCode(loaded.err)
+	status.Error = loaded.err.Error()
+	switch {
+	case loaded.source == "":
+		status.Status = domain.AccountBillsFailed
+	case status.ErrorCode == domain.AccountErrorRateLimited:
+		status.Status = domain.AccountBillsRateLimited
+	default:
+		status.Status = domain.AccountBillsStale
 	}
-	json.NewEncoder(w).Encode(resp)
 }
 
-func (u *BillUsecase) fetchBillsWithRetry(ctx context.Context, acc domain.LinkedAccount) ([]*domain.Bill, error) {
-	key := fmt.Sprintf("rate_limit:%s:%s", acc.ProviderID, acc.ID)
-	cacheKey := fmt.Sprintf("bills:%s", acc.ID)
+// errorCode classifies why the bills of an account could not be fetched
+func errorCode(err error) string {
+	var providerErr *domain.ProviderError
+	isProviderErr := errors.As(err, &providerErr)
+	switch {
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		return domain.AccountErrorInvalidCredentials
+	case errors.Is(err, domain.ErrRateLimited),
+		isProviderErr && providerErr.StatusCode == http.StatusTooManyRequests:
+		return domain.AccountErrorRateLimited
+	case errors.Is(err, domain.ErrCircuitOpen):
+		return domain.AccountErrorCircuitOpen
+	case domain.Retryable(err):
+		return domain.AccountErrorProviderUnavailable
+	case isProviderErr:
+		return domain.AccountErrorProviderRejected
+	}
+	return domain.AccountErrorInternal
+}
 
-	// Rate limiting
-	if err := u.cache.RateLimit(ctx, key, 5, int64(time.Minute.Seconds())); err != nil {
-		return nil, err
+// UseRevalidation makes GET /bills queue a refresh through refresh whenever
+// it serves fallback bills because the provider could not be reached
+func (u *BillUsecase) UseRevalidation(refresh *BillRefreshUsecase) {
+	u.refresh = refresh
+}
+
+// UseExchangeRates makes bill responses convert the total due to the
+// preferred currency of the user, read from users, with rates
+func (u *BillUsecase) UseExchangeRates(users ports.UserRepository, rates ports.ExchangeRateSource) {
+	u.users = users
+	u.rates = rates
+}
+
+// convertTotal converts the per currency totalDue of userID to the user's
+// currency. It returns nil when no rates are in use, and logs why when some
+// amount cannot be converted.
+func (u *BillUsecase) convertTotal(ctx context.Context, userID string, totalDue []domain.Money) *domain.ConvertedTotal {
+	if u.rates == nil {
+		return nil
+	}
+
+	rates, err := u.rates.ExchangeRates(ctx)
+	if err != nil {
+		log.Printf("Serving bills without converted total: %v", err)
+		return nil
+	}
+	if rates == nil {
+		return nil
 	}
 
-	// Check cache
-	if bills, err := u.cache.GetBills(ctx, cacheKey); err == nil && len(bills) > 0 {
-		return bills, nil
+	currency := domain.DefaultCurrency
+	user, err := u.users.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Serving bills without converted total: failed to load user %s: %v", userID, err)
+		return nil
+	}
+	if user != nil {
+		currency = user.Currency()
 	}
 
-	// Fetch from provider with retries
-	var bills []*domain.Bill
-	var err error
-	for i := 0; i < 3; i++ {
-		bills, err = u.provider.FetchBills(ctx, acc)
-		if err == nil {
-			break
+	total, err := rates.Total(totalDue, currency)
+	if err != nil {
+		log.Printf("Serving bills without converted total for user %s: %v", userID, err)
+		return nil
+	}
+	return total
+}
+
+// revalidate queues a background refresh of accounts, skipping accounts
+// revalidated recently so repeated requests do not pile up jobs
+func (u *BillUsecase) revalidate(ctx context.Context, accounts []*domain.LinkedAccount) {
+	if u.refresh == nil {
+		return
+	}
+
+	var due []*domain.LinkedAccount
+	for _, account := range accounts {
+		if err := u.cache.RateLimit(ctx, "revalidate:"+account.ID, 1, int64(revalidateEvery.Seconds())); err == nil {
+			due = append(due, account)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	if _, err := u.refresh.QueueRefresh(ctx, due[0].UserID, domain.RefreshTriggerRevalidate, due); err != nil {
+		log.Printf("Failed to queue revalidation for user %s: %v", due[0].UserID, err)
+	}
+}
+
+// syncStatuses reports the sync state of accounts for bill responses
+func syncStatuses(accounts []domain.LinkedAccount) []domain.AccountSyncStatus {
+	now := time.Now()
+	statuses := make([]domain.AccountSyncStatus, len(accounts))
+	for i, account := range accounts {
+		statuses[i] = domain.AccountSyncStatus{
+			LinkedAccountID: account.ID,
+			ProviderID:      account.ProviderID,
+			Sync:            account.Sync,
+			Stale:           account.Sync.Stale(now, syncStaleAfter),
 		}
-		time.Sleep(time.Second * time.Duration(1<<i))
 	}
+	return statuses
+}
+
+// recordSync stores the outcome of syncing the bills of account and mirrors
+// it on account. Storing it is best effort since the caller already has the
+// fetch result to act on. Fetches rejected by an open circuit breaker or a
+// rate limit, or cancelled by the caller, say nothing about the account and
+// are not recorded.
+func recordSync(ctx context.Context, syncs ports.SyncStateRepository, account *domain.LinkedAccount, syncErr error) {
+	now := time.Now()
+	if !applySync(account, now, syncErr) {
+		return
+	}
+
+	var err error
+	if syncErr == nil {
+		err = syncs.RecordSyncSuccess(ctx, account.ID, now)
+	} else {
+		err = syncs.RecordSyncFailure(ctx, account.ID, now, account.Status, syncErr.Error())
+	}
+	if err != nil {
+		log.Printf("Failed to record sync state of account %s: %v", account.ID, err)
+	}
+}
+
+// applySync mirrors the outcome of a sync at at on account without storing
+// it. It reports false for outcomes that are not recorded.
+func applySync(account *domain.LinkedAccount, at time.Time, syncErr error) bool {
+	if errors.Is(syncErr, domain.ErrCircuitOpen) || errors.Is(syncErr, domain.ErrRateLimited) || errors.Is(syncErr, context.Canceled) {
+		return false
+	}
+	if syncErr == nil {
+		account.Status = "active"
+		account.Sync.RecordSuccess(at)
+	} else {
+		account.Status = syncFailureStatus(syncErr)
+		account.Sync.RecordFailure(at, syncErr.Error())
+	}
+	return true
+}
+
+// syncFailureStatus returns the status of an account whose sync failed with
+// err. Accounts whose credentials the provider rejected need to be linked
+// again and are no longer refreshed.
+func syncFailureStatus(err error) string {
+	if errors.Is(err, domain.ErrInvalidCredentials) {
+		return "invalid_credentials"
+	}
+	return "error"
+}
+
+// loadAccountBills serves recently cached bills or fetches them from the
+// provider. When the provider cannot be reached it falls back to the cached
+// bills, then to the bills stored by the last successful sync.
+func (u *BillUsecase) loadAccountBills(ctx context.Context, acc *domain.LinkedAccount) accountBills {
+	cacheKey := fmt.Sprintf("bills:%s", acc.ID)
+	cached, err := u.cache.GetBills(ctx, cacheKey)
+	if err != nil {
+		cached = nil
+	}
+	if len(cached) > 0 && !acc.Sync.Stale(time.Now(), billsFreshFor) {
+		return accountBills{bills: cached, source: domain.BillSourceCache}
+	}
+
+	// Concurrent requests for the account share one fetch. The fetch records
+	// the sync on a copy of the account, so the outcome is mirrored here.
+	fetched := *acc
+	bills, _, err := u.fetches.do(ctx, acc.ID, func(ctx context.Context) ([]*domain.Bill, error) {
+		return u.fetchBillsWithRetry(ctx, &fetched)
+	})
+	applySync(acc, time.Now(), err)
+	if err == nil {
+		u.cache.CacheBills(ctx, cacheKey, bills, int64(billsCacheTTL.Seconds()))
+		return accountBills{bills: bills, source: domain.BillSourceLive}
+	}
+	log.Printf("Serving fallback bills for account %s: %v", acc.ID, err)
+
+	// Refreshing cannot help until the account is linked again, and is
+	// rejected while the provider's circuit breaker is open
+	revalidate := !errors.Is(err, domain.ErrInvalidCredentials) && !errors.Is(err, domain.ErrCircuitOpen)
+	if len(cached) > 0 {
+		return accountBills{bills: cached, source: domain.BillSourceCache, err: err, revalidate: revalidate}
+	}
+	stored, storedErr := u.bills.GetBillsByLinkedAccountID(ctx, acc.ID)
+	if storedErr != nil {
+		log.Printf("Failed to load stored bills for account %s: %v", acc.ID, storedErr)
+		return accountBills{err: err, revalidate: revalidate}
+	}
+	if len(stored) == 0 && acc.Sync.LastSuccessAt == nil {
+		// The account never synced, so there is nothing to fall back on
+		return accountBills{err: err, revalidate: revalidate}
+	}
+	return accountBills{bills: stored, source: domain.BillSourceDatabase, err: err, revalidate: revalidate}
+}
+
+// fetchBillsWithRetry fetches the bills of acc from its provider, retrying
+// transient failures. Fetched bills are saved along with the sync, so the
+// last successful sync always dates the stored bills served as a fallback;
+// failures are recorded.
+func (u *BillUsecase) fetchBillsWithRetry(ctx context.Context, acc *domain.LinkedAccount) ([]*domain.Bill, error) {
+	var bills []*domain.Bill
+	_, err := u.retry.Do(ctx, func() error {
+		var err error
+		bills, err = fetchAccountBills(ctx, u.providers, *acc)
+		return err
+	})
 	if err != nil {
+		recordSync(ctx, u.store, acc, err)
 		return nil, err
 	}
 
-	// Cache and save bills
-	u.cache.CacheBills(ctx, cacheKey, bills, int64(time.Hour.Seconds()))
+	// Bills that could not be saved are still served, but the sync is not
+	// recorded so the stored bills keep the date of the sync that saved them
+	if _, err := saveAccountBills(ctx, u.store, acc, bills); err != nil {
+		log.Printf("Failed to save fetched bills of account %s: %v", acc.ID, err)
+	}
 	return bills, nil
 }
 
+// fetchAccountBills fetches the bills of a linked account through its provider adapter
+func fetchAccountBills(ctx context.Context, providers ports.ProviderRegistry, account domain.LinkedAccount) ([]*domain.Bill, error) {
+	adapter, err := providers.Get(ctx, account.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := providers.Credentials(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials for account %s: %w", account.ID, err)
+	}
+
+	return adapter.FetchBills(ctx, account, credentials)
+}
+
+// saveAccountBills stores the bills fetched for a linked account atomically:
+// new and changed bills are upserted, bills due within the dates the fetched
+// bills span that the provider no longer returns are marked missing and the
+// account is marked active and synced. An empty fetch marks nothing missing,
+// since it cannot be told apart from a provider answering with no history.
+func saveAccountBills(ctx context.Context, repo ports.Repository, account *domain.LinkedAccount, bills []*domain.Bill) (*domain.BillUpsertResult, error) {
+	var result *domain.BillUpsertResult
+	refreshedAt := time.Now()
+	err := repo.WithTx(ctx, func(tx ports.Repository) error {
+		var err error
+		if result, err = tx.UpsertBills(ctx, bills); err != nil {
+			return err
+		}
+
+		if len(bills) > 0 {
+			seen := make([]string, len(bills))
+			from, to := bills[0].DueDate, bills[0].DueDate
+			for i, bill := range bills {
+				seen[i] = bill.ExternalID
+				if bill.DueDate.Before(from) {
+					from = bill.DueDate
+				}
+				if bill.DueDate.After(to) {
+					to = bill.DueDate
+				}
+			}
+			if result.Missing, err = tx.MarkMissingBills(ctx, account.ID, seen, from, to); err != nil {
+				return err
+			}
+		}
+
+		return tx.RecordSyncSuccess(ctx, account.ID, refreshedAt)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save bills for account %s: %w", account.ID, err)
+	}
+
+	account.Status = "active"
+	account.Sync.RecordSuccess(refreshedAt)
+	return result, nil
+}
+
+// GetBill handles GET /bills/{bill_id}, returning a bill of one of the
+// user's linked accounts with its line items and usage. Bills of other users
+// are reported as not found.
+func (u *BillUsecase) GetBill(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	bill, err := u.bills.GetBillByID(r.Context(), mux.Vars(r)["bill_id"])
+	if err != nil {
+		http.Error(w, "Failed to fetch bill", http.StatusInternalServerError)
+		return
+	}
+	if bill == nil {
+		http.Error(w, "Bill not found", http.StatusNotFound)
+		return
+	}
+
+	accounts, err := u.repo.GetAccountsByUserID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+	owned := false
+	for _, account := range accounts {
+		if account.ID == bill.LinkedAccountID {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		http.Error(w, "Bill not found", http.StatusNotFound)
+		return
+	}
+
+	bill.MarkOverdue(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bill)
+}
+
 // FetchBillsByProvider handles GET /providers/{provider_id}/bills
 func (u *BillUsecase) FetchBillsByProvider(w http.ResponseWriter, r *http.Request) {
 	// Get provider ID from URL parameters
@@ -146,53 +550,33 @@ func (u *BillUsecase) FetchBillsByProvider(w http.ResponseWriter, r *http.Reques
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"bills":      []interface{}{},
-			"total_due":  0,
+			"total_due":  []domain.Money{},
 			"bill_count": 0,
 		})
 		return
 	}
 
 	// Fetch bills concurrently for all accounts of this provider
-	billsChan := make(chan []*domain.Bill, len(providerAccounts))
-	var wg sync.WaitGroup
-
-	for _, acc := range providerAccounts {
-		wg.Add(1)
-		go func(acc domain.LinkedAccount) {
-			defer wg.Done()
-			bills, err := u.fetchBillsWithRetry(r.Context(), acc)
-			if err != nil {
-				return
-			}
-			billsChan <- bills
-		}(acc)
-	}
-
-	// Close channel when all goroutines are done
-	go func() {
-		wg.Wait()
-		close(billsChan)
-	}()
+	allBills, statuses := u.collectBills(r.Context(), providerAccounts)
 
-	// Collect bills
-	var allBills []*domain.Bill
-	for bills := range billsChan {
-		allBills = append(allBills, bills...)
-	}
-
-	// Calculate total amount due
-	var totalDue float64
+	// Calculate total amount due per currency
+	totalDue := domain.MoneyTotals{}
 	for _, bill := range allBills {
-		if bill.Status == "unpaid" || bill.Status == "overdue" {
-			totalDue += bill.Amount
+		if bill.Status.Due() {
+			totalDue.Add(bill.Amount)
 		}
 	}
 
 	// Return response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	resp := map[string]interface{}{
 		"bills":      allBills,
-		"total_due":  totalDue,
+		"total_due":  totalDue.List(),
 		"bill_count": len(allBills),
-	})
+		"accounts":   statuses,
+	}
+	if total := u.convertTotal(r.Context(), userID, totalDue.List()); total != nil {
+		resp["total"] = total
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
@@ -0,0 +1,131 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+)
+
+// requestUserID returns the authenticated user, or the user_id query
+// parameter on servers without authentication
+func requestUserID(r *http.Request) string {
+	if userID, _ := r.Context().Value("user_id").(string); userID != "" {
+		return userID
+	}
+	return r.URL.Query().Get("user_id")
+}
+
+// parseBillQuery reads the parameters of GET /bills:
+//
+//	status       comma separated bill statuses
+//	provider_id  bills of one provider
+//	due_from     bills due on or after a date (2006-01-02) or RFC 3339 time
+//	due_to       bills due on or before a date, or before an RFC 3339 time
+//	currency     bills in one currency, which min_amount and max_amount are
+//	             in; they are in USD when it is not given
+//	min_amount   bills of at least a decimal amount
+//	max_amount   bills of at most a decimal amount
+//	sort         due_date, amount or bill_date, descending with a "-" prefix;
+//	             amount needs a currency since amounts of different
+//	             currencies do not compare
+//	limit        bills per page, up to domain.MaxBillPageSize
+//	cursor       the next_cursor of the previous page
+func parseBillQuery(query url.Values, userID string) (domain.BillQuery, error) {
+	q := domain.BillQuery{
+		UserID:     userID,
+		ProviderID: query.Get("provider_id"),
+		Sort:       query.Get("sort"),
+		Limit:      domain.DefaultBillPageSize,
+		Cursor:     query.Get("cursor"),
+	}
+
+	if value := query.Get("status"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			status, err := domain.ParseBillStatus(name)
+			if err != nil {
+				return q, err
+			}
+			q.Statuses = append(q.Statuses, status)
+		}
+	}
+
+	var err error
+	if q.DueFrom, err = parseDueBound(query.Get("due_from"), false); err != nil {
+		return q, err
+	}
+	if q.DueTo, err = parseDueBound(query.Get("due_to"), true); err != nil {
+		return q, err
+	}
+	if q.DueFrom != nil && q.DueTo != nil && !q.DueFrom.Before(*q.DueTo) {
+		return q, errors.New("due_from must be before due_to")
+	}
+
+	minAmount, maxAmount := query.Get("min_amount"), query.Get("max_amount")
+	if currency := query.Get("currency"); currency != "" || minAmount != "" || maxAmount != "" {
+		if q.Currency, err = domain.ParseCurrency(currency); err != nil {
+			return q, err
+		}
+	}
+	if q.MinAmount, err = parseAmountBound(minAmount, q.Currency); err != nil {
+		return q, err
+	}
+	if q.MaxAmount, err = parseAmountBound(maxAmount, q.Currency); err != nil {
+		return q, err
+	}
+	if q.MinAmount != nil && q.MaxAmount != nil && *q.MinAmount > *q.MaxAmount {
+		return q, errors.New("min_amount must not exceed max_amount")
+	}
+
+	if q.Sort != "" && !domain.ValidBillSort(q.Sort) {
+		return q, fmt.Errorf("invalid sort: %q", q.Sort)
+	}
+	if field, _ := q.SortOrder(); field == domain.BillSortAmount && q.Currency == "" {
+		return q, errors.New("sorting by amount requires currency")
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > domain.MaxBillPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", domain.MaxBillPageSize)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// parseDueBound reads a due date bound. A date given as the upper bound
+// includes the whole day.
+func parseDueBound(value string, upper bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if day, err := time.Parse("2006-01-02", value); err == nil {
+		if upper {
+			day = day.AddDate(0, 0, 1)
+		}
+		return &day, nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date: %q", value)
+	}
+	at = at.UTC()
+	return &at, nil
+}
+
+// parseAmountBound reads an amount bound in the minor units of currency
+func parseAmountBound(value, currency string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := domain.ParseMoney(value, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &amount.Minor, nil
+}
@@ -0,0 +1,130 @@
+package usecases
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBillQuery(t *testing.T) {
+	query, err := url.ParseQuery("status=unpaid,Overdue&provider_id=p1&due_from=2024-05-01&due_to=2024-05-31" +
+		"&min_amount=10&max_amount=99.99&sort=-amount&limit=20&cursor=abc")
+	assert.NoError(t, err)
+
+	q, err := parseBillQuery(query, "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "user1", q.UserID)
+	assert.Equal(t, []domain.BillStatus{domain.BillUnpaid, domain.BillOverdue}, q.Statuses)
+	assert.Equal(t, "p1", q.ProviderID)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), *q.DueFrom)
+	// A date as the upper bound includes the whole day
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), *q.DueTo)
+	// Amounts without a currency are in the default one
+	assert.Equal(t, "USD", q.Currency)
+	assert.Equal(t, int64(1000), *q.MinAmount)
+	assert.Equal(t, int64(9999), *q.MaxAmount)
+	assert.Equal(t, "-amount", q.Sort)
+	assert.Equal(t, 20, q.Limit)
+	assert.Equal(t, "abc", q.Cursor)
+
+	field, desc := q.SortOrder()
+	assert.Equal(t, domain.BillSortAmount, field)
+	assert.True(t, desc)
+
+	q, err = parseBillQuery(url.Values{"due_to": {"2024-05-31T12:00:00+02:00"}, "currency": {"jpy"}, "min_amount": {"500"}}, "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 31, 10, 0, 0, 0, time.UTC), *q.DueTo)
+	assert.Equal(t, "JPY", q.Currency)
+	assert.Equal(t, int64(500), *q.MinAmount)
+	assert.Equal(t, domain.DefaultBillPageSize, q.Limit)
+
+	invalid := []string{
+		"status=unknown",
+		"due_from=yesterday",
+		"due_from=2024-06-01&due_to=2024-05-01",
+		"currency=dollars",
+		"min_amount=ten",
+		"min_amount=1.234",
+		"min_amount=20&max_amount=10",
+		"sort=provider",
+		// Amounts of different currencies do not compare
+		"sort=-amount",
+		"limit=0",
+		"limit=1000",
+	}
+	for _, raw := range invalid {
+		query, err := url.ParseQuery(raw)
+		assert.NoError(t, err)
+		_, err = parseBillQuery(query, "user1")
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestFetchBillsPagesStoredBills(t *testing.T) {
+	stored := &stubBillRepository{bills: map[string][]*domain.Bill{
+		"acc1": {
+			{ID: "bill1", LinkedAccountID: "acc1", Amount: usd(1000), Status: domain.BillUnpaid},
+			{ID: "bill2", LinkedAccountID: "acc1", Amount: usd(2000), Status: domain.BillUnpaid},
+		},
+		"acc2": {{ID: "bill3", LinkedAccountID: "acc2", Amount: usd(3000), Status: domain.BillPaid}},
+	}}
+	usecase := NewBillUsecase(&stubAccountRepository{}, stored, nil, nil, newMemoryStore(), nil, testRetryPolicy)
+
+	type page struct {
+		Bills      []*domain.Bill             `json:"bills"`
+		BillCount  int                        `json:"bill_count"`
+		NextCursor string                     `json:"next_cursor"`
+		TotalDue   []domain.Money             `json:"total_due"`
+		Accounts   []domain.AccountSyncStatus `json:"accounts"`
+	}
+	list := func(path string) (*httptest.ResponseRecorder, page) {
+		rec := httptest.NewRecorder()
+		// The user_id parameter is ignored for authenticated users
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		usecase.FetchBills(rec, withUser(req, "user1"))
+		var resp page
+		if rec.Code == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		}
+		return rec, resp
+	}
+
+	rec, first := list("/bills?user_id=user2&limit=2")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, first.BillCount)
+	assert.Equal(t, "bill2", first.NextCursor)
+	assert.NotNil(t, first.TotalDue)
+	assert.NotNil(t, first.Accounts)
+	assert.Equal(t, "user1", stored.searches[0].UserID)
+
+	// GET /bills/search is the same listing
+	rec, second := list("/bills/search?limit=2&cursor=" + first.NextCursor)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, second.Bills, 1)
+	assert.Equal(t, "bill3", second.Bills[0].ID)
+	assert.Empty(t, second.NextCursor)
+
+	// Without parameters the first page is served
+	rec, all := list("/bills")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, all.Bills, 3)
+	assert.Equal(t, domain.DefaultBillPageSize, stored.searches[2].Limit)
+
+	// Filters reach the search
+	rec, _ = list("/bills?status=unpaid,overdue&provider_id=p1&sort=-amount&currency=usd")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []domain.BillStatus{domain.BillUnpaid, domain.BillOverdue}, stored.searches[3].Statuses)
+	assert.Equal(t, "p1", stored.searches[3].ProviderID)
+	assert.Equal(t, "USD", stored.searches[3].Currency)
+
+	// Invalid parameters are rejected before any provider is called
+	rec, _ = list("/bills?sort=nonsense")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Len(t, stored.searches, 4)
+}
@@ -1,36 +1,56 @@
 package usecases
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/mel-ak/onetap-challenge/internal/domain"
 	"github.com/mel-ak/onetap-challenge/internal/ports"
 )
 
 type BillRefreshUsecase struct {
-	repo         ports.Repository
-	providerSvc  ports.ProviderAPIService
-	cacheSvc     ports.CacheService
-	maxRetries   int
-	retryBackoff time.Duration
+	repo      ports.Repository
+	providers ports.ProviderRegistry
+	cacheSvc  ports.CacheService
+	jobs      ports.RefreshJobStore
+	queue     ports.JobQueue
+	retry     RetryPolicy
+	fetches   *fetchCoalescer
 }
 
-func NewBillRefreshUsecase(repo ports.Repository, providerSvc ports.ProviderAPIService, cacheSvc ports.CacheService) *BillRefreshUsecase {
+// NewBillRefreshUsecase creates the refresh use case. Refreshes are queued on
+// queue and run by ProcessJob in a worker process, retrying provider fetches
+// according to retry. Overlapping refreshes of an account share one fetch,
+// across processes when locks is set.
+func NewBillRefreshUsecase(repo ports.Repository, providers ports.ProviderRegistry, cacheSvc ports.CacheService, jobs ports.RefreshJobStore, queue ports.JobQueue, locks ports.LockService, retry RetryPolicy) *BillRefreshUsecase {
 	return &BillRefreshUsecase{
-		repo:         repo,
-		providerSvc:  providerSvc,
-		cacheSvc:     cacheSvc,
-		maxRetries:   3,
-		retryBackoff: time.Second * 2,
+		repo:      repo,
+		providers: providers,
+		cacheSvc:  cacheSvc,
+		jobs:      jobs,
+		queue:     queue,
+		retry:     retry,
+		fetches:   newFetchCoalescer(locks, cacheSvc),
 	}
 }
 
+// refreshJobPayload is the queue payload of a bill refresh job
+type refreshJobPayload struct {
+	RefreshJobID string `json:"refresh_job_id"`
+}
+
+// RefreshBills handles POST /bills/refresh by queueing a refresh of every
+// linked account of the user and responding with the job ID
 func (u *BillRefreshUsecase) RefreshBills(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok || userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -42,50 +62,235 @@ func (u *BillRefreshUsecase) RefreshBills(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Process each account
-	for _, account := range accounts {
-		// Try to get bills from cache first
-		cacheKey := "bills:" + account.ID
-		if cachedBills, err := u.cacheSvc.Get(r.Context(), cacheKey); err == nil {
-			var bills []*domain.Bill
-			if err := json.Unmarshal([]byte(cachedBills), &bills); err == nil {
-				continue // Skip if we have valid cached data
-			}
-		}
+	job, err := u.QueueRefresh(r.Context(), userID, domain.RefreshTriggerManual, accounts)
+	if job == nil {
+		log.Printf("Failed to save refresh job: %v", err)
+		http.Error(w, "Failed to create refresh job", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to queue refresh job %s: %v", job.ID, err)
+		http.Error(w, "Failed to queue refresh", http.StatusServiceUnavailable)
+		return
+	}
 
-		// Fetch bills from provider with retry logic
-		var bills []*domain.Bill
-		var fetchErr error
-		for i := 0; i < u.maxRetries; i++ {
-			bills, fetchErr = u.providerSvc.FetchBills(r.Context(), *account)
-			if fetchErr == nil {
-				break
-			}
-			time.Sleep(u.retryBackoff * time.Duration(i+1))
+	statusURL := "/bills/refresh/" + job.ID
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", statusURL)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"status_url": statusURL,
+	})
+}
+
+// GetRefreshJob handles GET /bills/refresh/{job_id}
+func (u *BillRefreshUsecase) GetRefreshJob(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok || userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	job, err := u.jobs.GetRefreshJob(r.Context(), mux.Vars(r)["job_id"])
+	if err != nil {
+		log.Printf("Failed to load refresh job: %v", err)
+		http.Error(w, "Failed to load refresh job", http.StatusInternalServerError)
+		return
+	}
+	if job == nil || job.UserID != userID {
+		http.Error(w, "Refresh job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// QueueRefresh creates a refresh job for accounts of a user and queues it. When
+// the job was saved but could not be queued it is marked failed and returned
+// along with the error.
+func (u *BillRefreshUsecase) QueueRefresh(ctx context.Context, userID, trigger string, accounts []*domain.LinkedAccount) (*domain.RefreshJob, error) {
+	now := time.Now()
+	job := &domain.RefreshJob{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Trigger:   trigger,
+		Status:    domain.RefreshJobQueued,
+		Accounts:  make([]domain.AccountRefresh, len(accounts)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for i, account := range accounts {
+		job.Accounts[i] = domain.AccountRefresh{
+			LinkedAccountID: account.ID,
+			ProviderID:      account.ProviderID,
+			Status:          domain.AccountRefreshPending,
 		}
+	}
+
+	if err := u.jobs.SaveRefreshJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	if err := u.enqueue(ctx, job.ID); err != nil {
+		job.Status = domain.RefreshJobFailed
+		job.Error = "failed to queue refresh"
+		u.saveJob(ctx, job)
+		return job, err
+	}
+	return job, nil
+}
+
+// enqueue queues the refresh job with the given ID
+func (u *BillRefreshUsecase) enqueue(ctx context.Context, refreshJobID string) error {
+	payload, err := json.Marshal(refreshJobPayload{RefreshJobID: refreshJobID})
+	if err != nil {
+		return err
+	}
+	return u.queue.Enqueue(ctx, &domain.Job{Type: domain.JobTypeBillRefresh, Payload: payload})
+}
+
+// ProcessJob is the JobHandler of bill refresh jobs. It refreshes the accounts
+// of the job one by one, saving progress after each. Accounts finished by an
+// earlier delivery of the same job are not refreshed again.
+func (u *BillRefreshUsecase) ProcessJob(ctx context.Context, payload json.RawMessage) error {
+	var p refreshJobPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("invalid refresh job payload: %w", err)
+	}
 
-		if fetchErr != nil {
-			// Log error but continue with other accounts
+	job, err := u.jobs.GetRefreshJob(ctx, p.RefreshJobID)
+	if err != nil {
+		return fmt.Errorf("failed to load refresh job %s: %w", p.RefreshJobID, err)
+	}
+	if job == nil {
+		log.Printf("Refresh job %s expired before it was processed", p.RefreshJobID)
+		return nil
+	}
+
+	job.Status = domain.RefreshJobRunning
+	u.saveJob(ctx, job)
+
+	for i := range job.Accounts {
+		progress := &job.Accounts[i]
+		if progress.Status != domain.AccountRefreshPending {
 			continue
 		}
+		u.refreshAccount(ctx, job.Trigger, progress)
+		u.saveJob(ctx, job)
+	}
 
-		// Save bills to database
-		for _, bill := range bills {
-			// Generate unique ID for the bill if not already set
-			if bill.ID == "" {
-				bill.ID = uuid.New().String()
-			}
-			if err := u.repo.CreateBill(r.Context(), bill); err != nil {
-				continue
-			}
+	failed := 0
+	job.Totals = domain.BillUpsertResult{}
+	for _, progress := range job.Accounts {
+		if progress.Status == domain.AccountRefreshFailed {
+			failed++
 		}
+		job.Totals.Inserted += progress.Bills.Inserted
+		job.Totals.Updated += progress.Bills.Updated
+		job.Totals.Unchanged += progress.Bills.Unchanged
+		job.Totals.Missing += progress.Bills.Missing
+	}
+
+	switch {
+	case failed == 0:
+		job.Status = domain.RefreshJobCompleted
+	case failed == len(job.Accounts):
+		job.Status = domain.RefreshJobFailed
+	default:
+		job.Status = domain.RefreshJobPartial
+	}
+	completedAt := time.Now()
+	job.CompletedAt = &completedAt
+	if err := u.jobs.SaveRefreshJob(ctx, job); err != nil {
+		return fmt.Errorf("failed to save refresh job %s: %w", job.ID, err)
+	}
+	return nil
+}
 
-		// Cache the bills
-		if billData, err := json.Marshal(bills); err == nil {
-			u.cacheSvc.Set(r.Context(), cacheKey, string(billData), time.Hour*24)
+// refreshAccount fetches and stores the bills of one account, recording the
+// outcome in progress
+func (u *BillRefreshUsecase) refreshAccount(ctx context.Context, trigger string, progress *domain.AccountRefresh) {
+	fail := func(err error) {
+		progress.Status = domain.AccountRefreshFailed
+		progress.Error = err.Error()
+		log.Printf("Failed to refresh account %s: %v", progress.LinkedAccountID, err)
+	}
+
+	account, err := u.repo.GetLinkedAccountByID(ctx, progress.LinkedAccountID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if account == nil {
+		fail(errors.New("account is no longer linked"))
+		return
+	}
+
+	// Manual refreshes skip accounts whose bills are cached from a recent
+	// sync. Scheduled refreshes run once per cadence and revalidations
+	// replace cached bills, so both always fetch.
+	cacheKey := "bills:" + account.ID
+	recent := trigger == domain.RefreshTriggerManual && !account.Sync.Stale(time.Now(), billsFreshFor)
+	if cachedBills, err := u.cacheSvc.Get(ctx, cacheKey); err == nil && recent {
+		var bills []*domain.Bill
+		if err := json.Unmarshal([]byte(cachedBills), &bills); err == nil {
+			progress.Status = domain.AccountRefreshSkipped
+			return
 		}
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Bill refresh completed"})
+	// Fetch bills from provider, retrying transient failures. Rejected
+	// credentials and an open circuit breaker fail at once, keeping the
+	// stored bills. Overlapping refreshes of the account share the fetch,
+	// which records failures on a copy of the account.
+	fetched := *account
+	attempts := 0
+	bills, shared, err := u.fetches.do(ctx, account.ID, func(ctx context.Context) ([]*domain.Bill, error) {
+		var bills []*domain.Bill
+		var err error
+		attempts, err = u.retry.Do(ctx, func() error {
+			bills, err = fetchAccountBills(ctx, u.providers, fetched)
+			return err
+		})
+		if err != nil {
+			recordSync(ctx, u.repo, &fetched, err)
+		}
+		return bills, err
+	})
+	if !shared && ctx.Err() == nil {
+		// The fetch finished rather than being abandoned, so its attempts are final
+		progress.Attempts = attempts
+	}
+	if err != nil {
+		applySync(account, time.Now(), err)
+		fail(err)
+		return
+	}
+
+	// Save bills to database, matching them by provider bill ID
+	saved, err := saveAccountBills(ctx, u.repo, account, bills)
+	if err != nil {
+		recordSync(ctx, u.repo, account, err)
+		fail(err)
+		return
+	}
+	progress.Status = domain.AccountRefreshSucceeded
+	progress.Error = ""
+	progress.Bills = *saved
+
+	// Cache the bills
+	if billData, err := json.Marshal(bills); err == nil {
+		u.cacheSvc.Set(ctx, cacheKey, string(billData), billsCacheTTL)
+	}
+}
+
+// saveJob stores job progress, logging failures since workers cannot report them
+func (u *BillRefreshUsecase) saveJob(ctx context.Context, job *domain.RefreshJob) {
+	job.UpdatedAt = time.Now()
+	if err := u.jobs.SaveRefreshJob(ctx, job); err != nil {
+		log.Printf("Failed to save refresh job %s: %v", job.ID, err)
+	}
 }
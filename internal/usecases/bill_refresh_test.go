@@ -0,0 +1,298 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// memoryStore is an in-memory CacheService and RefreshJobStore
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string]string
+	jobs   map[string]domain.RefreshJob
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{values: make(map[string]string), jobs: make(map[string]domain.RefreshJob)}
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return value, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+func (s *memoryStore) GetBills(ctx context.Context, key string) ([]*domain.Bill, error) {
+	value, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var bills []*domain.Bill
+	return bills, json.Unmarshal([]byte(value), &bills)
+}
+
+func (s *memoryStore) CacheBills(ctx context.Context, key string, bills []*domain.Bill, ttl int64) error {
+	data, err := json.Marshal(bills)
+	if err != nil {
+		return err
+	}
+	return s.Set(ctx, key, string(data), time.Duration(ttl)*time.Second)
+}
+
+func (s *memoryStore) RateLimit(ctx context.Context, key string, limit int, window int64) error {
+	return nil
+}
+
+func (s *memoryStore) SaveRefreshJob(ctx context.Context, job *domain.RefreshJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *job
+	copied.Accounts = append([]domain.AccountRefresh(nil), job.Accounts...)
+	s.jobs[job.ID] = copied
+	return nil
+}
+
+func (s *memoryStore) GetRefreshJob(ctx context.Context, id string) (*domain.RefreshJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	job.Accounts = append([]domain.AccountRefresh(nil), job.Accounts...)
+	return &job, nil
+}
+
+// memoryQueue is an in-memory JobQueue recording acknowledgements
+type memoryQueue struct {
+	jobs     chan *domain.Job
+	mu       sync.Mutex
+	acked    []string
+	nacks    []string
+	extended map[string]int
+}
+
+func newMemoryQueue() *memoryQueue {
+	return &memoryQueue{jobs: make(chan *domain.Job, 10)}
+}
+
+func (q *memoryQueue) Enqueue(ctx context.Context, job *domain.Job) error {
+	job.ID = uuid.New().String()
+	job.MaxAttempts = 3
+	q.jobs <- job
+	return nil
+}
+
+func (q *memoryQueue) Dequeue(ctx context.Context, wait time.Duration) (*domain.Job, error) {
+	select {
+	case job := <-q.jobs:
+		job.Attempts++
+		return job, nil
+	case <-time.After(wait):
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (q *memoryQueue) Extend(ctx context.Context, jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.extended == nil {
+		q.extended = make(map[string]int)
+	}
+	q.extended[jobID]++
+	return nil
+}
+
+func (q *memoryQueue) Ack(ctx context.Context, job *domain.Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.acked = append(q.acked, job.ID)
+	return nil
+}
+
+func (q *memoryQueue) Nack(ctx context.Context, job *domain.Job, cause error) error {
+	q.mu.Lock()
+	q.nacks = append(q.nacks, job.ID)
+	q.mu.Unlock()
+	if job.Attempts < job.MaxAttempts {
+		q.jobs <- job
+	}
+	return nil
+}
+
+func withUser(req *http.Request, userID string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), "user_id", userID))
+}
+
+func TestRefreshBillsRunsAsJob(t *testing.T) {
+	mockRepo := new(MockRepository)
+	store := newMemoryStore()
+	queue := newMemoryQueue()
+	usecase := NewBillRefreshUsecase(mockRepo, newTestRegistry(t, mockRepo), store, store, queue, nil, testRetryPolicy)
+
+	accounts := []*domain.LinkedAccount{
+		{ID: "acc1", UserID: "user1", ProviderID: "mock-provider"},
+		{ID: "acc2", UserID: "user1", ProviderID: "mock-provider"},
+	}
+	mockRepo.On("GetLinkedAccountsByUserID", mock.Anything, "user1").Return(accounts, nil)
+	mockRepo.On("GetLinkedAccountByID", mock.Anything, "acc1").Return(accounts[0], nil)
+	mockRepo.On("GetLinkedAccountByID", mock.Anything, "acc2").Return((*domain.LinkedAccount)(nil), nil)
+	mockRepo.On("UpsertBills", mock.Anything, mock.Anything).Return(&domain.BillUpsertResult{Inserted: 1}, nil)
+	mockRepo.On("MarkMissingBills", mock.Anything, "acc1", mock.Anything, mock.Anything, mock.Anything).Return(0, nil)
+	mockRepo.On("RecordSyncSuccess", mock.Anything, "acc1", mock.Anything).Return(nil)
+
+	// The request only queues the job
+	rec := httptest.NewRecorder()
+	usecase.RefreshBills(rec, withUser(httptest.NewRequest(http.MethodPost, "/bills/refresh", nil), "user1"))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	var accepted struct {
+		JobID  string `json:"job_id"`
+		Status string `json:"status"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&accepted))
+	assert.Equal(t, domain.RefreshJobQueued, accepted.Status)
+	assert.Equal(t, "/bills/refresh/"+accepted.JobID, rec.Header().Get("Location"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	worker := NewJobWorker(queue, time.Minute)
+	worker.Handle(domain.JobTypeBillRefresh, usecase.ProcessJob)
+	go worker.Run(ctx, 1)
+
+	getJob := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/bills/refresh/"+accepted.JobID, nil)
+		req = mux.SetURLVars(withUser(req, userID), map[string]string{"job_id": accepted.JobID})
+		rec := httptest.NewRecorder()
+		usecase.GetRefreshJob(rec, req)
+		return rec
+	}
+
+	var job domain.RefreshJob
+	assert.Eventually(t, func() bool {
+		rec := getJob("user1")
+		return json.NewDecoder(rec.Body).Decode(&job) == nil && job.CompletedAt != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, domain.RefreshJobPartial, job.Status)
+	assert.Equal(t, 1, job.Totals.Inserted)
+	if assert.Len(t, job.Accounts, 2) {
+		assert.Equal(t, domain.AccountRefreshSucceeded, job.Accounts[0].Status)
+		assert.Equal(t, 1, job.Accounts[0].Attempts)
+		assert.Equal(t, domain.AccountRefreshFailed, job.Accounts[1].Status)
+		assert.NotEmpty(t, job.Accounts[1].Error)
+	}
+
+	// Jobs are only visible to the user that started them
+	assert.Equal(t, http.StatusNotFound, getJob("user2").Code)
+
+	assert.Eventually(t, func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return len(queue.acked) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestJobWorkerRetriesFailedJobs(t *testing.T) {
+	queue := newMemoryQueue()
+	worker := NewJobWorker(queue, time.Minute)
+
+	var mu sync.Mutex
+	calls := 0
+	worker.Handle("flaky", func(ctx context.Context, payload json.RawMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 2 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Run(ctx, 1)
+
+	assert.NoError(t, queue.Enqueue(ctx, &domain.Job{Type: "flaky"}))
+	assert.NoError(t, queue.Enqueue(ctx, &domain.Job{Type: "unknown"}))
+
+	assert.Eventually(t, func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		// The flaky job succeeds on its second attempt; the unknown job uses all three
+		return len(queue.acked) == 1 && len(queue.nacks) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestJobWorkerExtendsRunningJobs(t *testing.T) {
+	queue := newMemoryQueue()
+	worker := NewJobWorker(queue, 10*time.Millisecond)
+
+	release := make(chan struct{})
+	worker.Handle("slow", func(ctx context.Context, payload json.RawMessage) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Run(ctx, 1)
+
+	job := &domain.Job{Type: "slow"}
+	assert.NoError(t, queue.Enqueue(ctx, job))
+
+	// The reservation is renewed for as long as the handler runs
+	assert.Eventually(t, func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return queue.extended[job.ID] >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return len(queue.acked) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	queue.mu.Lock()
+	extended := queue.extended[job.ID]
+	queue.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	// and no longer once it finished
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	assert.Equal(t, extended, queue.extended[job.ID])
+}
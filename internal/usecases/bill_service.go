@@ -7,27 +7,24 @@ import (
 	"sync"
 	"time"
 
-	"github.com/mel-ak/onetap-challenge/internal/adapters/providers"
 	"github.com/mel-ak/onetap-challenge/internal/domain"
 	"github.com/mel-ak/onetap-challenge/internal/ports"
 )
 
 type billService struct {
-	repo        ports.Repository
-	rateLimiter *RateLimiter
-	providers   map[string]providers.Provider
+	repo      ports.Repository
+	providers ports.ProviderRegistry
+	fetches   *fetchCoalescer
 }
 
-// NewBillService creates a new instance of the bill service
-func NewBillService(repo ports.Repository) ports.BillService {
-	// Initialize providers map with mock provider
-	providersMap := make(map[string]providers.Provider)
-	providersMap["mock-provider"] = providers.NewMockProviderAdapter("http://localhost:8083")
-
+// NewBillService creates a new instance of the bill service. Concurrent
+// fetches of an account share one provider call; with locks set they are
+// coalesced across processes, handing results over through results.
+func NewBillService(repo ports.Repository, registry ports.ProviderRegistry, locks ports.LockService, results ports.CacheService) ports.BillService {
 	return &billService{
-		repo:        repo,
-		rateLimiter: NewRateLimiter(100, time.Minute), // 100 requests per minute
-		providers:   providersMap,
+		repo:      repo,
+		providers: registry,
+		fetches:   newFetchCoalescer(locks, results),
 	}
 }
 
@@ -45,49 +42,31 @@ func (s *billService) FetchBills(ctx context.Context, userID string) (*domain.Bi
 		return &domain.BillSummary{
 			BillCount: 0,
 			Bills:     nil,
-			TotalDue:  0,
+			TotalDue:  []domain.Money{},
 		}, nil
 	}
 
+	// Fetch bills for each account concurrently. Accounts that fail keep
+	// their stored bills and are reported in the summary.
+	results := make([]accountBills, len(accounts))
 	var wg sync.WaitGroup
-	billChan := make(chan []*domain.Bill, len(accounts))
-	errChan := make(chan error, len(accounts))
-
-	// Fetch bills for each account concurrently
-	for _, account := range accounts {
+	for i, account := range accounts {
 		wg.Add(1)
-		go func(acc *domain.LinkedAccount) {
+		go func(i int, acc *domain.LinkedAccount) {
 			defer wg.Done()
-
-			// Apply rate limiting
-			if err := s.rateLimiter.Wait(ctx); err != nil {
-				errChan <- err
-				return
-			}
-
-			bills, err := s.fetchBillsForAccount(ctx, acc)
-			if err != nil {
-				errChan <- err
-				return
-			}
-			billChan <- bills
-		}(account)
+			results[i] = s.fetchBillsForAccount(ctx, acc)
+		}(i, account)
 	}
-
-	// Wait for all goroutines to complete
 	wg.Wait()
-	close(billChan)
-	close(errChan)
 
-	// Check for errors
-	if len(errChan) > 0 {
-		return nil, <-errChan
-	}
-
-	// Collect all bills
+	// Collect all bills, moving those past their due date to overdue
+	now := time.Now()
 	var allBills []*domain.Bill
-	for bills := range billChan {
-		allBills = append(allBills, bills...)
+	for _, result := range results {
+		for _, bill := range result.bills {
+			bill.MarkOverdue(now)
+		}
+		allBills = append(allBills, result.bills...)
 	}
 
 	// Calculate summary
@@ -96,14 +75,25 @@ func (s *billService) FetchBills(ctx context.Context, userID string) (*domain.Bi
 		Bills:     make([]domain.Bill, len(allBills)),
 	}
 
-	var totalDue float64
+	totalDue := domain.MoneyTotals{}
 	for i, bill := range allBills {
 		summary.Bills[i] = *bill
-		if bill.Status == "unpaid" || bill.Status == "overdue" {
-			totalDue += bill.Amount
+		if bill.Status.Due() {
+			totalDue.Add(bill.Amount)
+		}
+	}
+	summary.TotalDue = totalDue.List()
+
+	summary.Accounts = make([]domain.AccountSyncStatus, len(accounts))
+	for i, account := range accounts {
+		summary.Accounts[i] = domain.AccountSyncStatus{
+			LinkedAccountID: account.ID,
+			ProviderID:      account.ProviderID,
+			Sync:            account.Sync,
+			Stale:           account.Sync.Stale(now, syncStaleAfter),
 		}
+		reportAccount(&summary.Accounts[i], results[i])
 	}
-	summary.TotalDue = totalDue
 
 	return summary, nil
 }
@@ -118,11 +108,11 @@ func (s *billService) FetchBillsByProvider(ctx context.Context, userID string, p
 	var providerBills []*domain.Bill
 	for _, account := range accounts {
 		if account.ProviderID == providerID {
-			bills, err := s.fetchBillsForAccount(ctx, account)
-			if err != nil {
-				return nil, err
+			result := s.fetchBillsForAccount(ctx, account)
+			if result.source == "" {
+				return nil, result.err
 			}
-			providerBills = append(providerBills, bills...)
+			providerBills = append(providerBills, result.bills...)
 		}
 	}
 
@@ -144,23 +134,25 @@ func (s *billService) RefreshBills(ctx context.Context, userID string) error {
 		go func(acc *domain.LinkedAccount) {
 			defer wg.Done()
 
-			if err := s.rateLimiter.Wait(ctx); err != nil {
-				errChan <- err
-				return
-			}
-
-			bills, err := s.fetchBillsForAccount(ctx, acc)
+			// A refresh overlapping another fetch of the account shares its
+			// provider call, which records failures on a copy of the account
+			fetched := *acc
+			bills, _, err := s.fetches.do(ctx, acc.ID, func(ctx context.Context) ([]*domain.Bill, error) {
+				bills, err := fetchAccountBills(ctx, s.providers, fetched)
+				if err != nil {
+					recordSync(ctx, s.repo, &fetched, err)
+				}
+				return bills, err
+			})
 			if err != nil {
 				errChan <- err
 				return
 			}
 
-			// Update bills in database
-			for _, bill := range bills {
-				if err := s.repo.UpdateBill(ctx, bill); err != nil {
-					errChan <- err
-					return
-				}
+			// Upsert bills and record the sync in one transaction
+			if _, err := saveAccountBills(ctx, s.repo, acc, bills); err != nil {
+				recordSync(ctx, s.repo, acc, err)
+				errChan <- err
 			}
 		}(account)
 	}
@@ -180,38 +172,31 @@ func (s *billService) GetBillSummary(ctx context.Context, userID string) (*domai
 	return s.repo.GetBillSummaryByUserID(ctx, userID)
 }
 
-// fetchBillsForAccount is a helper method to fetch bills for a specific account
-func (s *billService) fetchBillsForAccount(ctx context.Context, account *domain.LinkedAccount) ([]*domain.Bill, error) {
-	provider, exists := s.providers[account.ProviderID]
-	if !exists {
-		return nil, fmt.Errorf("provider not found: %s", account.ProviderID)
+// fetchBillsForAccount is a helper method to fetch bills for a specific
+// account and save them with the sync, or record the failure. When the
+// provider fails the bills stored by the last successful sync are returned
+// instead.
+func (s *billService) fetchBillsForAccount(ctx context.Context, account *domain.LinkedAccount) accountBills {
+	fetched := *account
+	bills, _, err := s.fetches.do(ctx, account.ID, func(ctx context.Context) ([]*domain.Bill, error) {
+		bills, err := fetchAccountBills(ctx, s.providers, fetched)
+		if err != nil {
+			recordSync(ctx, s.repo, &fetched, err)
+			return nil, err
+		}
+		if _, err := saveAccountBills(ctx, s.repo, &fetched, bills); err != nil {
+			log.Printf("Failed to save fetched bills of account %s: %v", fetched.ID, err)
+		}
+		return bills, nil
+	})
+	applySync(account, time.Now(), err)
+	if err == nil {
+		return accountBills{bills: bills, source: domain.BillSourceLive}
 	}
 
-	return provider.FetchBills(ctx, account.ID)
-}
-
-// StartPeriodicUpdates starts the background job for periodic bill updates
-func (s *billService) StartPeriodicUpdates(ctx context.Context) {
-	ticker := time.NewTicker(24 * time.Hour) // Update daily
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				users, err := s.repo.ListUsers(ctx)
-				if err != nil {
-					log.Printf("Error fetching users for periodic update: %v", err)
-					continue
-				}
-
-				for _, user := range users {
-					if err := s.RefreshBills(ctx, user.ID); err != nil {
-						log.Printf("Error refreshing bills for user %s: %v", user.ID, err)
-					}
-				}
-			case <-ctx.Done():
-				ticker.Stop()
-				return
-			}
-		}
-	}()
+	stored, storedErr := s.repo.GetBillsByLinkedAccountID(ctx, account.ID)
+	if storedErr != nil || (len(stored) == 0 && account.Sync.LastSuccessAt == nil) {
+		return accountBills{err: err}
+	}
+	return accountBills{bills: stored, source: domain.BillSourceDatabase, err: err}
 }
@@ -2,10 +2,17 @@ package usecases
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/mel-ak/onetap-challenge/internal/adapters/providers"
 	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -102,6 +109,26 @@ func (m *MockRepository) UpdateLinkedAccount(ctx context.Context, account *domai
 	return args.Error(0)
 }
 
+func (m *MockRepository) RecordSyncSuccess(ctx context.Context, id string, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RecordSyncFailure(ctx context.Context, id string, at time.Time, status, cause string) error {
+	args := m.Called(ctx, id, at, status, cause)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ListDueLinkedAccounts(ctx context.Context, now time.Time, limit int) ([]*domain.ScheduledAccount, error) {
+	args := m.Called(ctx, now, limit)
+	return args.Get(0).([]*domain.ScheduledAccount), args.Error(1)
+}
+
+func (m *MockRepository) ScheduleLinkedAccount(ctx context.Context, id string, next time.Time) error {
+	args := m.Called(ctx, id, next)
+	return args.Error(0)
+}
+
 func (m *MockRepository) DeleteLinkedAccount(ctx context.Context, id string) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
@@ -143,16 +170,69 @@ func (m *MockRepository) DeleteBill(ctx context.Context, id string) error {
 	return args.Error(0)
 }
 
+// WithTx runs fn against the mock itself, there is no transaction to manage
+func (m *MockRepository) WithTx(ctx context.Context, fn func(tx ports.Repository) error) error {
+	return fn(m)
+}
+
+func (m *MockRepository) MarkOverdueBills(ctx context.Context, now time.Time) (int, error) {
+	args := m.Called(ctx, now)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) MarkMissingBills(ctx context.Context, linkedAccountID string, seenExternalIDs []string, from, to time.Time) (int, error) {
+	args := m.Called(ctx, linkedAccountID, seenExternalIDs, from, to)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) UpsertBills(ctx context.Context, bills []*domain.Bill) (*domain.BillUpsertResult, error) {
+	args := m.Called(ctx, bills)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.BillUpsertResult), args.Error(1)
+}
+
+// newProviderServer starts a fake provider API returning a single unpaid bill
+func newProviderServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{
+				"id":       "BILL-1",
+				"provider": "Electricity Co",
+				"amount":   42.5,
+				"due_date": time.Now().AddDate(0, 0, 7),
+				"status":   "unpaid",
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestRegistry returns a registry with "mock-provider" pointing at a fake provider API
+func newTestRegistry(t *testing.T, repo *MockRepository) *providers.Registry {
+	registry := providers.NewRegistry(repo, nil)
+	err := registry.Register(&domain.Provider{
+		ID:          "mock-provider",
+		Name:        "Mock Provider",
+		APIEndpoint: newProviderServer(t).URL,
+		AuthType:    "none",
+	})
+	assert.NoError(t, err)
+	return registry
+}
+
 func TestFetchBills(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewBillService(mockRepo)
+	service := NewBillService(mockRepo, newTestRegistry(t, mockRepo), nil, nil)
 
 	// Test case: No linked accounts
 	mockRepo.On("GetLinkedAccountsByUserID", mock.Anything, "user1").Return([]*domain.LinkedAccount{}, nil)
 	summary, err := service.FetchBills(context.Background(), "user1")
 	assert.NoError(t, err)
 	assert.Equal(t, 0, summary.BillCount)
-	assert.Equal(t, 0.0, summary.TotalDue)
+	assert.Empty(t, summary.TotalDue)
 	assert.Empty(t, summary.Bills)
 
 	// Test case: With linked accounts
@@ -164,14 +244,145 @@ func TestFetchBills(t *testing.T) {
 		},
 	}
 	mockRepo.On("GetLinkedAccountsByUserID", mock.Anything, "user2").Return(accounts, nil)
+	// Fetched bills are saved with the sync
+	mockRepo.On("UpsertBills", mock.Anything, mock.Anything).Return(&domain.BillUpsertResult{Inserted: 1}, nil).Once()
+	mockRepo.On("MarkMissingBills", mock.Anything, "acc1", mock.Anything, mock.Anything, mock.Anything).Return(0, nil).Once()
+	mockRepo.On("RecordSyncSuccess", mock.Anything, "acc1", mock.AnythingOfType("time.Time")).Return(nil).Once()
 	summary, err = service.FetchBills(context.Background(), "user2")
 	assert.NoError(t, err)
 	assert.NotNil(t, summary)
+	assert.Equal(t, 1, summary.BillCount)
+	assert.Equal(t, []domain.Money{usd(4250)}, summary.TotalDue)
+
+	// The sync state is returned alongside the bills
+	if assert.Len(t, summary.Accounts, 1) {
+		assert.Equal(t, "acc1", summary.Accounts[0].LinkedAccountID)
+		assert.NotNil(t, summary.Accounts[0].Sync.LastSuccessAt)
+		assert.False(t, summary.Accounts[0].Stale)
+		assert.Equal(t, domain.AccountBillsOK, summary.Accounts[0].Status)
+		assert.Equal(t, domain.BillSourceLive, summary.Accounts[0].Source)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestFetchBillsReportsFailedAccounts(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewBillService(mockRepo, newTestRegistry(t, mockRepo), nil, nil)
+
+	lastSuccess := time.Now().Add(-72 * time.Hour)
+	account := &domain.LinkedAccount{
+		ID:         "acc1",
+		UserID:     "user1",
+		ProviderID: "unknown-provider",
+		Sync:       domain.SyncState{LastSuccessAt: &lastSuccess, ConsecutiveFailures: 1},
+	}
+	mockRepo.On("GetLinkedAccountsByUserID", mock.Anything, "user1").Return([]*domain.LinkedAccount{account}, nil)
+	mockRepo.On("GetProviderByID", mock.Anything, "unknown-provider").Return((*domain.Provider)(nil), nil)
+	mockRepo.On("RecordSyncFailure", mock.Anything, "acc1", mock.AnythingOfType("time.Time"), "error", mock.AnythingOfType("string")).Return(nil).Once()
+	stored := []*domain.Bill{{ID: "bill1", LinkedAccountID: "acc1", Amount: usd(1200), Status: "unpaid"}}
+	mockRepo.On("GetBillsByLinkedAccountID", mock.Anything, "acc1").Return(stored, nil).Once()
+
+	// The failed account keeps its stored bills instead of failing the request
+	summary, err := service.FetchBills(context.Background(), "user1")
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+	assert.Equal(t, []domain.Money{usd(1200)}, summary.TotalDue)
+	if assert.Len(t, summary.Accounts, 1) {
+		status := summary.Accounts[0]
+		assert.Equal(t, domain.AccountBillsStale, status.Status)
+		assert.Equal(t, domain.AccountErrorInternal, status.ErrorCode)
+		assert.NotEmpty(t, status.Error)
+		assert.Equal(t, domain.BillSourceDatabase, status.Source)
+		assert.Equal(t, &lastSuccess, status.AsOf)
+	}
+
+	assert.Equal(t, "error", account.Status)
+	assert.Equal(t, 2, account.Sync.ConsecutiveFailures)
+	assert.NotEmpty(t, account.Sync.LastError)
+	assert.Equal(t, &lastSuccess, account.Sync.LastSuccessAt)
+	assert.True(t, account.Sync.Stale(time.Now(), syncStaleAfter))
+}
+
+func TestFetchBillsResolvesProviderRegisteredAfterStartup(t *testing.T) {
+	mockRepo := new(MockRepository)
+	service := NewBillService(mockRepo, providers.NewRegistry(mockRepo, nil), nil, nil)
+
+	accounts := []*domain.LinkedAccount{
+		{
+			ID:          "acc1",
+			UserID:      "user1",
+			ProviderID:  "new-provider",
+			Credentials: "test-key",
+		},
+	}
+	mockRepo.On("GetLinkedAccountsByUserID", mock.Anything, "user1").Return(accounts, nil)
+	mockRepo.On("GetProviderByID", mock.Anything, "new-provider").Return(&domain.Provider{
+		ID:          "new-provider",
+		Name:        "New Provider",
+		APIEndpoint: newProviderServer(t).URL,
+		AuthType:    "api_key",
+	}, nil).Once()
+	mockRepo.On("UpsertBills", mock.Anything, mock.Anything).Return(&domain.BillUpsertResult{Inserted: 1}, nil)
+	mockRepo.On("MarkMissingBills", mock.Anything, "acc1", mock.Anything, mock.Anything, mock.Anything).Return(0, nil)
+	mockRepo.On("RecordSyncSuccess", mock.Anything, "acc1", mock.Anything).Return(nil)
+
+	summary, err := service.FetchBills(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, summary.BillCount)
+
+	// The adapter is cached, so the repository is not queried again
+	_, err = service.FetchBills(context.Background(), "user1")
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+// openBreaker is a CircuitBreaker that rejects every call
+type openBreaker struct{}
+
+func (openBreaker) Allow(ctx context.Context, providerID string) error {
+	return domain.ErrCircuitOpen
+}
+
+func (openBreaker) Record(ctx context.Context, providerID string, latency time.Duration, failed bool) error {
+	return nil
+}
+
+func TestFetchBillsFallsBackToStoredBillsWhenCircuitOpen(t *testing.T) {
+	mockRepo := new(MockRepository)
+	registry := providers.NewRegistry(mockRepo, nil)
+	registry.UseCircuitBreaker(openBreaker{})
+	assert.NoError(t, registry.Register(&domain.Provider{
+		ID:          "mock-provider",
+		APIEndpoint: newProviderServer(t).URL,
+		AuthType:    "none",
+	}))
+	service := NewBillService(mockRepo, registry, nil, nil)
+
+	accounts := []*domain.LinkedAccount{
+		{
+			ID:         "acc1",
+			UserID:     "user1",
+			ProviderID: "mock-provider",
+		},
+	}
+	stored := []*domain.Bill{
+		{ID: "bill1", LinkedAccountID: "acc1", Amount: usd(3000), Status: "unpaid", DueDate: time.Now().AddDate(0, 0, 3)},
+	}
+	mockRepo.On("GetLinkedAccountsByUserID", mock.Anything, "user1").Return(accounts, nil)
+	mockRepo.On("GetBillsByLinkedAccountID", mock.Anything, "acc1").Return(stored, nil).Once()
+
+	// A fast fail is not a sync attempt, so the sync state is left alone
+	summary, err := service.FetchBills(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, summary.BillCount)
+	assert.Equal(t, []domain.Money{usd(3000)}, summary.TotalDue)
+	assert.Zero(t, accounts[0].Sync.ConsecutiveFailures)
+	mockRepo.AssertExpectations(t)
 }
 
 func TestRefreshBills(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewBillService(mockRepo)
+	service := NewBillService(mockRepo, newTestRegistry(t, mockRepo), nil, nil)
 
 	accounts := []*domain.LinkedAccount{
 		{
@@ -182,16 +393,92 @@ func TestRefreshBills(t *testing.T) {
 	}
 	mockRepo.On("GetLinkedAccountsByUserID", mock.Anything, "user1").Return(accounts, nil)
 
-	// Add expectation for UpdateBill
-	mockRepo.On("UpdateBill", mock.Anything, mock.AnythingOfType("*domain.Bill")).Return(nil)
+	// Fetched bills are upserted by their provider bill ID
+	mockRepo.On("UpsertBills", mock.Anything, mock.MatchedBy(func(bills []*domain.Bill) bool {
+		return len(bills) == 1 && bills[0].ExternalID != "" && bills[0].LinkedAccountID == "acc1"
+	})).Return(&domain.BillUpsertResult{Inserted: 1}, nil).Once()
+	mockRepo.On("MarkMissingBills", mock.Anything, "acc1", mock.AnythingOfType("[]string"), mock.Anything, mock.Anything).Return(0, nil).Once()
+	mockRepo.On("RecordSyncSuccess", mock.Anything, "acc1", mock.AnythingOfType("time.Time")).Return(nil).Once()
 
 	err := service.RefreshBills(context.Background(), "user1")
 	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRefreshBillsSharesConcurrentFetches(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"id": "BILL-1", "amount": 42.5, "due_date": time.Now().AddDate(0, 0, 7), "status": "unpaid"},
+		})
+	}))
+	defer srv.Close()
+
+	mockRepo := new(MockRepository)
+	registry := providers.NewRegistry(mockRepo, nil)
+	assert.NoError(t, registry.Register(&domain.Provider{ID: "mock-provider", APIEndpoint: srv.URL, AuthType: "none"}))
+	service := NewBillService(mockRepo, registry, nil, nil)
+
+	for i := 0; i < 2; i++ {
+		accounts := []*domain.LinkedAccount{{ID: "acc1", UserID: "user1", ProviderID: "mock-provider"}}
+		mockRepo.On("GetLinkedAccountsByUserID", mock.Anything, "user1").Return(accounts, nil).Once()
+	}
+	// Every refresh saves the shared bills
+	mockRepo.On("UpsertBills", mock.Anything, mock.Anything).Return(&domain.BillUpsertResult{Inserted: 1}, nil).Once()
+	mockRepo.On("UpsertBills", mock.Anything, mock.Anything).Return(&domain.BillUpsertResult{}, nil).Once()
+	mockRepo.On("MarkMissingBills", mock.Anything, "acc1", mock.Anything, mock.Anything, mock.Anything).Return(0, nil).Twice()
+	mockRepo.On("RecordSyncSuccess", mock.Anything, "acc1", mock.AnythingOfType("time.Time")).Return(nil).Twice()
+
+	// A manual refresh overlapping a scheduled one calls the provider once
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, service.RefreshBills(context.Background(), "user1"))
+		}()
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSaveAccountBillsOnlyMarksBillsInFetchedWindow(t *testing.T) {
+	mockRepo := new(MockRepository)
+	account := &domain.LinkedAccount{ID: "acc1"}
+	march := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)
+	bills := []*domain.Bill{
+		{ExternalID: "b2", LinkedAccountID: "acc1", DueDate: may},
+		{ExternalID: "b1", LinkedAccountID: "acc1", DueDate: march},
+	}
+
+	mockRepo.On("UpsertBills", mock.Anything, mock.Anything).Return(&domain.BillUpsertResult{}, nil).Once()
+	mockRepo.On("UpsertBills", mock.Anything, mock.Anything).Return(&domain.BillUpsertResult{}, nil).Once()
+	mockRepo.On("MarkMissingBills", mock.Anything, "acc1", []string{"b2", "b1"}, march, may).Return(1, nil).Once()
+	mockRepo.On("RecordSyncSuccess", mock.Anything, "acc1", mock.AnythingOfType("time.Time")).Return(nil)
+
+	result, err := saveAccountBills(context.Background(), mockRepo, account, bills)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Missing)
+
+	// An empty response marks nothing missing
+	result, err = saveAccountBills(context.Background(), mockRepo, account, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, result.Missing)
+	mockRepo.AssertExpectations(t)
 }
 
 func TestPeriodicUpdates(t *testing.T) {
 	mockRepo := new(MockRepository)
-	service := NewBillService(mockRepo)
+	service := NewBillService(mockRepo, newTestRegistry(t, mockRepo), nil, nil)
 
 	users := []*domain.User{
 		{ID: "user1"},
@@ -0,0 +1,329 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mel-ak/onetap-challenge/internal/adapters/providers"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// usd returns an amount in US dollars
+func usd(cents int64) domain.Money {
+	return domain.Money{Minor: cents, Currency: "USD"}
+}
+
+// stubBillRepository serves stored bills per linked account
+type stubBillRepository struct {
+	bills map[string][]*domain.Bill
+	// searches records the queries of SearchBills
+	searches []domain.BillQuery
+}
+
+func (s *stubBillRepository) SaveBill(ctx context.Context, bill domain.Bill) error {
+	return nil
+}
+
+func (s *stubBillRepository) GetBillByID(ctx context.Context, id string) (*domain.Bill, error) {
+	for _, bills := range s.bills {
+		for _, bill := range bills {
+			if bill.ID == id {
+				return bill, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (s *stubBillRepository) GetBillsByLinkedAccountID(ctx context.Context, linkedAccountID string) ([]*domain.Bill, error) {
+	return s.bills[linkedAccountID], nil
+}
+
+// SearchBills pages through every stored bill by id, ignoring filters
+func (s *stubBillRepository) SearchBills(ctx context.Context, q domain.BillQuery) (*domain.BillPage, error) {
+	s.searches = append(s.searches, q)
+	var bills []*domain.Bill
+	for _, stored := range s.bills {
+		for _, bill := range stored {
+			if bill.ID > q.Cursor {
+				bills = append(bills, bill)
+			}
+		}
+	}
+	sort.Slice(bills, func(i, j int) bool { return bills[i].ID < bills[j].ID })
+
+	page := &domain.BillPage{Bills: bills}
+	if len(bills) > q.Limit {
+		page.Bills = bills[:q.Limit]
+		page.NextCursor = page.Bills[q.Limit-1].ID
+	}
+	return page, nil
+}
+
+func TestFetchBillsFallsBackWhenProviderFails(t *testing.T) {
+	mockRepo := new(MockRepository)
+	var calls atomic.Int32
+	registry := providers.NewRegistry(mockRepo, nil)
+	assert.NoError(t, registry.Register(&domain.Provider{
+		ID:          "mock-provider",
+		APIEndpoint: newStatusServer(t, http.StatusServiceUnavailable, &calls).URL,
+		AuthType:    "none",
+	}))
+
+	lastSuccess := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	accounts := &stubAccountRepository{accounts: []domain.LinkedAccount{
+		{ID: "acc1", UserID: "user1", ProviderID: "mock-provider", Sync: domain.SyncState{LastSuccessAt: &lastSuccess}},
+		{ID: "acc2", UserID: "user1", ProviderID: "mock-provider", Sync: domain.SyncState{LastSuccessAt: &lastSuccess}},
+	}}
+	stored := &stubBillRepository{bills: map[string][]*domain.Bill{
+		"acc1": {{ID: "bill1", LinkedAccountID: "acc1", Amount: usd(1000), Status: "unpaid"}},
+		"acc2": {{ID: "bill2", LinkedAccountID: "acc2", Amount: usd(2000), Status: "unpaid"}},
+	}}
+	store := newMemoryStore()
+	queue := newMemoryQueue()
+	usecase := NewBillUsecase(accounts, stored, mockRepo, registry, store, nil, testRetryPolicy)
+	usecase.UseRevalidation(NewBillRefreshUsecase(mockRepo, registry, store, store, queue, nil, testRetryPolicy))
+
+	// acc1 has bills cached by an earlier sync, acc2 only stored ones
+	assert.NoError(t, store.CacheBills(context.Background(), "bills:acc1", []*domain.Bill{
+		{ID: "bill1", LinkedAccountID: "acc1", Amount: usd(1000), Status: "unpaid"},
+	}, int64(billsCacheTTL.Seconds())))
+	mockRepo.On("RecordSyncFailure", mock.Anything, mock.Anything, mock.AnythingOfType("time.Time"), "error", mock.AnythingOfType("string")).Return(nil).Twice()
+
+	rec := httptest.NewRecorder()
+	usecase.FetchBills(rec, httptest.NewRequest(http.MethodGet, "/bills?user_id=user1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		BillCount int                        `json:"bill_count"`
+		TotalDue  []domain.Money             `json:"total_due"`
+		Accounts  []domain.AccountSyncStatus `json:"accounts"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, 2, resp.BillCount)
+	assert.Equal(t, []domain.Money{usd(3000)}, resp.TotalDue)
+	if assert.Len(t, resp.Accounts, 2) {
+		assert.Equal(t, domain.BillSourceCache, resp.Accounts[0].Source)
+		assert.Equal(t, domain.BillSourceDatabase, resp.Accounts[1].Source)
+		for _, status := range resp.Accounts {
+			assert.True(t, lastSuccess.Equal(*status.AsOf))
+			assert.Equal(t, 1, status.Sync.ConsecutiveFailures)
+			assert.Equal(t, domain.AccountBillsStale, status.Status)
+			assert.Equal(t, domain.AccountErrorProviderUnavailable, status.ErrorCode)
+		}
+	}
+	assert.Equal(t, int32(2*testRetryPolicy.maxAttempts), calls.Load())
+	mockRepo.AssertExpectations(t)
+
+	// Both accounts are revalidated by one background refresh
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		for _, job := range store.jobs {
+			return job.Trigger == domain.RefreshTriggerRevalidate && len(job.Accounts) == 2
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
+
+// fixedRates is an ExchangeRateSource serving the same rates
+type fixedRates struct {
+	rates *domain.ExchangeRates
+}
+
+func (f fixedRates) ExchangeRates(ctx context.Context) (*domain.ExchangeRates, error) {
+	return f.rates, nil
+}
+
+func TestFetchBillsConvertsTotalToPreferredCurrency(t *testing.T) {
+	var calls atomic.Int32
+	registry := providers.NewRegistry(nil, nil)
+	assert.NoError(t, registry.Register(&domain.Provider{
+		ID:          "mock-provider",
+		APIEndpoint: newStatusServer(t, http.StatusOK, &calls).URL,
+		AuthType:    "none",
+	}))
+
+	lastSuccess := time.Now().Add(-time.Minute)
+	accounts := &stubAccountRepository{accounts: []domain.LinkedAccount{
+		{ID: "acc1", UserID: "user1", ProviderID: "mock-provider", Sync: domain.SyncState{LastSuccessAt: &lastSuccess}},
+	}}
+	store := newMemoryStore()
+	assert.NoError(t, store.CacheBills(context.Background(), "bills:acc1", []*domain.Bill{
+		{ID: "bill1", LinkedAccountID: "acc1", Amount: usd(1000), Status: "unpaid"},
+		{ID: "bill2", LinkedAccountID: "acc1", Amount: domain.Money{Minor: 500, Currency: "GBP"}, Status: "unpaid"},
+		// Paid and cancelled bills are not due
+		{ID: "bill3", LinkedAccountID: "acc1", Amount: usd(2500), Status: "paid"},
+		{ID: "bill4", LinkedAccountID: "acc1", Amount: usd(700), Status: "cancelled"},
+	}, int64(billsCacheTTL.Seconds())))
+
+	rates := &domain.ExchangeRates{Base: "USD", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	assert.NoError(t, rates.SetRate("EUR", "0.9"))
+	assert.NoError(t, rates.SetRate("GBP", "0.8"))
+	users := new(MockRepository)
+	users.On("GetUserByID", mock.Anything, "user1").Return(&domain.User{ID: "user1", PreferredCurrency: "EUR"}, nil)
+
+	usecase := NewBillUsecase(accounts, &stubBillRepository{}, nil, registry, store, nil, testRetryPolicy)
+	usecase.UseExchangeRates(users, fixedRates{rates})
+
+	rec := httptest.NewRecorder()
+	usecase.FetchBills(rec, httptest.NewRequest(http.MethodGet, "/bills?user_id=user1", nil))
+
+	var resp struct {
+		TotalDue []domain.Money    `json:"total_due"`
+		Total    map[string]string `json:"total"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, []domain.Money{{Minor: 500, Currency: "GBP"}, usd(1000)}, resp.TotalDue)
+	assert.Zero(t, calls.Load())
+	// 10 USD is 9 EUR and 5 GBP is 6.25 USD, so 5.625 EUR
+	assert.Equal(t, map[string]string{"amount": "14.63", "currency": "EUR", "rates_date": "2024-05-01"}, resp.Total)
+
+	// Without a rate for one of the currencies there is no total
+	delete(rates.Rates, "GBP")
+	rec = httptest.NewRecorder()
+	usecase.FetchBills(rec, httptest.NewRequest(http.MethodGet, "/bills?user_id=user1", nil))
+	resp.Total = nil
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Nil(t, resp.Total)
+}
+
+func TestFetchBillsSavesLiveBills(t *testing.T) {
+	mockRepo := new(MockRepository)
+	accounts := &stubAccountRepository{accounts: []domain.LinkedAccount{
+		{ID: "acc1", UserID: "user1", ProviderID: "mock-provider"},
+	}}
+	// The page is read from the stored bills once the live ones are saved
+	stored := &stubBillRepository{bills: map[string][]*domain.Bill{
+		"acc1": {{ID: "bill1", ExternalID: "BILL-1", LinkedAccountID: "acc1", Amount: usd(4250), Status: "unpaid"}},
+	}}
+	usecase := NewBillUsecase(accounts, stored, mockRepo, newTestRegistry(t, mockRepo), newMemoryStore(), nil, testRetryPolicy)
+
+	// The bills served live are stored with the sync that dates them
+	mockRepo.On("UpsertBills", mock.Anything, mock.MatchedBy(func(bills []*domain.Bill) bool {
+		return len(bills) == 1 && bills[0].LinkedAccountID == "acc1"
+	})).Return(&domain.BillUpsertResult{Inserted: 1}, nil).Once()
+	mockRepo.On("MarkMissingBills", mock.Anything, "acc1", mock.Anything, mock.Anything, mock.Anything).Return(0, nil).Once()
+	mockRepo.On("RecordSyncSuccess", mock.Anything, "acc1", mock.AnythingOfType("time.Time")).Return(nil).Once()
+
+	rec := httptest.NewRecorder()
+	usecase.FetchBills(rec, httptest.NewRequest(http.MethodGet, "/bills?user_id=user1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		BillCount int                        `json:"bill_count"`
+		Accounts  []domain.AccountSyncStatus `json:"accounts"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, 1, resp.BillCount)
+	if assert.Len(t, resp.Accounts, 1) {
+		assert.Equal(t, domain.BillSourceLive, resp.Accounts[0].Source)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetBillChecksOwnership(t *testing.T) {
+	accounts := &stubAccountRepository{accounts: []domain.LinkedAccount{{ID: "acc1", UserID: "user1"}}}
+	stored := &stubBillRepository{bills: map[string][]*domain.Bill{
+		"acc1": {{
+			ID: "bill1", LinkedAccountID: "acc1", Amount: usd(5240), Status: domain.BillUnpaid, DueDate: time.Now().Add(24 * time.Hour),
+			LineItems: []domain.BillLineItem{{Description: "Energy charge", Category: "energy", Amount: usd(4120)}},
+			Usage:     []domain.UsageReading{{Quantity: "350.5", Unit: "kWh"}},
+		}},
+		"acc2": {{ID: "bill2", LinkedAccountID: "acc2", Amount: usd(1000), Status: domain.BillUnpaid}},
+	}}
+	usecase := NewBillUsecase(accounts, stored, nil, nil, newMemoryStore(), nil, testRetryPolicy)
+
+	get := func(billID string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/bills/"+billID, nil)
+		usecase.GetBill(rec, mux.SetURLVars(withUser(req, "user1"), map[string]string{"bill_id": billID}))
+		return rec
+	}
+
+	rec := get("bill1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var bill domain.Bill
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&bill))
+	assert.Equal(t, stored.bills["acc1"][0].LineItems, bill.LineItems)
+	assert.Equal(t, stored.bills["acc1"][0].Usage, bill.Usage)
+
+	// Bills of other users look like bills that do not exist
+	assert.Equal(t, http.StatusNotFound, get("bill2").Code)
+	assert.Equal(t, http.StatusNotFound, get("bill3").Code)
+}
+
+func TestFetchBillsServesFreshCacheWithoutCallingProvider(t *testing.T) {
+	var calls atomic.Int32
+	registry := providers.NewRegistry(nil, nil)
+	assert.NoError(t, registry.Register(&domain.Provider{
+		ID:          "mock-provider",
+		APIEndpoint: newStatusServer(t, http.StatusOK, &calls).URL,
+		AuthType:    "none",
+	}))
+
+	lastSuccess := time.Now().Add(-time.Minute)
+	accounts := &stubAccountRepository{accounts: []domain.LinkedAccount{
+		{ID: "acc1", UserID: "user1", ProviderID: "mock-provider", Sync: domain.SyncState{LastSuccessAt: &lastSuccess}},
+	}}
+	store := newMemoryStore()
+	stored := &stubBillRepository{bills: map[string][]*domain.Bill{
+		"acc1": {{ID: "bill1", LinkedAccountID: "acc1", Amount: usd(1000), Status: "unpaid"}},
+	}}
+	usecase := NewBillUsecase(accounts, stored, nil, registry, store, nil, testRetryPolicy)
+	assert.NoError(t, store.CacheBills(context.Background(), "bills:acc1", []*domain.Bill{
+		{ID: "bill1", LinkedAccountID: "acc1", Amount: usd(1000), Status: "unpaid"},
+	}, int64(billsCacheTTL.Seconds())))
+
+	rec := httptest.NewRecorder()
+	usecase.FetchBills(rec, httptest.NewRequest(http.MethodGet, "/bills?user_id=user1", nil))
+
+	var resp struct {
+		BillCount int                        `json:"bill_count"`
+		Accounts  []domain.AccountSyncStatus `json:"accounts"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, 1, resp.BillCount)
+	if assert.Len(t, resp.Accounts, 1) {
+		assert.Equal(t, domain.BillSourceCache, resp.Accounts[0].Source)
+		assert.Equal(t, domain.AccountBillsOK, resp.Accounts[0].Status)
+	}
+	assert.Zero(t, calls.Load())
+}
+
+func TestReportAccountClassifiesFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		loaded accountBills
+		status string
+		code   string
+	}{
+		{"live", accountBills{source: domain.BillSourceLive}, domain.AccountBillsOK, ""},
+		{"throttled", accountBills{source: domain.BillSourceCache, err: domain.ErrRateLimited}, domain.AccountBillsRateLimited, domain.AccountErrorRateLimited},
+		{"provider throttled", accountBills{source: domain.BillSourceDatabase, err: &domain.ProviderError{StatusCode: http.StatusTooManyRequests}}, domain.AccountBillsRateLimited, domain.AccountErrorRateLimited},
+		{"provider down", accountBills{source: domain.BillSourceDatabase, err: &domain.ProviderError{StatusCode: http.StatusBadGateway}}, domain.AccountBillsStale, domain.AccountErrorProviderUnavailable},
+		{"circuit open", accountBills{source: domain.BillSourceCache, err: domain.ErrCircuitOpen}, domain.AccountBillsStale, domain.AccountErrorCircuitOpen},
+		{"bad request", accountBills{source: domain.BillSourceDatabase, err: &domain.ProviderError{StatusCode: http.StatusBadRequest}}, domain.AccountBillsStale, domain.AccountErrorProviderRejected},
+		{"rejected credentials", accountBills{err: domain.ErrInvalidCredentials}, domain.AccountBillsFailed, domain.AccountErrorInvalidCredentials},
+		{"no fallback", accountBills{err: errors.New("database is down")}, domain.AccountBillsFailed, domain.AccountErrorInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status domain.AccountSyncStatus
+			reportAccount(&status, tt.loaded)
+			assert.Equal(t, tt.status, status.Status)
+			assert.Equal(t, tt.code, status.ErrorCode)
+			assert.Equal(t, tt.loaded.source, status.Source)
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// Settings of fetches coalesced across processes
+const (
+	// fetchLockTTL bounds how long a crashed process blocks fetches of an
+	// account. The lock is extended while the fetch runs.
+	fetchLockTTL = time.Minute
+	// fetchResultTTL is how long the bills of a finished fetch are handed to
+	// callers that waited on it
+	fetchResultTTL = 10 * time.Second
+	// fetchPollInterval is how often callers check whether the fetch they
+	// wait on finished
+	fetchPollInterval = 100 * time.Millisecond
+)
+
+// fetchCoalescer makes concurrent fetches of the same linked account share one
+// upstream call. Callers in this process wait on the fetch in flight; with
+// locks set, callers in other processes wait for the result of the process
+// holding the account's fetch lock.
+type fetchCoalescer struct {
+	locks   ports.LockService
+	results ports.CacheService
+	lockTTL time.Duration
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a fetch in progress and, once done is closed, its result
+type flight struct {
+	done   chan struct{}
+	bills  []*domain.Bill
+	err    error
+	shared bool // The bills were fetched by another process
+	// waiters counts the callers waiting on the flight; cancel stops waiting
+	// for another process once none is left
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// newFetchCoalescer creates a coalescer sharing results across processes
+// through locks and results. With nil locks fetches are only coalesced within
+// this process.
+func newFetchCoalescer(locks ports.LockService, results ports.CacheService) *fetchCoalescer {
+	return &fetchCoalescer{
+		locks:   locks,
+		results: results,
+		lockTTL: fetchLockTTL,
+		flights: make(map[string]*flight),
+	}
+}
+
+// do calls fetch for the account unless a fetch of it is already in flight,
+// and waits for the result. shared reports whether the result came from a
+// fetch started by another caller. Once started, fetch runs detached from ctx
+// since other callers may wait on it, so fetch must not touch caller state.
+func (c *fetchCoalescer) do(ctx context.Context, accountID string, fetch func(ctx context.Context) ([]*domain.Bill, error)) (bills []*domain.Bill, shared bool, err error) {
+	c.mu.Lock()
+	f, inFlight := c.flights[accountID]
+	if !inFlight {
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		c.flights[accountID] = f
+		go c.run(flightCtx, accountID, f, fetch)
+	}
+	f.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		// Callers may modify the bills they get, so each gets its own
+		return cloneBills(f.bills), inFlight || f.shared, f.err
+	case <-ctx.Done():
+		c.leave(accountID, f)
+		return nil, false, ctx.Err()
+	}
+}
+
+// leave stops waiting on flight f. When no caller is left the flight stops
+// waiting for another process and later callers start a new one.
+func (c *fetchCoalescer) leave(accountID string, f *flight) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f.waiters--
+	if f.waiters == 0 {
+		f.cancel()
+		if c.flights[accountID] == f {
+			delete(c.flights, accountID)
+		}
+	}
+}
+
+// run completes flight f and hands its result to the callers waiting on it
+func (c *fetchCoalescer) run(ctx context.Context, accountID string, f *flight, fetch func(ctx context.Context) ([]*domain.Bill, error)) {
+	f.bills, f.shared, f.err = c.fetchOnce(ctx, accountID, fetch)
+
+	c.mu.Lock()
+	if c.flights[accountID] == f {
+		delete(c.flights, accountID)
+	}
+	c.mu.Unlock()
+	f.cancel()
+	close(f.done)
+}
+
+// fetchOnce calls fetch while holding the account's fetch lock, or waits for
+// the bills fetched by the process holding it until ctx is done. When that
+// process fails, the lock is taken over and the account fetched here. A
+// fetch once started is not cancelled with ctx, so that its lock is released
+// and its result shared.
+func (c *fetchCoalescer) fetchOnce(ctx context.Context, accountID string, fetch func(ctx context.Context) ([]*domain.Bill, error)) ([]*domain.Bill, bool, error) {
+	fetchCtx := context.WithoutCancel(ctx)
+	if c.locks == nil {
+		bills, err := fetch(fetchCtx)
+		return bills, false, err
+	}
+
+	lockKey := "fetch:" + accountID
+	resultKey := "fetched_bills:" + accountID
+	for waited := false; ; waited = true {
+		// Once another process held the lock, its result may be ready
+		if waited {
+			if bills, err := c.results.GetBills(ctx, resultKey); err == nil {
+				return bills, true, nil
+			}
+		}
+
+		token, err := c.locks.AcquireLock(ctx, lockKey, c.lockTTL)
+		if err != nil && ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Fetching account %s without lock: %v", accountID, err)
+			bills, err := fetch(fetchCtx)
+			return bills, false, err
+		}
+		if token != "" {
+			bills, err := c.fetchLocked(fetchCtx, accountID, lockKey, token, fetch)
+			if err == nil {
+				if err := c.results.CacheBills(fetchCtx, resultKey, bills, int64(fetchResultTTL.Seconds())); err != nil {
+					log.Printf("Failed to share bills fetched for account %s: %v", accountID, err)
+				}
+			}
+			if err := c.locks.ReleaseLock(fetchCtx, lockKey, token); err != nil {
+				log.Printf("Failed to release fetch lock of account %s: %v", accountID, err)
+			}
+			return bills, false, err
+		}
+
+		// Another process is fetching the account
+		poll := time.NewTimer(fetchPollInterval)
+		select {
+		case <-poll.C:
+		case <-ctx.Done():
+			poll.Stop()
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// fetchLocked calls fetch while extending the fetch lock held by token three
+// times per TTL, so that slow fetches keep other processes waiting
+func (c *fetchCoalescer) fetchLocked(ctx context.Context, accountID, lockKey, token string, fetch func(ctx context.Context) ([]*domain.Bill, error)) ([]*domain.Bill, error) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(c.lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				held, err := c.locks.RefreshLock(ctx, lockKey, token, c.lockTTL)
+				if err != nil {
+					log.Printf("Failed to extend fetch lock of account %s: %v", accountID, err)
+				} else if !held {
+					log.Printf("Lost fetch lock of account %s", accountID)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	bills, err := fetch(ctx)
+	close(done)
+	<-stopped
+	return bills, err
+}
+
+// cloneBills copies bills so callers sharing a fetch do not share bills
+func cloneBills(bills []*domain.Bill) []*domain.Bill {
+	if bills == nil {
+		return nil
+	}
+	cloned := make([]*domain.Bill, len(bills))
+	for i, bill := range bills {
+		copied := *bill
+		cloned[i] = &copied
+	}
+	return cloned
+}
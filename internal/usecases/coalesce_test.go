@@ -0,0 +1,209 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchCoalescerSharesFetchWithinProcess(t *testing.T) {
+	coalescer := newFetchCoalescer(nil, nil)
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fetch := func(ctx context.Context) ([]*domain.Bill, error) {
+		calls.Add(1)
+		<-release
+		return []*domain.Bill{{ID: "bill1", Amount: usd(1000)}}, nil
+	}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	var sharedCount atomic.Int32
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bills, shared, err := coalescer.do(context.Background(), "acc1", fetch)
+			assert.NoError(t, err)
+			assert.Len(t, bills, 1)
+			if shared {
+				sharedCount.Add(1)
+			}
+		}()
+	}
+
+	// Let every caller join the flight before it completes
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, int32(callers-1), sharedCount.Load())
+}
+
+func TestFetchCoalescerWaiterStopsOnContext(t *testing.T) {
+	coalescer := newFetchCoalescer(nil, nil)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	go coalescer.do(context.Background(), "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, err := coalescer.do(ctx, "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+		t.Error("the account is fetched twice")
+		return nil, nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFetchCoalescerSharesFetchAcrossProcesses(t *testing.T) {
+	locks := newMemoryLocks()
+	store := newMemoryStore()
+	first := newFetchCoalescer(locks, store)
+	second := newFetchCoalescer(locks, store)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bills, shared, err := first.do(context.Background(), "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+			close(started)
+			<-release
+			return []*domain.Bill{{ID: "bill1", Amount: usd(1000)}}, nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, bills, 1)
+		assert.False(t, shared)
+	}()
+	<-started
+
+	// The second process waits for the lock holder's bills
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	bills, shared, err := second.do(context.Background(), "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+		t.Error("the account is fetched by both processes")
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, shared)
+	if assert.Len(t, bills, 1) {
+		assert.Equal(t, "bill1", bills[0].ID)
+	}
+	<-done
+}
+
+func TestFetchCoalescerTakesOverAfterFailedFetch(t *testing.T) {
+	locks := newMemoryLocks()
+	store := newMemoryStore()
+	first := newFetchCoalescer(locks, store)
+	second := newFetchCoalescer(locks, store)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go first.do(context.Background(), "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+		close(started)
+		<-release
+		return nil, errors.New("provider unavailable")
+	})
+	<-started
+	close(release)
+
+	// Nothing was fetched for the second process to share, so it fetches itself
+	bills, shared, err := second.do(context.Background(), "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+		return []*domain.Bill{{ID: "bill2"}}, nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, shared)
+	assert.Len(t, bills, 1)
+}
+
+func TestFetchCoalescerGivesEveryCallerItsOwnBills(t *testing.T) {
+	coalescer := newFetchCoalescer(nil, nil)
+	fetched := []*domain.Bill{{ID: "bill1", Amount: usd(1000)}}
+	bills, shared, err := coalescer.do(context.Background(), "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+		return fetched, nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, shared)
+
+	// The caller that started the fetch gets a copy as well
+	bills[0].Status = domain.BillOverdue
+	assert.Empty(t, fetched[0].Status)
+}
+
+func TestFetchCoalescerStopsWaitingOnOtherProcessWithContext(t *testing.T) {
+	locks := newMemoryLocks()
+	store := newMemoryStore()
+	first := newFetchCoalescer(locks, store)
+	second := newFetchCoalescer(locks, store)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	go first.do(context.Background(), "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, _, err := second.do(ctx, "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+		t.Error("the account is fetched by both processes")
+		return nil, nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(begin), time.Second)
+
+	// Nobody waits on the abandoned flight any more
+	second.mu.Lock()
+	defer second.mu.Unlock()
+	assert.Empty(t, second.flights)
+}
+
+// countingLocks counts the renewals of memoryLocks leases
+type countingLocks struct {
+	*memoryLocks
+	refreshes atomic.Int32
+}
+
+func (l *countingLocks) RefreshLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	l.refreshes.Add(1)
+	return l.memoryLocks.RefreshLock(ctx, key, token, ttl)
+}
+
+func TestFetchCoalescerExtendsLockWhileFetching(t *testing.T) {
+	locks := &countingLocks{memoryLocks: newMemoryLocks()}
+	coalescer := newFetchCoalescer(locks, newMemoryStore())
+	coalescer.lockTTL = 30 * time.Millisecond
+
+	_, _, err := coalescer.do(context.Background(), "acc1", func(ctx context.Context) ([]*domain.Bill, error) {
+		time.Sleep(100 * time.Millisecond)
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, locks.refreshes.Load(), int32(2))
+
+	// Renewals stop with the fetch
+	refreshes := locks.refreshes.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, refreshes, locks.refreshes.Load())
+}
@@ -0,0 +1,74 @@
+package usecases
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// ExchangeRateUsecase serves the exchange rates bill totals are converted with
+type ExchangeRateUsecase struct {
+	rates      ports.ExchangeRateSource
+	adminToken string
+}
+
+// NewExchangeRateUsecase creates a new exchange rate use case. Rates can be
+// replaced by administrators presenting adminToken when rates is an
+// ExchangeRateStore.
+func NewExchangeRateUsecase(rates ports.ExchangeRateSource, adminToken string) *ExchangeRateUsecase {
+	return &ExchangeRateUsecase{
+		rates:      rates,
+		adminToken: adminToken,
+	}
+}
+
+// GetExchangeRates handles GET /exchange-rates
+func (u *ExchangeRateUsecase) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := u.rates.ExchangeRates(r.Context())
+	if err != nil {
+		log.Printf("Failed to load exchange rates: %v", err)
+		http.Error(w, "Failed to load exchange rates", http.StatusInternalServerError)
+		return
+	}
+	if rates == nil {
+		http.Error(w, "No exchange rates configured", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// UpdateExchangeRates handles PUT /exchange-rates, replacing every rate
+func (u *ExchangeRateUsecase) UpdateExchangeRates(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("X-Admin-Token")
+	if u.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(u.adminToken)) != 1 {
+		http.Error(w, "Admin token required", http.StatusForbidden)
+		return
+	}
+
+	store, ok := u.rates.(ports.ExchangeRateStore)
+	if !ok {
+		http.Error(w, "Exchange rates are read from a file", http.StatusConflict)
+		return
+	}
+
+	var rates domain.ExchangeRates
+	if err := json.NewDecoder(r.Body).Decode(&rates); err != nil {
+		http.Error(w, "Invalid exchange rates: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := store.SaveExchangeRates(r.Context(), &rates); err != nil {
+		log.Printf("Failed to save exchange rates: %v", err)
+		http.Error(w, "Failed to save exchange rates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
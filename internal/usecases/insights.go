@@ -0,0 +1,83 @@
+package usecases
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// Number of months GET /insights/spending covers
+const (
+	defaultSpendingMonths = 6
+	maxSpendingMonths     = 24
+)
+
+// InsightsUsecase serves insights into the spending of users
+type InsightsUsecase struct {
+	insights ports.InsightsRepository
+	users    ports.UserRepository
+}
+
+// NewInsightsUsecase creates a new insights use case. Insights are in the
+// preferred currency of the user found in users unless another is asked for.
+func NewInsightsUsecase(insights ports.InsightsRepository, users ports.UserRepository) *InsightsUsecase {
+	return &InsightsUsecase{
+		insights: insights,
+		users:    users,
+	}
+}
+
+// GetSpending handles GET /insights/spending?months=6&currency=EUR, returning
+// the user's spending per month, provider and utility category over the
+// current month and the months before it
+func (u *InsightsUsecase) GetSpending(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(string)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	months := defaultSpendingMonths
+	if value := r.URL.Query().Get("months"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSpendingMonths {
+			http.Error(w, fmt.Sprintf("months must be between 1 and %d", maxSpendingMonths), http.StatusBadRequest)
+			return
+		}
+		months = parsed
+	}
+
+	currency := r.URL.Query().Get("currency")
+	if currency == "" {
+		user, err := u.users.GetUserByID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			return
+		}
+		if user != nil {
+			currency = user.Currency()
+		}
+	}
+	currency, err := domain.ParseCurrency(currency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := domain.SpendingWindow(userID, currency, months, time.Now())
+	aggregates, err := u.insights.GetSpendingAggregates(r.Context(), q)
+	if err != nil {
+		log.Printf("Failed to aggregate spending of user %s: %v", userID, err)
+		http.Error(w, "Failed to compute spending insights", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domain.NewSpendingInsights(q, aggregates))
+}
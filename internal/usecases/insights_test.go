@@ -0,0 +1,73 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// stubInsightsRepository records spending queries and serves fixed aggregates
+type stubInsightsRepository struct {
+	aggregates *domain.SpendingAggregates
+	queries    []domain.SpendingQuery
+}
+
+func (s *stubInsightsRepository) GetSpendingAggregates(ctx context.Context, q domain.SpendingQuery) (*domain.SpendingAggregates, error) {
+	s.queries = append(s.queries, q)
+	return s.aggregates, nil
+}
+
+func TestGetSpending(t *testing.T) {
+	month := domain.SpendingWindow("", "", 1, time.Now()).From
+	insights := &stubInsightsRepository{aggregates: &domain.SpendingAggregates{
+		Totals: []domain.SpendingTotal{
+			{Month: month, Minor: 4200, BillCount: 1},
+			{Month: month, Category: domain.CategoryGas, Minor: 4200, BillCount: 1},
+			{Month: month, ProviderID: "p1", ProviderName: "Gas Supply", Category: domain.CategoryGas, Minor: 4200, BillCount: 1},
+		},
+		Currencies: []string{"EUR"},
+	}}
+	users := new(MockRepository)
+	users.On("GetUserByID", mock.Anything, "user1").Return(&domain.User{ID: "user1", PreferredCurrency: "EUR"}, nil)
+	usecase := NewInsightsUsecase(insights, users)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		usecase.GetSpending(rec, withUser(httptest.NewRequest(http.MethodGet, "/insights/spending"+query, nil), "user1"))
+		return rec
+	}
+
+	// Insights default to six months in the user's preferred currency
+	rec := get("")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp domain.SpendingInsights
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "EUR", resp.Currency)
+	assert.Len(t, resp.Months, defaultSpendingMonths)
+	assert.Equal(t, domain.Money{Minor: 4200, Currency: "EUR"}, resp.Total)
+	assert.Equal(t, domain.Money{Minor: 700, Currency: "EUR"}, resp.Average)
+	assert.Len(t, resp.Providers, 1)
+	assert.Len(t, resp.Categories, 1)
+	assert.Equal(t, "user1", insights.queries[0].UserID)
+
+	rec = get("?months=12&currency=usd")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "USD", insights.queries[1].Currency)
+	assert.Equal(t, insights.queries[1].To.AddDate(0, -12, 0), insights.queries[1].From)
+
+	for _, query := range []string{"?months=0", "?months=25", "?months=six", "?currency=euro"} {
+		assert.Equal(t, http.StatusBadRequest, get(query).Code, query)
+	}
+	assert.Len(t, insights.queries, 2)
+
+	rec = httptest.NewRecorder()
+	usecase.GetSpending(rec, httptest.NewRequest(http.MethodGet, "/insights/spending", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,52 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// OverdueSweeper moves bills still due to overdue once their due date has
+// passed. Every worker runs a sweeper; bills are locked while they move, so
+// concurrent sweeps never move or record the same bill twice.
+type OverdueSweeper struct {
+	repo     ports.Repository
+	interval time.Duration
+}
+
+// NewOverdueSweeper creates a sweeper running every interval
+func NewOverdueSweeper(repo ports.Repository, interval time.Duration) *OverdueSweeper {
+	return &OverdueSweeper{repo: repo, interval: interval}
+}
+
+// Run sweeps right away and then every interval until ctx is cancelled
+func (s *OverdueSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx, time.Now()); err != nil {
+			log.Printf("Failed to mark overdue bills: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sweep moves the bills due before now to overdue and returns how many moved
+func (s *OverdueSweeper) Sweep(ctx context.Context, now time.Time) (int, error) {
+	moved, err := s.repo.MarkOverdueBills(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	if moved > 0 {
+		log.Printf("Marked %d bills overdue", moved)
+	}
+	return moved, nil
+}
@@ -3,6 +3,7 @@ package usecases
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
@@ -17,36 +18,73 @@ import (
 // ProviderUsecase handles provider-related business logic
 type ProviderUsecase struct {
 	repo      ports.Repository
-	providers map[string]providers.Provider
+	providers *providers.Registry
 }
 
 // NewProviderUsecase creates a new provider use case
-func NewProviderUsecase(repo ports.Repository) *ProviderUsecase {
-	// Initialize providers map with mock provider
-	providersMap := make(map[string]providers.Provider)
-	mockProvider := providers.NewMockProviderAdapter("http://localhost:8083")
-	providersMap["mock-provider"] = mockProvider
-
-	// Create mock provider in database if it doesn't exist
+func NewProviderUsecase(repo ports.Repository, registry *providers.Registry) *ProviderUsecase {
+	// Create mock providers in database if they don't exist
 	ctx := context.Background()
-	existingProvider, _ := repo.GetProviderByID(ctx, "mock-provider")
-	if existingProvider == nil {
-		provider := mockProvider.GetProviderInfo()
-		repo.CreateProvider(ctx, provider)
+	for _, provider := range mockProviders() {
+		existingProvider, _ := repo.GetProviderByID(ctx, provider.ID)
+		if existingProvider != nil {
+			continue
+		}
+		if err := repo.CreateProvider(ctx, provider); err == nil {
+			registry.Register(provider)
+		}
 	}
 
 	return &ProviderUsecase{
 		repo:      repo,
-		providers: providersMap,
+		providers: registry,
+	}
+}
+
+// mockProviders returns the providers served by the local mock server
+func mockProviders() []*domain.Provider {
+	return []*domain.Provider{
+		{
+			ID:             "mock-provider",
+			Name:           "Mock Provider",
+			APIEndpoint:    "http://localhost:8083",
+			AuthType:       "none",
+			RefreshCadence: domain.RefreshDaily,
+			Category:       domain.CategoryOther,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		},
+		{
+			ID:          "mock-oauth-provider",
+			Name:        "Mock OAuth2 Provider",
+			APIEndpoint: "http://localhost:8083",
+			AuthType:    "oauth2",
+			AuthConfig: domain.ProviderAuthConfig{
+				AuthorizeURL: "http://localhost:8083/oauth/authorize",
+				TokenURL:     "http://localhost:8083/oauth/token",
+				ClientID:     "bill-aggregator",
+				ClientSecret: "mock-secret",
+				Scopes:       []string{"bills:read"},
+			},
+			RefreshCadence: domain.RefreshDaily,
+			Category:       domain.CategoryOther,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		},
 	}
 }
 
 // CreateProvider handles POST /providers
 func (u *ProviderUsecase) CreateProvider(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name        string `json:"name"`
-		APIEndpoint string `json:"api_endpoint"`
-		AuthType    string `json:"auth_type"`
+		Name           string                    `json:"name"`
+		APIEndpoint    string                    `json:"api_endpoint"`
+		AuthType       string                    `json:"auth_type"`
+		AuthConfig     domain.ProviderAuthConfig `json:"auth_config"`
+		RefreshCadence string                    `json:"refresh_cadence"`
+		RateLimit      int                       `json:"rate_limit_per_minute"`
+		RateLimitBurst int                       `json:"rate_limit_burst"`
+		Category       string                    `json:"category"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -59,14 +97,41 @@ func (u *ProviderUsecase) CreateProvider(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
+	if req.RefreshCadence == "" {
+		req.RefreshCadence = domain.RefreshDaily
+	}
+	if _, ok := domain.RefreshInterval(req.RefreshCadence); !ok {
+		http.Error(w, "Invalid refresh cadence", http.StatusBadRequest)
+		return
+	}
+	if req.RateLimit < 0 || req.RateLimitBurst < 0 {
+		http.Error(w, "Invalid rate limit", http.StatusBadRequest)
+		return
+	}
+	category, err := domain.ParseUtilityCategory(req.Category)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	provider := &domain.Provider{
-		ID:          uuid.New().String(),
-		Name:        req.Name,
-		APIEndpoint: req.APIEndpoint,
-		AuthType:    req.AuthType,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:                 uuid.New().String(),
+		Name:               req.Name,
+		APIEndpoint:        req.APIEndpoint,
+		AuthType:           req.AuthType,
+		AuthConfig:         req.AuthConfig,
+		RefreshCadence:     req.RefreshCadence,
+		RateLimitPerMinute: req.RateLimit,
+		RateLimitBurst:     req.RateLimitBurst,
+		Category:           category,
+		CreatedAt:          time.Now(),
+		UpdatedAt:          time.Now(),
+	}
+
+	// Make sure an adapter can be built before persisting the provider
+	if err := u.providers.Validate(provider); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	if err := u.repo.CreateProvider(r.Context(), provider); err != nil {
@@ -74,6 +139,10 @@ func (u *ProviderUsecase) CreateProvider(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := u.providers.Register(provider); err != nil {
+		log.Printf("Failed to register provider adapter %s: %v", provider.ID, err)
+	}
+
 	resp := map[string]interface{}{
 		"provider_id": provider.ID,
 		"message":     "Provider created successfully",
@@ -82,6 +151,99 @@ func (u *ProviderUsecase) CreateProvider(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(resp)
 }
 
+// UpdateProvider handles PUT /providers/{provider_id}
+func (u *ProviderUsecase) UpdateProvider(w http.ResponseWriter, r *http.Request) {
+	providerID := mux.Vars(r)["provider_id"]
+	if providerID == "" {
+		http.Error(w, "Invalid provider ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name           string                     `json:"name"`
+		APIEndpoint    string                     `json:"api_endpoint"`
+		AuthType       string                     `json:"auth_type"`
+		AuthConfig     *domain.ProviderAuthConfig `json:"auth_config"`
+		RefreshCadence string                     `json:"refresh_cadence"`
+		// Rate limits are pointers since 0 removes the limit
+		RateLimit      *int   `json:"rate_limit_per_minute"`
+		RateLimitBurst *int   `json:"rate_limit_burst"`
+		Category       string `json:"category"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	provider, err := u.repo.GetProviderByID(r.Context(), providerID)
+	if err != nil {
+		http.Error(w, "Failed to fetch provider", http.StatusInternalServerError)
+		return
+	}
+	if provider == nil {
+		http.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+
+	// Update fields if provided
+	if req.Name != "" {
+		provider.Name = req.Name
+	}
+	if req.APIEndpoint != "" {
+		provider.APIEndpoint = req.APIEndpoint
+	}
+	if req.AuthType != "" {
+		provider.AuthType = req.AuthType
+	}
+	if req.AuthConfig != nil {
+		provider.AuthConfig = *req.AuthConfig
+	}
+	if req.RefreshCadence != "" {
+		if _, ok := domain.RefreshInterval(req.RefreshCadence); !ok {
+			http.Error(w, "Invalid refresh cadence", http.StatusBadRequest)
+			return
+		}
+		provider.RefreshCadence = req.RefreshCadence
+	}
+	if req.RateLimit != nil {
+		provider.RateLimitPerMinute = *req.RateLimit
+	}
+	if req.RateLimitBurst != nil {
+		provider.RateLimitBurst = *req.RateLimitBurst
+	}
+	if provider.RateLimitPerMinute < 0 || provider.RateLimitBurst < 0 {
+		http.Error(w, "Invalid rate limit", http.StatusBadRequest)
+		return
+	}
+	if req.Category != "" {
+		category, err := domain.ParseUtilityCategory(req.Category)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		provider.Category = category
+	}
+	provider.UpdatedAt = time.Now()
+
+	if err := u.providers.Validate(provider); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.repo.UpdateProvider(r.Context(), provider); err != nil {
+		http.Error(w, "Failed to update provider", http.StatusInternalServerError)
+		return
+	}
+
+	if err := u.providers.Register(provider); err != nil {
+		log.Printf("Failed to register provider adapter %s: %v", provider.ID, err)
+	}
+
+	resp := map[string]string{"message": "Provider updated successfully"}
+	json.NewEncoder(w).Encode(resp)
+}
+
 // ListProviders handles GET /providers
 func (u *ProviderUsecase) ListProviders(w http.ResponseWriter, r *http.Request) {
 	providers, err := u.repo.ListProviders(r.Context())
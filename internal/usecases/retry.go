@@ -0,0 +1,77 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/config"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+)
+
+// RetryPolicy retries provider calls that failed for a transient reason with
+// exponential backoff and full jitter
+type RetryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// NewRetryPolicy creates a retry policy from cfg
+func NewRetryPolicy(cfg config.RetryConfig) RetryPolicy {
+	policy := RetryPolicy{
+		maxAttempts: cfg.MaxAttempts,
+		baseDelay:   cfg.BaseDelay,
+		maxDelay:    cfg.MaxDelay,
+	}
+	if policy.maxAttempts < 1 {
+		policy.maxAttempts = 1
+	}
+	return policy
+}
+
+// Do calls fn until it succeeds, fails permanently or the attempts run out,
+// and returns the number of calls made with the last error. Waiting between
+// attempts stops when ctx is done, returning the context's error. A provider
+// asking to wait longer than the maximum delay is not retried.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.maxAttempts || !domain.Retryable(err) {
+			return attempt, err
+		}
+
+		delay, ok := p.delay(attempt, err)
+		if !ok {
+			return attempt, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, ctx.Err()
+		}
+	}
+}
+
+// delay returns how long to wait after the given failed attempt: the
+// provider's Retry-After when present, otherwise a random duration up to the
+// exponential backoff ceiling. It reports false when the provider asked to
+// wait longer than the maximum delay.
+func (p RetryPolicy) delay(attempt int, err error) (time.Duration, bool) {
+	var providerErr *domain.ProviderError
+	if errors.As(err, &providerErr) && providerErr.RetryAfter > 0 {
+		return providerErr.RetryAfter, providerErr.RetryAfter <= p.maxDelay
+	}
+
+	ceiling := p.maxDelay
+	if shift := attempt - 1; shift < 32 && p.baseDelay<<shift < p.maxDelay {
+		ceiling = p.baseDelay << shift
+	}
+	if ceiling <= 0 {
+		return 0, true
+	}
+	return time.Duration(rand.Int63n(int64(ceiling))), true
+}
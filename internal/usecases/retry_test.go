@@ -0,0 +1,125 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/adapters/providers"
+	"github.com/mel-ak/onetap-challenge/internal/config"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testRetryPolicy retries quickly so tests do not wait on backoff
+var testRetryPolicy = NewRetryPolicy(config.RetryConfig{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    10 * time.Millisecond,
+})
+
+func TestRetryPolicyClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"server error", &domain.ProviderError{StatusCode: http.StatusBadGateway}, 3},
+		{"rate limited", &domain.ProviderError{StatusCode: http.StatusTooManyRequests}, 3},
+		{"timeout", fmt.Errorf("failed to fetch bills: %w", context.DeadlineExceeded), 3},
+		{"bad request", &domain.ProviderError{StatusCode: http.StatusBadRequest}, 1},
+		{"invalid credentials", domain.ErrInvalidCredentials, 1},
+		{"circuit open", domain.ErrCircuitOpen, 1},
+		{"unknown", errors.New("failed to decode response"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			attempts, err := testRetryPolicy.Do(context.Background(), func() error {
+				calls++
+				return tt.err
+			})
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.attempts, attempts)
+			assert.Equal(t, tt.attempts, calls)
+		})
+	}
+}
+
+func TestRetryPolicyRetriesUntilSuccess(t *testing.T) {
+	calls := 0
+	attempts, err := testRetryPolicy.Do(context.Background(), func() error {
+		calls++
+		if calls < 2 {
+			return &domain.ProviderError{StatusCode: http.StatusServiceUnavailable}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestRetryPolicyHonorsRetryAfterAndContext(t *testing.T) {
+	// A provider asking to wait longer than the maximum delay is not retried
+	tooLong := &domain.ProviderError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}
+	attempts, err := testRetryPolicy.Do(context.Background(), func() error { return tooLong })
+	assert.Equal(t, tooLong, err)
+	assert.Equal(t, 1, attempts)
+
+	delay, ok := testRetryPolicy.delay(1, &domain.ProviderError{StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Millisecond})
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Millisecond, delay)
+
+	// Backoff is jittered below an exponential ceiling capped at the maximum delay
+	for attempt := 1; attempt <= 10; attempt++ {
+		delay, ok := testRetryPolicy.delay(attempt, errors.New("timeout"))
+		assert.True(t, ok)
+		assert.Less(t, delay, 10*time.Millisecond)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+	}
+
+	// Waiting stops when the context is cancelled
+	slow := NewRetryPolicy(config.RetryConfig{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = slow.Do(ctx, func() error { return &domain.ProviderError{StatusCode: http.StatusBadGateway} })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// newStatusServer starts a fake provider API answering every request with
+// status and counting the requests in calls
+func newStatusServer(t *testing.T, status int, calls *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchBillsMarksRejectedCredentialsWithoutRetrying(t *testing.T) {
+	mockRepo := new(MockRepository)
+	var calls atomic.Int32
+	registry := providers.NewRegistry(mockRepo, nil)
+	assert.NoError(t, registry.Register(&domain.Provider{
+		ID:          "mock-provider",
+		APIEndpoint: newStatusServer(t, http.StatusUnauthorized, &calls).URL,
+		AuthType:    "none",
+	}))
+	usecase := NewBillUsecase(&stubAccountRepository{}, nil, mockRepo, registry, newMemoryStore(), nil, testRetryPolicy)
+
+	account := &domain.LinkedAccount{ID: "acc1", UserID: "user1", ProviderID: "mock-provider", Status: "active"}
+	mockRepo.On("RecordSyncFailure", mock.Anything, "acc1", mock.AnythingOfType("time.Time"), "invalid_credentials", domain.ErrInvalidCredentials.Error()).Return(nil).Once()
+
+	_, err := usecase.fetchBillsWithRetry(context.Background(), account)
+	assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, "invalid_credentials", account.Status)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,201 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/config"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// schedulerLeaseKey is the lease held by the scheduler that queues refreshes
+const schedulerLeaseKey = "scheduler:leader"
+
+// RefreshScheduler queues periodic bill refreshes of linked accounts according
+// to their provider's or user's cadence. Every worker runs a scheduler, but
+// only the one holding the leader lease queues refreshes.
+type RefreshScheduler struct {
+	repo    ports.Repository
+	refresh *BillRefreshUsecase
+	locks   ports.LockService
+	cfg     config.SchedulerConfig
+}
+
+// NewRefreshScheduler creates a scheduler that queues refreshes through refresh
+func NewRefreshScheduler(repo ports.Repository, refresh *BillRefreshUsecase, locks ports.LockService, cfg config.SchedulerConfig) *RefreshScheduler {
+	return &RefreshScheduler{
+		repo:    repo,
+		refresh: refresh,
+		locks:   locks,
+		cfg:     cfg,
+	}
+}
+
+// Run campaigns for the leader lease and, while holding it, schedules due
+// refreshes every interval until ctx is cancelled. The lease is renewed
+// three times per TTL, also while a run is in progress, and released on
+// shutdown so another worker can take over immediately.
+func (s *RefreshScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.LeaseTTL / 3)
+	defer ticker.Stop()
+
+	var token string
+	var lastRun time.Time
+	for {
+		token = s.lead(ctx, token)
+		if token != "" && time.Since(lastRun) >= s.cfg.Interval {
+			lastRun = time.Now()
+			if !s.scheduleLeading(ctx, token, lastRun) {
+				token = ""
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if token != "" {
+				if err := s.locks.ReleaseLock(context.WithoutCancel(ctx), schedulerLeaseKey, token); err != nil {
+					log.Printf("Failed to release scheduler lease: %v", err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// scheduleLeading runs Schedule while renewing the lease held by token in the
+// background. The run stops before its next user if the lease is lost, so two
+// workers never schedule at once. It returns whether the lease is still held.
+func (s *RefreshScheduler) scheduleLeading(ctx context.Context, token string, now time.Time) bool {
+	leading, lost := context.WithCancel(ctx)
+	held := make(chan bool, 1)
+	go func() {
+		held <- s.keepLease(leading, token, lost)
+	}()
+
+	if err := s.Schedule(leading, now); err != nil {
+		log.Printf("Failed to schedule bill refreshes: %v", err)
+	}
+	lost()
+	return <-held
+}
+
+// keepLease renews the lease held by token three times per TTL until ctx is
+// done. When the lease cannot be renewed it calls lost and returns false.
+func (s *RefreshScheduler) keepLease(ctx context.Context, token string, lost context.CancelFunc) bool {
+	ticker := time.NewTicker(s.cfg.LeaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			held, err := s.locks.RefreshLock(ctx, schedulerLeaseKey, token, s.cfg.LeaseTTL)
+			if err != nil && ctx.Err() != nil {
+				return true
+			}
+			if err != nil {
+				log.Printf("Failed to renew scheduler lease: %v", err)
+			}
+			if !held {
+				log.Println("Lost scheduler leadership while scheduling refreshes")
+				lost()
+				return false
+			}
+		case <-ctx.Done():
+			return true
+		}
+	}
+}
+
+// lead renews the leader lease held by token or tries to acquire it. It
+// returns the token of the lease held, or "" when another worker leads.
+func (s *RefreshScheduler) lead(ctx context.Context, token string) string {
+	if token != "" {
+		held, err := s.locks.RefreshLock(ctx, schedulerLeaseKey, token, s.cfg.LeaseTTL)
+		if err != nil {
+			log.Printf("Failed to renew scheduler lease: %v", err)
+		}
+		if held {
+			return token
+		}
+		log.Println("Lost scheduler leadership")
+	}
+
+	token, err := s.locks.AcquireLock(ctx, schedulerLeaseKey, s.cfg.LeaseTTL)
+	if err != nil {
+		log.Printf("Failed to acquire scheduler lease: %v", err)
+		return ""
+	}
+	if token != "" {
+		log.Println("Acquired scheduler leadership")
+	}
+	return token
+}
+
+// Schedule queues one refresh job per user for the accounts due at now and
+// sets their next refresh. Accounts whose job could not be queued stay due
+// and are picked up again on the next run. It stops before the next user once
+// ctx is done.
+func (s *RefreshScheduler) Schedule(ctx context.Context, now time.Time) error {
+	due, err := s.repo.ListDueLinkedAccounts(ctx, now, s.cfg.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	var userIDs []string
+	byUser := make(map[string][]*domain.ScheduledAccount)
+	for _, account := range due {
+		if _, ok := byUser[account.UserID]; !ok {
+			userIDs = append(userIDs, account.UserID)
+		}
+		byUser[account.UserID] = append(byUser[account.UserID], account)
+	}
+
+	scheduled := 0
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			log.Printf("Stopped scheduling refreshes after %d accounts: %v", scheduled, err)
+			return err
+		}
+		accounts := byUser[userID]
+		linked := make([]*domain.LinkedAccount, len(accounts))
+		for i, account := range accounts {
+			linked[i] = &account.LinkedAccount
+		}
+
+		if _, err := s.refresh.QueueRefresh(ctx, userID, domain.RefreshTriggerScheduled, linked); err != nil {
+			log.Printf("Failed to queue scheduled refresh for user %s: %v", userID, err)
+			continue
+		}
+
+		for _, account := range accounts {
+			if err := s.repo.ScheduleLinkedAccount(ctx, account.ID, s.nextRefresh(now, account.Cadence)); err != nil {
+				log.Printf("Failed to schedule next refresh of account %s: %v", account.ID, err)
+				continue
+			}
+			scheduled++
+		}
+	}
+
+	if len(due) > 0 {
+		log.Printf("Queued scheduled refreshes of %d accounts for %d users", scheduled, len(userIDs))
+	}
+	return nil
+}
+
+// nextRefresh returns when an account refreshed at now is due again. The
+// cadence interval is shifted by a random jitter so accounts linked at the
+// same time drift apart instead of hitting their provider together.
+func (s *RefreshScheduler) nextRefresh(now time.Time, cadence string) time.Time {
+	interval, ok := domain.RefreshInterval(cadence)
+	if !ok {
+		log.Printf("Unknown refresh cadence %q, refreshing daily", cadence)
+		interval, _ = domain.RefreshInterval(domain.RefreshDaily)
+	}
+
+	spread := float64(interval) * float64(s.cfg.JitterPercent) / 100
+	jitter := time.Duration(spread * (2*rand.Float64() - 1))
+	return now.Add(interval + jitter)
+}
@@ -0,0 +1,146 @@
+package usecases
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mel-ak/onetap-challenge/internal/config"
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// memoryLocks is an in-memory LockService whose leases never expire
+type memoryLocks struct {
+	mu     sync.Mutex
+	leases map[string]string
+}
+
+func newMemoryLocks() *memoryLocks {
+	return &memoryLocks{leases: make(map[string]string)}
+}
+
+func (l *memoryLocks) AcquireLock(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, held := l.leases[key]; held {
+		return "", nil
+	}
+	token := uuid.New().String()
+	l.leases[key] = token
+	return token, nil
+}
+
+func (l *memoryLocks) RefreshLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leases[key] == token, nil
+}
+
+func (l *memoryLocks) ReleaseLock(ctx context.Context, key, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.leases[key] == token {
+		delete(l.leases, key)
+	}
+	return nil
+}
+
+var testSchedulerConfig = config.SchedulerConfig{
+	Interval:      time.Minute,
+	LeaseTTL:      30 * time.Second,
+	BatchSize:     100,
+	JitterPercent: 10,
+}
+
+func TestRefreshSchedulerElectsOneLeader(t *testing.T) {
+	locks := newMemoryLocks()
+	first := NewRefreshScheduler(nil, nil, locks, testSchedulerConfig)
+	second := NewRefreshScheduler(nil, nil, locks, testSchedulerConfig)
+	ctx := context.Background()
+
+	token := first.lead(ctx, "")
+	assert.NotEmpty(t, token)
+	assert.Empty(t, second.lead(ctx, ""))
+
+	// The leader keeps its lease when renewing it
+	assert.Equal(t, token, first.lead(ctx, token))
+
+	// Another worker takes over once the lease is released
+	assert.NoError(t, locks.ReleaseLock(ctx, schedulerLeaseKey, token))
+	assert.NotEmpty(t, second.lead(ctx, ""))
+	assert.Empty(t, first.lead(ctx, token))
+}
+
+func TestRefreshSchedulerQueuesDueAccounts(t *testing.T) {
+	mockRepo := new(MockRepository)
+	store := newMemoryStore()
+	queue := newMemoryQueue()
+	refresh := NewBillRefreshUsecase(mockRepo, newTestRegistry(t, mockRepo), store, store, queue, nil, testRetryPolicy)
+	scheduler := NewRefreshScheduler(mockRepo, refresh, newMemoryLocks(), testSchedulerConfig)
+
+	now := time.Now()
+	due := []*domain.ScheduledAccount{
+		{LinkedAccount: domain.LinkedAccount{ID: "acc1", UserID: "user1", ProviderID: "mock-provider"}, Cadence: domain.RefreshDaily},
+		{LinkedAccount: domain.LinkedAccount{ID: "acc2", UserID: "user2", ProviderID: "mock-provider"}, Cadence: domain.RefreshWeekly},
+		{LinkedAccount: domain.LinkedAccount{ID: "acc3", UserID: "user1", ProviderID: "mock-provider"}, Cadence: domain.RefreshDaily},
+	}
+	mockRepo.On("ListDueLinkedAccounts", mock.Anything, now, 100).Return(due, nil)
+
+	// The next refresh is one cadence away, give or take the jitter
+	within := func(interval time.Duration) interface{} {
+		return mock.MatchedBy(func(next time.Time) bool {
+			offset := next.Sub(now) - interval
+			return offset >= -interval/10 && offset <= interval/10
+		})
+	}
+	mockRepo.On("ScheduleLinkedAccount", mock.Anything, "acc1", within(24*time.Hour)).Return(nil).Once()
+	mockRepo.On("ScheduleLinkedAccount", mock.Anything, "acc2", within(7*24*time.Hour)).Return(nil).Once()
+	mockRepo.On("ScheduleLinkedAccount", mock.Anything, "acc3", within(24*time.Hour)).Return(nil).Once()
+
+	assert.NoError(t, scheduler.Schedule(context.Background(), now))
+	mockRepo.AssertExpectations(t)
+
+	// One scheduled job is queued per user
+	assert.Len(t, queue.jobs, 2)
+	accounts := make(map[string]int)
+	for _, job := range store.jobs {
+		assert.Equal(t, domain.RefreshTriggerScheduled, job.Trigger)
+		accounts[job.UserID] = len(job.Accounts)
+	}
+	assert.Equal(t, map[string]int{"user1": 2, "user2": 1}, accounts)
+}
+
+func TestRefreshSchedulerStopsWhenLeaseIsLost(t *testing.T) {
+	mockRepo := new(MockRepository)
+	store := newMemoryStore()
+	queue := newMemoryQueue()
+	refresh := NewBillRefreshUsecase(mockRepo, newTestRegistry(t, mockRepo), store, store, queue, nil, testRetryPolicy)
+	locks := newMemoryLocks()
+	cfg := testSchedulerConfig
+	cfg.LeaseTTL = 30 * time.Millisecond
+	scheduler := NewRefreshScheduler(mockRepo, refresh, locks, cfg)
+
+	token := scheduler.lead(context.Background(), "")
+	assert.NotEmpty(t, token)
+
+	// Another worker takes the lease over while a run is in progress
+	leading, lost := context.WithCancel(context.Background())
+	defer lost()
+	assert.NoError(t, locks.ReleaseLock(context.Background(), schedulerLeaseKey, token))
+	assert.NotEmpty(t, NewRefreshScheduler(nil, nil, locks, cfg).lead(context.Background(), ""))
+	assert.False(t, scheduler.keepLease(leading, token, lost))
+	assert.Error(t, leading.Err())
+
+	// so the run stops before queueing refreshes of the next user
+	now := time.Now()
+	mockRepo.On("ListDueLinkedAccounts", mock.Anything, now, 100).Return([]*domain.ScheduledAccount{
+		{LinkedAccount: domain.LinkedAccount{ID: "acc1", UserID: "user1", ProviderID: "mock-provider"}, Cadence: domain.RefreshDaily},
+	}, nil)
+	assert.ErrorIs(t, scheduler.Schedule(leading, now), context.Canceled)
+	assert.Empty(t, queue.jobs)
+	mockRepo.AssertNotCalled(t, "ScheduleLinkedAccount", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -100,9 +100,10 @@ func (u *UserUsecase) GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := map[string]interface{}{
-		"user_id":    user.ID,
-		"email":      user.Email,
-		"created_at": user.CreatedAt,
+		"user_id":            user.ID,
+		"email":              user.Email,
+		"created_at":         user.CreatedAt,
+		"preferred_currency": user.Currency(),
 	}
 	json.NewEncoder(w).Encode(resp)
 }
@@ -118,6 +119,11 @@ func (u *UserUsecase) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// RefreshCadence overrides the provider cadences; "" clears the override
+		RefreshCadence *string `json:"refresh_cadence"`
+		// PreferredCurrency is what bill totals are converted to; "" resets
+		// it to the default currency
+		PreferredCurrency *string `json:"preferred_currency"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -159,6 +165,25 @@ func (u *UserUsecase) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		user.Password = string(hash)
 	}
 
+	if req.RefreshCadence != nil {
+		if _, ok := domain.RefreshInterval(*req.RefreshCadence); !ok && *req.RefreshCadence != "" {
+			http.Error(w, "Invalid refresh cadence", http.StatusBadRequest)
+			return
+		}
+		user.RefreshCadence = *req.RefreshCadence
+	}
+
+	if req.PreferredCurrency != nil {
+		currency := ""
+		if *req.PreferredCurrency != "" {
+			if currency, err = domain.ParseCurrency(*req.PreferredCurrency); err != nil {
+				http.Error(w, "Invalid preferred currency", http.StatusBadRequest)
+				return
+			}
+		}
+		user.PreferredCurrency = currency
+	}
+
 	user.UpdatedAt = time.Now()
 
 	if err := u.repo.UpdateUser(r.Context(), user); err != nil {
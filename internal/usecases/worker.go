@@ -0,0 +1,116 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mel-ak/onetap-challenge/internal/domain"
+	"github.com/mel-ak/onetap-challenge/internal/ports"
+)
+
+// JobHandler processes the payload of one job type. Returning an error
+// schedules the job for retry.
+type JobHandler func(ctx context.Context, payload json.RawMessage) error
+
+// JobWorker consumes the job queue and dispatches jobs to their handlers
+type JobWorker struct {
+	queue     ports.JobQueue
+	handlers  map[string]JobHandler
+	heartbeat time.Duration
+}
+
+// NewJobWorker creates a worker for queue. The visibility timeout of a job
+// is extended every heartbeat while its handler runs, so heartbeat must be
+// well below the queue's visibility timeout.
+func NewJobWorker(queue ports.JobQueue, heartbeat time.Duration) *JobWorker {
+	return &JobWorker{
+		queue:     queue,
+		handlers:  make(map[string]JobHandler),
+		heartbeat: heartbeat,
+	}
+}
+
+// Handle registers the handler for a job type
+func (w *JobWorker) Handle(jobType string, handler JobHandler) {
+	w.handlers[jobType] = handler
+}
+
+// Run processes jobs with concurrency goroutines until ctx is cancelled. Jobs
+// in flight when ctx is cancelled are allowed to finish before Run returns.
+func (w *JobWorker) Run(ctx context.Context, concurrency int) {
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				job, err := w.queue.Dequeue(ctx, 5*time.Second)
+				if err != nil {
+					if ctx.Err() == nil {
+						log.Printf("Failed to dequeue job: %v", err)
+						time.Sleep(time.Second)
+					}
+					continue
+				}
+				if job != nil {
+					w.process(context.WithoutCancel(ctx), job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// process runs the handler of job and acknowledges or retries it
+func (w *JobWorker) process(ctx context.Context, job *domain.Job) {
+	handler, ok := w.handlers[job.Type]
+	err := fmt.Errorf("no handler for job type %q", job.Type)
+	if ok {
+		stop := w.keepReserved(ctx, job)
+		err = handler(ctx, job.Payload)
+		stop()
+	}
+
+	if err == nil {
+		if err := w.queue.Ack(ctx, job); err != nil {
+			log.Printf("Failed to acknowledge job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Job %s (%s) failed on attempt %d/%d: %v", job.ID, job.Type, job.Attempts, job.MaxAttempts, err)
+	if err := w.queue.Nack(ctx, job, err); err != nil {
+		log.Printf("Failed to reschedule job %s: %v", job.ID, err)
+	}
+}
+
+// keepReserved extends the visibility timeout of job every heartbeat until
+// the returned function is called, so that slow jobs are not delivered to
+// another worker while they still run
+func (w *JobWorker) keepReserved(ctx context.Context, job *domain.Job) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(w.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := w.queue.Extend(ctx, job.ID); err != nil {
+					log.Printf("Failed to extend job %s (%s): %v", job.ID, job.Type, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_linked_accounts_credentials_key_version;
+
+ALTER TABLE linked_accounts DROP COLUMN IF EXISTS credentials_key_version;
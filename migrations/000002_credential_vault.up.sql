@@ -0,0 +1,4 @@
+-- Track the master key version credentials are encrypted under (0 = plaintext)
+ALTER TABLE linked_accounts ADD COLUMN credentials_key_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_linked_accounts_credentials_key_version ON linked_accounts(credentials_key_version);
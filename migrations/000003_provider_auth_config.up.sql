@@ -0,0 +1,2 @@
+-- Per-provider auth settings (OAuth2 endpoints and client credentials, etc.)
+ALTER TABLE providers ADD COLUMN auth_config JSONB NOT NULL DEFAULT '{}'::jsonb;
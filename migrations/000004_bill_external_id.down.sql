@@ -0,0 +1,3 @@
+ALTER TABLE bills DROP CONSTRAINT IF EXISTS bills_linked_account_id_external_id_key;
+
+ALTER TABLE bills DROP COLUMN IF EXISTS external_id;
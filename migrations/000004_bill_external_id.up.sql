@@ -0,0 +1,6 @@
+-- Identify bills by the provider's own bill ID so refreshes can upsert them
+ALTER TABLE bills ADD COLUMN external_id VARCHAR(255);
+UPDATE bills SET external_id = id WHERE external_id IS NULL;
+ALTER TABLE bills ALTER COLUMN external_id SET NOT NULL;
+
+ALTER TABLE bills ADD CONSTRAINT bills_linked_account_id_external_id_key UNIQUE (linked_account_id, external_id);
@@ -0,0 +1,2 @@
+-- Set when a refresh no longer returns the bill from the provider
+ALTER TABLE bills ADD COLUMN missing_since TIMESTAMP;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_linked_accounts_next_scheduled_at;
+
+ALTER TABLE linked_accounts DROP COLUMN IF EXISTS next_scheduled_at;
+ALTER TABLE linked_accounts DROP COLUMN IF EXISTS last_success_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS refresh_cadence;
+ALTER TABLE providers DROP COLUMN IF EXISTS refresh_cadence;
@@ -0,0 +1,7 @@
+ALTER TABLE providers ADD COLUMN refresh_cadence VARCHAR(20) NOT NULL DEFAULT 'daily';
+ALTER TABLE users ADD COLUMN refresh_cadence VARCHAR(20);
+
+ALTER TABLE linked_accounts ADD COLUMN last_success_at TIMESTAMP;
+ALTER TABLE linked_accounts ADD COLUMN next_scheduled_at TIMESTAMP;
+
+CREATE INDEX idx_linked_accounts_next_scheduled_at ON linked_accounts(next_scheduled_at);
@@ -0,0 +1,3 @@
+ALTER TABLE linked_accounts DROP COLUMN IF EXISTS last_error;
+ALTER TABLE linked_accounts DROP COLUMN IF EXISTS consecutive_failures;
+ALTER TABLE linked_accounts DROP COLUMN IF EXISTS last_attempt_at;
@@ -0,0 +1,5 @@
+ALTER TABLE linked_accounts ADD COLUMN last_attempt_at TIMESTAMP;
+ALTER TABLE linked_accounts ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE linked_accounts ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+
+UPDATE linked_accounts SET last_attempt_at = last_success_at WHERE last_success_at IS NOT NULL;
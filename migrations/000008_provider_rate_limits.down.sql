@@ -0,0 +1,2 @@
+ALTER TABLE providers DROP COLUMN IF EXISTS rate_limit_burst;
+ALTER TABLE providers DROP COLUMN IF EXISTS rate_limit_per_minute;
@@ -0,0 +1,2 @@
+ALTER TABLE providers ADD COLUMN rate_limit_per_minute INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE providers ADD COLUMN rate_limit_burst INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS bill_status_history;
+ALTER TABLE bills DROP CONSTRAINT IF EXISTS bills_status_check;
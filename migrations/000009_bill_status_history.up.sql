@@ -0,0 +1,23 @@
+-- Bill statuses follow a lifecycle; statuses providers sent before it existed
+-- are mapped onto it
+UPDATE bills SET status = LOWER(status);
+UPDATE bills SET status = 'cancelled' WHERE status = 'canceled';
+UPDATE bills SET status = 'unpaid'
+WHERE status NOT IN ('issued', 'unpaid', 'partially_paid', 'paid', 'overdue', 'disputed', 'cancelled');
+ALTER TABLE bills ADD CONSTRAINT bills_status_check
+    CHECK (status IN ('issued', 'unpaid', 'partially_paid', 'paid', 'overdue', 'disputed', 'cancelled'));
+
+-- Every status a bill took, and whether the provider or this service set it
+CREATE TABLE bill_status_history (
+    id VARCHAR(36) PRIMARY KEY,
+    bill_id VARCHAR(36) NOT NULL REFERENCES bills(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_bill_status_history_bill_id ON bill_status_history(bill_id, changed_at);
+
+INSERT INTO bill_status_history (id, bill_id, from_status, to_status, source, changed_at)
+SELECT gen_random_uuid()::text, id, NULL, status, 'provider', created_at FROM bills;
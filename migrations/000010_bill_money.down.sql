@@ -0,0 +1,13 @@
+ALTER TABLE bills ADD COLUMN amount DECIMAL(10,2);
+-- Minor units per currency as in domain.MinorDigits; currencies with more than
+-- two decimals are rounded to the two the column holds
+UPDATE bills SET amount = amount_minor / CASE
+    WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF',
+                      'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000
+    WHEN currency IN ('CLF', 'UYW') THEN 10000
+    ELSE 100
+END::numeric;
+ALTER TABLE bills ALTER COLUMN amount SET NOT NULL;
+ALTER TABLE bills DROP COLUMN currency;
+ALTER TABLE bills DROP COLUMN amount_minor;
@@ -0,0 +1,6 @@
+-- Amounts are stored exactly in the minor units of their ISO 4217 currency
+ALTER TABLE bills ADD COLUMN amount_minor BIGINT;
+ALTER TABLE bills ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+UPDATE bills SET amount_minor = ROUND(amount * 100);
+ALTER TABLE bills ALTER COLUMN amount_minor SET NOT NULL;
+ALTER TABLE bills DROP COLUMN amount;
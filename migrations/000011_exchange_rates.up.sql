@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN preferred_currency VARCHAR(3);
+
+-- The exchange rates in use: 1 unit of base is worth rate units of currency
+CREATE TABLE exchange_rates (
+    currency VARCHAR(3) PRIMARY KEY,
+    base VARCHAR(3) NOT NULL,
+    rate NUMERIC(30, 12) NOT NULL CHECK (rate > 0),
+    rate_date DATE NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
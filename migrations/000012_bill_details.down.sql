@@ -0,0 +1,4 @@
+ALTER TABLE bills DROP COLUMN IF EXISTS details_digest;
+
+DROP TABLE IF EXISTS usage_readings;
+DROP TABLE IF EXISTS bill_line_items;
@@ -0,0 +1,26 @@
+-- The charges making up a bill, in the order the provider listed them
+CREATE TABLE bill_line_items (
+    bill_id VARCHAR(36) NOT NULL REFERENCES bills(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    category VARCHAR(50),
+    amount_minor BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    PRIMARY KEY (bill_id, position)
+);
+
+-- What a bill's usage was, e.g. kWh or m³ consumed over its period
+CREATE TABLE usage_readings (
+    bill_id VARCHAR(36) NOT NULL REFERENCES bills(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    quantity NUMERIC NOT NULL CHECK (quantity >= 0),
+    unit VARCHAR(20) NOT NULL,
+    period_start TIMESTAMP,
+    period_end TIMESTAMP,
+    meter_id VARCHAR(100),
+    PRIMARY KEY (bill_id, position)
+);
+
+-- Digest of the line items and usage last stored, so that upserts only
+-- rewrite them when the provider sends different ones
+ALTER TABLE bills ADD COLUMN details_digest VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_bills_account_amount;
+DROP INDEX IF EXISTS idx_bills_account_bill_date;
+DROP INDEX IF EXISTS idx_bills_account_due_date;
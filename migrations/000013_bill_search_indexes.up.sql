@@ -0,0 +1,5 @@
+-- Bill searches filter a user's accounts and page by (sort column, id), so
+-- each sort order has an index ending in id for keyset pagination
+CREATE INDEX idx_bills_account_due_date ON bills(linked_account_id, due_date, id);
+CREATE INDEX idx_bills_account_bill_date ON bills(linked_account_id, bill_date, id);
+CREATE INDEX idx_bills_account_amount ON bills(linked_account_id, currency, amount_minor, id);
@@ -0,0 +1,2 @@
+-- The utility a provider bills for, which spending insights are grouped by
+ALTER TABLE providers ADD COLUMN category VARCHAR(20) NOT NULL DEFAULT 'other';